@@ -3,8 +3,10 @@ package testutil
 import (
 	"bytes"
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"io"
+	"sync"
 )
 
 // ContentAt allows users of test clients to implement their own content storage.
@@ -22,35 +24,83 @@ type ContentAt interface {
 }
 
 // ByteContent stores data for content storage tests.
+//
+// ByteContent is safe for concurrent use, and copy-on-write: a write never
+// modifies bytes that may have been observed, so slices returned by Bytes
+// are never modified and each ReadAt observes the contents either before or
+// after any concurrent write. A write that overwrites existing bytes
+// replaces Data with a modified copy; a write past the end may append to
+// Data in place, as the bytes past its length are not visible to readers,
+// and grows the buffer geometrically as needed. Data may be set when the
+// ByteContent is created, but must not be accessed directly while the
+// ByteContent is shared with other goroutines.
 type ByteContent struct {
 	Data []byte
+
+	mu sync.RWMutex // guards Data and grown
+	// grown is set when Data was allocated by WriteAt, so that its spare
+	// capacity may be used by appends.
+	grown bool
+}
+
+// Bytes returns the current contents. The returned slice must not be
+// modified.
+func (bc *ByteContent) Bytes() []byte {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.Data
 }
 
 // ReadAt reads from the specified offset
 func (bc *ByteContent) ReadAt(p []byte, off int64) (int, error) {
-	reader := bytes.NewReader(bc.Data)
-	return reader.ReadAt(p, off)
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bytes.NewReader(bc.Data).ReadAt(p, off)
 }
 
-// WriteAt writes at the specified offset
+// WriteAt writes at the specified offset. It copies the contents if the
+// write overlaps them or they must grow beyond their capacity.
 func (bc *ByteContent) WriteAt(p []byte, off int64) (int, error) {
-	if off+int64(len(p)) > int64(len(bc.Data)) {
-		tmp := make([]byte, off+int64(len(p)))
-		copy(tmp, bc.Data)
-		bc.Data = tmp
+	if off < 0 {
+		return 0, errors.New("testutil.ByteContent.WriteAt: negative offset")
 	}
-
-	copy(bc.Data[off:off+int64(len(p))], p)
-
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	n := int64(len(bc.Data))
+	end := off + int64(len(p))
+	size := n
+	if end > size {
+		size = end
+	}
+	if off < n || !bc.grown || size > int64(cap(bc.Data)) {
+		capacity := size
+		if size > n {
+			capacity = max(size, 2*int64(cap(bc.Data)))
+		}
+		data := make([]byte, size, capacity)
+		copy(data, bc.Data)
+		bc.Data, bc.grown = data, true
+	} else {
+		bc.Data = bc.Data[:size]
+		// Clear any bytes between the old end and off.
+		for i := n; i < off; i++ {
+			bc.Data[i] = 0
+		}
+	}
+	copy(bc.Data[off:], p)
 	return len(p), nil
 }
 
 // Checksum implements ContentAt.
 func (bc *ByteContent) Checksum() string {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
 	return fmt.Sprintf("%x", md5.Sum(bc.Data))
 }
 
 // Size returns the size of the contents
 func (bc *ByteContent) Size() int64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
 	return int64(len(bc.Data))
 }
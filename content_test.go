@@ -0,0 +1,191 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package testutil_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/grailbio/testutil"
+	"github.com/grailbio/testutil/s3test"
+)
+
+func TestByteContentCopyOnWrite(t *testing.T) {
+	bc := &testutil.ByteContent{Data: []byte("hello")}
+	before := bc.Bytes()
+	if _, err := bc.WriteAt([]byte("J"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.WriteAt([]byte("!"), 6); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(before), "hello"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := string(bc.Bytes()), "Jello\x00!"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := bc.Size(), int64(7); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := bc.WriteAt([]byte("x"), -1); err == nil {
+		t.Error("expected an error for a negative offset")
+	}
+}
+
+func TestByteContentAppend(t *testing.T) {
+	var (
+		bc   testutil.ByteContent
+		want []byte
+		snap []byte
+	)
+	for i := 0; i < 1000; i++ {
+		p := []byte{byte(i), byte(i >> 8)}
+		if _, err := bc.WriteAt(p, int64(len(want))); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, p...)
+		if i == 500 {
+			snap = bc.Bytes()
+		}
+	}
+	if _, err := bc.WriteAt([]byte("x"), 0); err != nil {
+		t.Fatal(err)
+	}
+	want[0] = 'x'
+	if got := bc.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("got %d bytes, want %d", len(got), len(want))
+	}
+	if got, want := len(snap), 1002; got != want || snap[0] != 0 {
+		t.Errorf("snapshot was modified: got %d bytes starting with %q", got, snap[0])
+	}
+	p := []byte("yy")
+	if got := testing.AllocsPerRun(1000, func() { bc.WriteAt(p, bc.Size()) }); got != 0 { // nolint: errcheck
+		t.Errorf("got %v allocations per append", got)
+	}
+}
+
+// TestByteContentConcurrentDownloads downloads a key with parallel
+// s3manager downloads and GetObject requests while it is being overwritten
+// with all 'x's and all 'y's, and checks that each download observes a
+// single version of the contents. Run with -race.
+func TestByteContentConcurrentDownloads(t *testing.T) {
+	const (
+		bucket = "bucket"
+		size   = 256<<10 + 123
+	)
+	client := s3test.NewClient(t, bucket)
+	versions := [][]byte{bytes.Repeat([]byte{'x'}, size), bytes.Repeat([]byte{'y'}, size)}
+	content := &testutil.ByteContent{Data: versions[0]}
+	client.SetFileContentAt("key", content, "")
+
+	var (
+		wg   sync.WaitGroup
+		stop = make(chan struct{})
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if _, err := content.WriteAt(versions[i%2], 0); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	// uniform checks that b is one of the versions.
+	uniform := func(b []byte) {
+		if !bytes.Equal(b, versions[0]) && !bytes.Equal(b, versions[1]) {
+			t.Errorf("download of %d bytes mixes versions: %q...%q", len(b), b[0], b[len(b)-1])
+		}
+	}
+	var downloads sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		downloads.Add(1)
+		go func() {
+			defer downloads.Done()
+			// Each download is a single GetObject request, whose body is read
+			// in many chunks.
+			downloader := s3manager.NewDownloaderWithClient(client, func(d *s3manager.Downloader) {
+				d.PartSize = size
+			})
+			for j := 0; j < 5; j++ {
+				buf := aws.NewWriteAtBuffer(nil)
+				n, err := downloader.Download(buf, &s3.GetObjectInput{
+					Bucket: aws.String(bucket),
+					Key:    aws.String("key"),
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if n != size {
+					t.Errorf("got %d bytes, want %d", n, size)
+				}
+				uniform(buf.Bytes())
+
+				out, err := client.GetObjectWithContext(context.Background(), &s3.GetObjectInput{
+					Bucket: aws.String(bucket),
+					Key:    aws.String("key"),
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				body, err := ioutil.ReadAll(out.Body)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				uniform(body)
+				if got, want := aws.StringValue(out.ETag), fmt.Sprintf("%x", md5.Sum(body)); got != want {
+					t.Errorf("got ETag %s, want %s", got, want)
+				}
+			}
+		}()
+	}
+	downloads.Wait()
+	close(stop)
+	wg.Wait()
+}
+
+func TestFakeContentAtConcurrent(t *testing.T) {
+	fca := &testutil.FakeContentAt{T: t, SizeInBytes: 1 << 20}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := make([]byte, 1000)
+			for j := 0; j < 100; j++ {
+				if _, err := fca.Seek(0, io.SeekStart); err != nil {
+					t.Error(err)
+				}
+				if _, err := fca.Read(p); err != nil && err != io.EOF {
+					t.Error(err)
+				}
+				if _, err := fca.ReadAt(p, int64(j*1000)); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,241 @@
+package testutil
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// DiskContent is a ContentAt backed by a temporary file, for tests that need
+// objects too large to hold in memory comfortably (e.g., as ByteContents
+// passed to s3test.Client.SetFileContentAt). Its checksum is computed by
+// streaming the file the first time Checksum is called after a write.
+//
+// A DiskContent created by NewMappedContent serves reads from a memory
+// mapping of the file where the platform supports it, which avoids a system
+// call per read. If the file cannot be mapped, reads are served from the
+// file.
+//
+// DiskContent is safe for concurrent use. Close removes the file; it is
+// called automatically at the end of the test if t implements
+// Cleanup(func()), as testing.TB does.
+type DiskContent struct {
+	mu      sync.RWMutex
+	f       *os.File
+	cleanup func()
+	size    int64
+	mmap    bool
+	mapped  []byte // nil if not mapped (yet)
+	// mmapErr is set if the file could not be mapped, in which case reads
+	// are served from the file.
+	mmapErr error
+	closed  bool
+
+	sum lazyMD5
+}
+
+// NewDiskContent returns an empty DiskContent whose file is created in a
+// new temporary directory in dir (see TempDir).
+func NewDiskContent(t Testing, dir string) *DiskContent {
+	return newDiskContent(t, dir, false)
+}
+
+// NewMappedContent is like NewDiskContent, but reads are served from a
+// memory mapping of the file.
+func NewMappedContent(t Testing, dir string) *DiskContent {
+	return newDiskContent(t, dir, true)
+}
+
+func newDiskContent(t Testing, dir string, mmap bool) *DiskContent {
+	d, cleanup := TempDir(t, dir, "diskcontent-")
+	f, err := os.OpenFile(filepath.Join(d, "content"), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		cleanup()
+		_, file, line, _ := runtime.Caller(2)
+		t.Fatalf("%s:%d: NewDiskContent(%v): %v", filepath.Base(file), line, dir, err)
+	}
+	c := &DiskContent{f: f, cleanup: cleanup, mmap: mmap}
+	if tc, ok := t.(interface{ Cleanup(func()) }); ok {
+		tc.Cleanup(func() {
+			if err := c.Close(); err != nil {
+				t.Logf("DiskContent.Close %v: %v", f.Name(), err)
+			}
+		})
+	}
+	return c
+}
+
+// Name returns the name of the file holding the contents.
+func (c *DiskContent) Name() string {
+	return c.f.Name()
+}
+
+var errDiskContentClosed = errors.New("testutil.DiskContent: closed")
+
+// ReadAt implements io.ReaderAt.
+func (c *DiskContent) ReadAt(p []byte, off int64) (int, error) {
+	c.mu.RLock()
+	if c.mmap && c.mapped == nil && c.mmapErr == nil && c.size > 0 && !c.closed {
+		// Map the file, which requires the write lock.
+		c.mu.RUnlock()
+		c.mu.Lock()
+		if c.mapped == nil && c.mmapErr == nil && c.size > 0 && !c.closed {
+			c.mapped, c.mmapErr = mmapFile(c.f, c.size)
+		}
+		c.mu.Unlock()
+		c.mu.RLock()
+	}
+	defer c.mu.RUnlock()
+	switch {
+	case c.closed:
+		return 0, errDiskContentClosed
+	case off < 0:
+		return 0, errors.New("testutil.DiskContent.ReadAt: negative offset")
+	case off >= c.size:
+		return 0, io.EOF
+	case c.mapped != nil:
+		n := copy(p, c.mapped[off:c.size])
+		if n < len(p) {
+			return n, io.EOF
+		}
+		return n, nil
+	}
+	n, err := c.f.ReadAt(p[:min(int64(len(p)), c.size-off)], off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// WriteAt implements io.WriterAt.
+func (c *DiskContent) WriteAt(p []byte, off int64) (int, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, errDiskContentClosed
+	}
+	n, err := c.f.WriteAt(p, off)
+	if end := off + int64(n); end > c.size {
+		c.size = end
+		// The mapping no longer covers the contents.
+		c.unmapLocked()
+	}
+	c.mu.Unlock()
+	c.sum.reset()
+	return n, err
+}
+
+// ReadFrom appends the contents of r, implementing io.ReaderFrom.
+func (c *DiskContent) ReadFrom(r io.Reader) (int64, error) {
+	buf := make([]byte, 1<<20)
+	var total int64
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := c.WriteAt(buf[:n], c.Size()); werr != nil {
+				return total, werr
+			}
+			total += int64(n)
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// Size implements ContentAt.
+func (c *DiskContent) Size() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.size
+}
+
+// Checksum implements ContentAt. After Close, it returns the checksum
+// computed before the DiskContent was closed, if any, and otherwise the
+// empty string.
+func (c *DiskContent) Checksum() string {
+	c.mu.RLock()
+	size, closed := c.size, c.closed
+	c.mu.RUnlock()
+	if closed {
+		return c.sum.cached(size)
+	}
+	return c.sum.get(c, size)
+}
+
+// Close releases the file and removes it. The DiskContent cannot be used
+// afterwards. Close may be called more than once.
+func (c *DiskContent) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.unmapLocked()
+	err := c.f.Close()
+	c.cleanup()
+	if err != nil {
+		return fmt.Errorf("testutil.DiskContent: %v", err)
+	}
+	return nil
+}
+
+// unmapLocked releases the mapping of the file, if any. REQUIRES: c.mu is
+// locked.
+func (c *DiskContent) unmapLocked() {
+	if c.mapped != nil {
+		munmap(c.mapped)
+		c.mapped = nil
+	}
+}
+
+// lazyMD5 caches the MD5 checksum of a ContentAt.
+type lazyMD5 struct {
+	mu    sync.Mutex
+	valid bool
+	size  int64
+	sum   string
+}
+
+// get returns the MD5 hex string of the size bytes of r, computing it if
+// the checksum has not been computed, for this size, since the last reset.
+// It returns the empty string if r cannot be read.
+func (l *lazyMD5) get(r io.ReaderAt, size int64) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.valid || l.size != size {
+		h := md5.New()
+		if _, err := io.Copy(h, io.NewSectionReader(r, 0, size)); err != nil {
+			return ""
+		}
+		l.sum, l.size, l.valid = fmt.Sprintf("%x", h.Sum(nil)), size, true
+	}
+	return l.sum
+}
+
+// cached returns the checksum of the size bytes computed by get, or the
+// empty string if there is none.
+func (l *lazyMD5) cached(size int64) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.valid || l.size != size {
+		return ""
+	}
+	return l.sum
+}
+
+// reset discards the cached checksum.
+func (l *lazyMD5) reset() {
+	l.mu.Lock()
+	l.valid = false
+	l.mu.Unlock()
+}
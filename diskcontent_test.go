@@ -0,0 +1,120 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package testutil_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil"
+	"github.com/grailbio/testutil/s3test"
+)
+
+func TestDiskContent(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		new  func(testutil.Testing, string) *testutil.DiskContent
+	}{
+		{"file", testutil.NewDiskContent},
+		{"mmap", testutil.NewMappedContent},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := test.new(t, "")
+			checkContent(t, c, nil)
+			src := &testutil.RandomContent{Seed: 3, SizeInBytes: 3<<20 + 5}
+			n, err := c.ReadFrom(io.NewSectionReader(src, 0, src.Size()))
+			if err != nil || n != src.Size() {
+				t.Fatalf("got %v, %v", n, err)
+			}
+			want := readAll(t, src)
+			checkContent(t, c, want)
+
+			// Overwrite and extend the contents; concurrent reads see
+			// either version of each range.
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p := make([]byte, 100)
+				for i := 0; i < 100; i++ {
+					if _, err := c.ReadAt(p, int64(i)); err != nil {
+						t.Error(err)
+					}
+				}
+			}()
+			if _, err := c.WriteAt([]byte("hello"), 0); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.WriteAt([]byte("tail"), int64(len(want))); err != nil {
+				t.Fatal(err)
+			}
+			wg.Wait()
+			copy(want, "hello")
+			want = append(want, "tail"...)
+			checkContent(t, c, want)
+
+			client := s3test.NewClient(t, "bucket")
+			client.SetFileContentAt("big", c, "")
+			out, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("big")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(out.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Error("GetObject returned different contents")
+			}
+
+			name, sum := c.Name(), c.Checksum()
+			if err := c.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Checksum(); got != sum {
+				t.Errorf("checksum after Close: got %v, want %v", got, sum)
+			}
+			if _, err := os.Stat(name); !os.IsNotExist(err) {
+				t.Errorf("%v: got %v, want not exist", name, err)
+			}
+			if _, err := c.ReadAt(make([]byte, 1), 0); err == nil {
+				t.Error("expected an error after Close")
+			}
+
+			// The checksum of contents closed before it was computed is
+			// empty.
+			c = test.new(t, "")
+			if _, err := c.WriteAt([]byte("data"), 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Checksum(); got != "" {
+				t.Errorf("checksum after Close: got %v, want none", got)
+			}
+		})
+	}
+}
+
+func TestDiskContentCleanup(t *testing.T) {
+	var name string
+	t.Run("create", func(t *testing.T) {
+		c := testutil.NewMappedContent(t, "")
+		name = c.Name()
+		if _, err := c.WriteAt([]byte("data"), 0); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("%v: got %v, want not exist", name, err)
+	}
+}
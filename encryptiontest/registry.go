@@ -9,6 +9,7 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/sha256"
 	"crypto/sha512"
 	"fmt"
 	"hash"
@@ -73,6 +74,14 @@ func (fr *FakeAESRegistry) NewGCM(block cipher.Block, opts ...interface{}) (aead
 	return cipher.NewGCM(block)
 }
 
+// SSECustomerKey returns a 256-bit key derived from the registry's key, for
+// use as an S3 customer-provided encryption key (SSE-C), e.g., in
+// s3.PutObjectInput.SSECustomerKey.
+func (fr *FakeAESRegistry) SSECustomerKey() string {
+	sum := sha256.Sum256(fr.Key)
+	return string(sum[:])
+}
+
 // NewFakeAESRegistry returns a new FakeAESRegistry
 func NewFakeAESRegistry() *FakeAESRegistry {
 	return &FakeAESRegistry{Key: TestKey}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"sync"
 )
 
 func min(a, b int64) int64 {
@@ -14,12 +15,22 @@ func min(a, b int64) int64 {
 	return b
 }
 
+func max(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 // FakeContentAt implements io.[Reader|ReaderAt|Seeker|Writer] using a virtual
 // file with a predictable pattern. The Read* interfaces will data for the slice
 // based on the virtual file containing a repeating pattern containing the
 // lowercase alphabet. The WriteAt function will verify that the pattern is
 // maintained. This enables unittests with large files without paying the
 // performance penalty of disk writes.
+//
+// FakeContentAt is safe for concurrent use, though concurrent Read, Seek and
+// Write calls share the Current offset. ReadAt and WriteAt do not use it.
 type FakeContentAt struct {
 	T interface {
 		Fatal(...interface{})
@@ -27,16 +38,21 @@ type FakeContentAt struct {
 	SizeInBytes int64
 	Current     int64
 	FailureRate float64
+
+	mu sync.Mutex // guards Current
 }
 
-// Checksum implements ContentAt.
+// Checksum implements ContentAt. Like those of the generated contents (see
+// RandomContent), it is a digest of SizeInBytes rather than of the contents.
 func (fca *FakeContentAt) Checksum() string {
-	return "fakechecksum"
+	return paramChecksum("FakeContentAt %d", fca.SizeInBytes)
 }
 
 // Read implements the io.Reader.
 func (fca *FakeContentAt) Read(p []byte) (int, error) {
-	if fca.Current == fca.SizeInBytes {
+	fca.mu.Lock()
+	defer fca.mu.Unlock()
+	if fca.Current >= fca.SizeInBytes {
 		return 0, io.EOF
 	}
 	if rand.Float64() < fca.FailureRate {
@@ -54,7 +70,10 @@ func (fca *FakeContentAt) Read(p []byte) (int, error) {
 
 // ReadAt implements io.ReaderAt.
 func (fca *FakeContentAt) ReadAt(p []byte, off int64) (int, error) {
-	if off > fca.SizeInBytes {
+	if off < 0 {
+		return 0, errors.New("testutil.FakeContentAt.ReadAt: negative offset")
+	}
+	if off >= fca.SizeInBytes {
 		return 0, io.EOF
 	}
 	if rand.Float64() < fca.FailureRate {
@@ -66,27 +85,38 @@ func (fca *FakeContentAt) ReadAt(p []byte, off int64) (int, error) {
 	for i := int64(0); i < count; i++ {
 		p[i] = byte('a' + int((off+i)%26))
 	}
+	if count < int64(len(p)) {
+		return int(count), io.EOF
+	}
 	return int(count), nil
 }
 
 // Seek implements io.Seeker.
 func (fca *FakeContentAt) Seek(offset int64, whence int) (int64, error) {
+	fca.mu.Lock()
+	defer fca.mu.Unlock()
+	var pos int64
 	switch whence {
-	case 0:
-		fca.Current = offset
-	case 1:
-		fca.Current += offset
-	case 2:
-		fca.Current = fca.Size() + offset
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = fca.Current + offset
+	case io.SeekEnd:
+		pos = fca.Size() + offset
 	default:
-		panic(fmt.Sprintf("not implemented: %d %d", offset, whence))
+		return 0, fmt.Errorf("testutil.FakeContentAt.Seek: invalid whence %d", whence)
 	}
-
+	if pos < 0 {
+		return 0, errors.New("testutil.FakeContentAt.Seek: negative position")
+	}
+	fca.Current = pos
 	return fca.Current, nil
 }
 
 // Write implements io.Writer.
 func (fca *FakeContentAt) Write(p []byte) (int, error) {
+	fca.mu.Lock()
+	defer fca.mu.Unlock()
 	if fca.Current+int64(len(p)) > fca.SizeInBytes {
 		fca.T.Fatal("write beyond the end of content")
 	}
@@ -0,0 +1,11 @@
+// +build !darwin,!linux
+
+package testutil
+
+import "os"
+
+// lockFile is not supported on this platform: work is serialized only
+// within the process.
+func lockFile(f *os.File) error { return nil }
+
+func unlockFile(f *os.File) error { return nil }
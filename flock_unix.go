@@ -0,0 +1,23 @@
+// +build darwin linux
+
+package testutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile acquires an exclusive lock on f, blocking until it is
+// available, to serialize work across processes.
+func lockFile(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,340 @@
+package testutil
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// This file implements ContentAt types whose contents are generated rather
+// than stored, so that tests can model very large objects (e.g., whole
+// genome BAM files) without allocating them. Computing the MD5 of such
+// contents would take time proportional to their size, and s3test calls
+// Checksum for every request that returns an ETag, so their checksums are
+// instead MD5 digests of the parameters that determine the contents, e.g.,
+// RandomContent's Seed and SizeInBytes. Contents generated from the same
+// parameters thus have the same checksum, which differs from that of other
+// contents.
+
+// paramChecksum returns the MD5 hex string of the parameters of generated
+// contents, formatted as by fmt.Sprintf.
+func paramChecksum(format string, args ...interface{}) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf(format, args...))))
+}
+
+// readGenerated implements io.ReaderAt for contents of the given size that
+// are generated by gen, which fills p with the contents at offset off.
+func readGenerated(p []byte, off, size int64, gen func(p []byte, off int64)) (int, error) {
+	if off < 0 {
+		return 0, errors.New("testutil: negative offset")
+	}
+	if off >= size {
+		return 0, io.EOF
+	}
+	n := int(min(int64(len(p)), size-off))
+	gen(p[:n], off)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// verifyGenerated implements io.WriterAt for read-only generated contents:
+// it returns an error unless p matches the contents at off.
+func verifyGenerated(name string, p []byte, off, size int64, gen func(p []byte, off int64)) (int, error) {
+	if off < 0 || off+int64(len(p)) > size {
+		return 0, fmt.Errorf("testutil.%s: write of %d bytes at offset %d is outside the contents of size %d",
+			name, len(p), off, size)
+	}
+	want := make([]byte, len(p))
+	gen(want, off)
+	for i := range p {
+		if p[i] != want[i] {
+			return i, fmt.Errorf("testutil.%s: mismatch at offset %d: got %q, want %q",
+				name, off+int64(i), p[i], want[i])
+		}
+	}
+	return len(p), nil
+}
+
+// splitmix64 is the finalizer of the SplitMix64 generator: it maps
+// consecutive integers to well-distributed pseudo-random values.
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// RandomContent is a read-only ContentAt of SizeInBytes pseudo-random bytes
+// determined by Seed. Any range of the contents can be read in time
+// proportional to its length. WriteAt only verifies that the data written
+// matches the contents, returning an error if not.
+type RandomContent struct {
+	Seed        int64
+	SizeInBytes int64
+}
+
+func (rc *RandomContent) generate(p []byte, off int64) {
+	var (
+		word  uint64
+		index = int64(-1)
+	)
+	for i := range p {
+		o := off + int64(i)
+		if o/8 != index {
+			index = o / 8
+			word = splitmix64(uint64(rc.Seed)*0x2545f4914f6cdd1d ^ uint64(index))
+		}
+		p[i] = byte(word >> (8 * uint(o%8)))
+	}
+}
+
+// ReadAt implements io.ReaderAt.
+func (rc *RandomContent) ReadAt(p []byte, off int64) (int, error) {
+	return readGenerated(p, off, rc.SizeInBytes, rc.generate)
+}
+
+// WriteAt implements io.WriterAt.
+func (rc *RandomContent) WriteAt(p []byte, off int64) (int, error) {
+	return verifyGenerated("RandomContent", p, off, rc.SizeInBytes, rc.generate)
+}
+
+// Size implements ContentAt.
+func (rc *RandomContent) Size() int64 { return rc.SizeInBytes }
+
+// Checksum implements ContentAt.
+func (rc *RandomContent) Checksum() string {
+	return paramChecksum("RandomContent %d %d", rc.Seed, rc.SizeInBytes)
+}
+
+// offsetRecordSize is the size of the records of OffsetContent.
+const offsetRecordSize = 16
+
+// OffsetContent is a read-only ContentAt whose contents encode their own
+// offsets, which makes misplaced data easy to diagnose: the contents are a
+// sequence of 16-byte records, each holding its offset as 15 hexadecimal
+// digits followed by a newline, e.g., "0000000000001f0\n". WriteAt only
+// verifies that the data written matches the contents, returning an error
+// if not.
+type OffsetContent struct {
+	SizeInBytes int64
+}
+
+func (oc *OffsetContent) generate(p []byte, off int64) {
+	const digits = "0123456789abcdef"
+	var (
+		record [offsetRecordSize]byte
+		index  = int64(-1)
+	)
+	for i := range p {
+		o := off + int64(i)
+		if o/offsetRecordSize != index {
+			index = o / offsetRecordSize
+			v := uint64(index * offsetRecordSize)
+			for j := offsetRecordSize - 2; j >= 0; j-- {
+				record[j] = digits[v&0xf]
+				v >>= 4
+			}
+			record[offsetRecordSize-1] = '\n'
+		}
+		p[i] = record[o%offsetRecordSize]
+	}
+}
+
+// ReadAt implements io.ReaderAt.
+func (oc *OffsetContent) ReadAt(p []byte, off int64) (int, error) {
+	return readGenerated(p, off, oc.SizeInBytes, oc.generate)
+}
+
+// WriteAt implements io.WriterAt.
+func (oc *OffsetContent) WriteAt(p []byte, off int64) (int, error) {
+	return verifyGenerated("OffsetContent", p, off, oc.SizeInBytes, oc.generate)
+}
+
+// Size implements ContentAt.
+func (oc *OffsetContent) Size() int64 { return oc.SizeInBytes }
+
+// Checksum implements ContentAt.
+func (oc *OffsetContent) Checksum() string {
+	return paramChecksum("OffsetContent %d", oc.SizeInBytes)
+}
+
+// Extent is a range of explicitly stored data in a SparseContent.
+type Extent struct {
+	Offset int64
+	Data   []byte
+}
+
+// SparseContent is a ContentAt of SizeInBytes bytes that are zero except
+// for its Extents. Where extents overlap, later ones take precedence.
+// WriteAt adds an extent (copying the data written), extending the contents
+// if needed. SparseContent is safe for concurrent use; SizeInBytes and
+// Extents must not be modified directly once it is in use.
+type SparseContent struct {
+	SizeInBytes int64
+	Extents     []Extent
+
+	mu sync.RWMutex
+}
+
+// ReadAt implements io.ReaderAt.
+func (sc *SparseContent) ReadAt(p []byte, off int64) (int, error) {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return readGenerated(p, off, sc.SizeInBytes, func(p []byte, off int64) {
+		for i := range p {
+			p[i] = 0
+		}
+		end := off + int64(len(p))
+		for _, e := range sc.Extents {
+			start, last := e.Offset, e.Offset+int64(len(e.Data))
+			if last <= off || start >= end {
+				continue
+			}
+			if start < off {
+				copy(p, e.Data[off-start:])
+			} else {
+				copy(p[start-off:], e.Data)
+			}
+		}
+	})
+}
+
+// WriteAt implements io.WriterAt.
+func (sc *SparseContent) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("testutil.SparseContent.WriteAt: negative offset")
+	}
+	sc.mu.Lock()
+	sc.Extents = append(sc.Extents, Extent{off, append([]byte(nil), p...)})
+	if end := off + int64(len(p)); end > sc.SizeInBytes {
+		sc.SizeInBytes = end
+	}
+	sc.mu.Unlock()
+	return len(p), nil
+}
+
+// Size implements ContentAt.
+func (sc *SparseContent) Size() int64 {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.SizeInBytes
+}
+
+// Checksum implements ContentAt. It takes time proportional to the size of
+// the extents.
+func (sc *SparseContent) Checksum() string {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	h := md5.New()
+	fmt.Fprintf(h, "SparseContent %d", sc.SizeInBytes)
+	for _, e := range sc.Extents {
+		fmt.Fprintf(h, " %d %d ", e.Offset, len(e.Data))
+		h.Write(e.Data) // nolint: errcheck
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// ConcatContent is a ContentAt that is the concatenation of its Parts.
+// WriteAt writes to the parts, which must not be written to directly, nor
+// resized, once the ConcatContent is in use.
+type ConcatContent struct {
+	Parts []ContentAt
+}
+
+// Concat returns the concatenation of parts.
+func Concat(parts ...ContentAt) *ConcatContent {
+	return &ConcatContent{Parts: parts}
+}
+
+// each calls fn for each part that overlaps the n bytes at offset off, with
+// the offset within the part, and the range of those bytes that it holds.
+func (cc *ConcatContent) each(off int64, n int, fn func(part ContentAt, partOff int64, lo, hi int) error) error {
+	starts := make([]int64, len(cc.Parts)+1)
+	for i, part := range cc.Parts {
+		starts[i+1] = starts[i] + part.Size()
+	}
+	end := off + int64(n)
+	i := sort.Search(len(cc.Parts), func(i int) bool { return starts[i+1] > off })
+	for ; i < len(cc.Parts) && starts[i] < end; i++ {
+		lo, hi := max(starts[i], off), min(starts[i+1], end)
+		if err := fn(cc.Parts[i], lo-starts[i], int(lo-off), int(hi-off)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (cc *ConcatContent) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("testutil.ConcatContent.ReadAt: negative offset")
+	}
+	size := cc.Size()
+	if off >= size {
+		return 0, io.EOF
+	}
+	n := int(min(int64(len(p)), size-off))
+	err := cc.each(off, n, func(part ContentAt, partOff int64, lo, hi int) error {
+		m, err := part.ReadAt(p[lo:hi], partOff)
+		if m == hi-lo {
+			return nil
+		}
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt implements io.WriterAt. Writes beyond the end of the contents
+// fail.
+func (cc *ConcatContent) WriteAt(p []byte, off int64) (int, error) {
+	if size := cc.Size(); off < 0 || off+int64(len(p)) > size {
+		return 0, fmt.Errorf("testutil.ConcatContent.WriteAt: write of %d bytes at offset %d is outside the contents of size %d",
+			len(p), off, size)
+	}
+	err := cc.each(off, len(p), func(part ContentAt, partOff int64, lo, hi int) error {
+		_, err := part.WriteAt(p[lo:hi], partOff)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Size implements ContentAt.
+func (cc *ConcatContent) Size() int64 {
+	var size int64
+	for _, part := range cc.Parts {
+		size += part.Size()
+	}
+	return size
+}
+
+// Checksum implements ContentAt. It is derived from the sizes and checksums
+// of the parts, and is empty if that of any part is.
+func (cc *ConcatContent) Checksum() string {
+	h := md5.New()
+	fmt.Fprintf(h, "ConcatContent")
+	for _, part := range cc.Parts {
+		sum := part.Checksum()
+		if sum == "" {
+			return ""
+		}
+		fmt.Fprintf(h, " %d %s", part.Size(), sum)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
@@ -0,0 +1,198 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package testutil_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil"
+	"github.com/grailbio/testutil/s3test"
+)
+
+// readAll reads all of c through its ReadAt method.
+func readAll(t *testing.T, c testutil.ContentAt) []byte {
+	data, err := ioutil.ReadAll(io.NewSectionReader(c, 0, c.Size()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// checkContent checks that c's contents are want and that reads of any
+// range agree with them.
+func checkContent(t *testing.T, c testutil.ContentAt, want []byte) {
+	t.Helper()
+	if got := readAll(t, c); !bytes.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for off := 0; off <= len(want); off += 7 {
+		p := make([]byte, 20)
+		n, err := c.ReadAt(p, int64(off))
+		wantN := len(want) - off
+		if wantN > len(p) {
+			wantN = len(p)
+		}
+		if n != wantN || !bytes.Equal(p[:n], want[off:off+n]) {
+			t.Errorf("ReadAt(%d): got %q, want %q", off, p[:n], want[off:off+wantN])
+		}
+		if n < len(p) && err != io.EOF {
+			t.Errorf("ReadAt(%d): got %v, want EOF", off, err)
+		}
+	}
+}
+
+// checkChecksums checks that the checksums of contents with the same
+// parameters, and only those, are equal.
+func checkChecksums(t *testing.T, same [2]testutil.ContentAt, others ...testutil.ContentAt) {
+	t.Helper()
+	sum := same[0].Checksum()
+	if len(sum) != 32 || same[1].Checksum() != sum {
+		t.Errorf("got checksums %q and %q for the same contents", sum, same[1].Checksum())
+	}
+	for _, c := range others {
+		if c.Checksum() == sum {
+			t.Errorf("%v has the same checksum as %v", c, same[0])
+		}
+	}
+}
+
+func TestRandomContent(t *testing.T) {
+	a := &testutil.RandomContent{Seed: 1, SizeInBytes: 1000}
+	data := readAll(t, a)
+	checkContent(t, a, data)
+	if bytes.Equal(data[:100], make([]byte, 100)) {
+		t.Error("random content is zero")
+	}
+	if b := readAll(t, &testutil.RandomContent{Seed: 2, SizeInBytes: 1000}); bytes.Equal(data, b) {
+		t.Error("different seeds generated the same content")
+	}
+	checkChecksums(t, [2]testutil.ContentAt{a, &testutil.RandomContent{Seed: 1, SizeInBytes: 1000}},
+		&testutil.RandomContent{Seed: 2, SizeInBytes: 1000},
+		&testutil.RandomContent{Seed: 1, SizeInBytes: 999},
+		&testutil.OffsetContent{SizeInBytes: 1000})
+	if n, err := a.WriteAt(data[10:20], 10); n != 10 || err != nil {
+		t.Errorf("got %v, %v", n, err)
+	}
+	if _, err := a.WriteAt([]byte("x"), 999); err == nil {
+		t.Error("expected a mismatch error")
+	}
+	if _, err := a.WriteAt([]byte("xx"), 999); err == nil {
+		t.Error("expected an error for a write beyond the end")
+	}
+
+	// Huge contents can be read anywhere without allocating them.
+	huge := &testutil.RandomContent{Seed: 1, SizeInBytes: 5 << 40}
+	p := make([]byte, 10)
+	if n, err := huge.ReadAt(p, huge.Size()-5); n != 5 || err != io.EOF {
+		t.Errorf("got %v, %v", n, err)
+	}
+}
+
+func TestOffsetContent(t *testing.T) {
+	c := &testutil.OffsetContent{SizeInBytes: 40}
+	checkContent(t, c, []byte("000000000000000\n000000000000010\n00000000"))
+	p := make([]byte, 16)
+	if _, err := (&testutil.OffsetContent{SizeInBytes: 1 << 40}).ReadAt(p, 0xabcdef0); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(p), "00000000abcdef0\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := c.WriteAt([]byte("000000000000010\n"), 0); err == nil {
+		t.Error("expected a mismatch error")
+	}
+	checkChecksums(t, [2]testutil.ContentAt{c, &testutil.OffsetContent{SizeInBytes: 40}},
+		&testutil.OffsetContent{SizeInBytes: 41})
+}
+
+func TestSparseContent(t *testing.T) {
+	c := &testutil.SparseContent{
+		SizeInBytes: 20,
+		Extents:     []testutil.Extent{{Offset: 2, Data: []byte("abcdef")}, {Offset: 4, Data: []byte("XY")}},
+	}
+	checkContent(t, c, []byte("\x00\x00abXYef\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"))
+	sum := c.Checksum()
+	if _, err := c.WriteAt([]byte("tail"), 22); err != nil {
+		t.Fatal(err)
+	}
+	checkContent(t, c, []byte("\x00\x00abXYef\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00tail"))
+	if c.Checksum() == sum {
+		t.Error("the checksum did not change when the contents did")
+	}
+}
+
+func TestConcatContent(t *testing.T) {
+	first := &testutil.ByteContent{Data: []byte("hello, ")}
+	c := testutil.Concat(first, &testutil.ByteContent{}, &testutil.FakeContentAt{SizeInBytes: 30})
+	want := []byte("hello, abcdefghijklmnopqrstuvwxyzabcd")
+	checkContent(t, c, want)
+	sum := c.Checksum()
+	if _, err := c.WriteAt([]byte("J"), 0); err != nil {
+		t.Fatal(err)
+	}
+	want[0] = 'J'
+	checkContent(t, c, want)
+	if c.Checksum() == sum {
+		t.Error("the checksum did not change when the contents did")
+	}
+	if _, err := c.WriteAt([]byte("x"), int64(len(want))); err == nil {
+		t.Error("expected an error for a write beyond the end")
+	}
+}
+
+func TestFakeContentAtChecksum(t *testing.T) {
+	c := &testutil.FakeContentAt{SizeInBytes: 100}
+	checkChecksums(t, [2]testutil.ContentAt{c, &testutil.FakeContentAt{SizeInBytes: 100}},
+		&testutil.FakeContentAt{SizeInBytes: 101})
+	if _, err := c.Seek(0, 42); err == nil {
+		t.Error("expected an error for an invalid whence")
+	}
+	if _, err := c.Seek(-1, io.SeekStart); err == nil {
+		t.Error("expected an error for a negative position")
+	}
+}
+
+func TestGeneratedContentS3(t *testing.T) {
+	client := s3test.NewClient(t, "bucket")
+	content := &testutil.RandomContent{Seed: 42, SizeInBytes: 1 << 20}
+	client.SetFileContentAt("random", content, "")
+	out, err := client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("random"),
+		Range:  aws.String("bytes=1000-1999"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := readAll(t, content)[1000:2000]; !bytes.Equal(got, want) {
+		t.Error("ranged read differs from the generated content")
+	}
+	if got, want := aws.StringValue(out.ETag), content.Checksum(); got != want {
+		t.Errorf("got ETag %v, want %v", got, want)
+	}
+}
+
+func TestChecksumUnavailable(t *testing.T) {
+	disk := testutil.NewDiskContent(t, "")
+	if _, err := disk.WriteAt([]byte("def"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := disk.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c := testutil.Concat(&testutil.ByteContent{Data: []byte("abc")}, disk)
+	if got := c.Checksum(); got != "" {
+		t.Errorf("got checksum %q for contents without a checksum, want \"\"", got)
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package testutil
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/grailbio/testutil/assert"
+)
+
+// BuildOption configures how GoExecutableOpts builds an executable.
+type BuildOption func(*buildConfig)
+
+type buildConfig struct {
+	race     bool
+	cover    bool
+	coverPkg []string
+	tags     []string
+	ldflags  string
+	env      []string
+}
+
+// Race builds the executable with the race detector (-race).
+func Race() BuildOption {
+	return func(c *buildConfig) { c.race = true }
+}
+
+// Cover builds the executable with coverage instrumentation (-cover), of
+// the given packages (-coverpkg) if any. The executable writes its
+// coverage data to $GOCOVERDIR when it exits, so run it with GOCOVERDIR
+// set to GoCoverDir(t) to have its coverage included in that of the test.
+// Cover requires Go 1.20 or later.
+func Cover(pkgs ...string) BuildOption {
+	return func(c *buildConfig) {
+		c.cover = true
+		c.coverPkg = append(c.coverPkg, pkgs...)
+	}
+}
+
+// Tags builds the executable with the given build tags (-tags).
+func Tags(tags ...string) BuildOption {
+	return func(c *buildConfig) { c.tags = append(c.tags, tags...) }
+}
+
+// Ldflags builds the executable with the given linker flags (-ldflags),
+// e.g., "-X main.version=test".
+func Ldflags(flags string) BuildOption {
+	return func(c *buildConfig) { c.ldflags = flags }
+}
+
+// BuildEnv runs go build with the environment env, rather than that of
+// the test, as exec.Cmd.Env does.
+func BuildEnv(env []string) BuildOption {
+	return func(c *buildConfig) { c.env = env }
+}
+
+// args returns the arguments to go build for the configuration.
+func (c *buildConfig) args() []string {
+	var args []string
+	if c.race {
+		args = append(args, "-race")
+	}
+	if c.cover {
+		args = append(args, "-cover")
+		if mode := testing.CoverMode(); mode != "" {
+			args = append(args, "-covermode="+mode)
+		}
+		if len(c.coverPkg) > 0 {
+			args = append(args, "-coverpkg="+strings.Join(c.coverPkg, ","))
+		}
+	}
+	if len(c.tags) > 0 {
+		args = append(args, "-tags="+strings.Join(c.tags, ","))
+	}
+	if c.ldflags != "" {
+		args = append(args, "-ldflags="+c.ldflags)
+	}
+	return args
+}
+
+// goBuild is an executable built, or being built, by GoExecutableOpts.
+type goBuild struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+var (
+	goBuildsMu sync.Mutex
+	goBuilds   = map[string]*goBuild{}
+)
+
+// GoExecutableOpts is like GoExecutable, but builds the executable, when
+// not running under Bazel, with the given options, which are otherwise
+// ignored. Besides the "//path/package/binary" form of GoExecutable,
+// paths outside the "//go/src/" convention are supported when not under
+// Bazel:
+//
+//	"//go/src/github.com/org/repo/cmd/tool/tool"  the package github.com/org/repo/cmd/tool
+//	"//cmd/tool/tool"                             the directory cmd/tool of the current module, if any
+//	"github.com/org/repo/cmd/tool"                the package with this import path
+//	"./cmd/tool"                                  the package in this directory
+//
+// Each executable is built once per process, and the builds are keyed by
+// package, options and environment, so that different configurations do
+// not overwrite one another. Builds of the same executable by concurrent
+// test processes are serialized with a file lock, and replace the
+// executable atomically, so that a process may run it while another
+// rebuilds it.
+func GoExecutableOpts(t testing.TB, path string, opts ...BuildOption) string {
+	t.Helper()
+	var config buildConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if !strings.HasPrefix(path, "//") && !strings.HasPrefix(path, "@") {
+		if IsBazel() {
+			t.Fatalf("%v: path must be of format \"//path/package/binary\" under bazel", path)
+		}
+		wd, err := os.Getwd()
+		if err != nil {
+			t.Fatalf("could not obtain current directory: %v", err)
+		}
+		return buildGo(t, wd, path, filepath.Base(path), &config)
+	}
+
+	re := regexp.MustCompile("^(@[^@/]+)?//(.*/([^/]+))/([^/]+)$")
+	match := re.FindStringSubmatch(path)
+	// staticcheck doesn't realize that t.Fatalf stops execution.
+	if match == nil { //nolint:staticcheck
+		t.Fatalf("%v: path must be of format \"//path/package/binary\"",
+			path)
+	}
+	workspace, pkg, pkgName, binary := match[1], match[2], match[3], match[4] //nolint:staticcheck
+
+	if IsBazel() {
+		expandedPath := GetFilePath(path)
+		if _, err := os.Stat(expandedPath); err == nil {
+			return expandedPath
+		}
+		pattern := GetFilePath(fmt.Sprintf("%s//%s/*/%s", workspace, pkg, binary))
+		paths, err := filepath.Glob(pattern)
+		assert.NoError(t, err, "glob %v", pattern)
+		assert.EQ(t, len(paths), 1, "Pattern %s must match exactly one executable, but found %v", pattern, paths)
+		return paths[0]
+	}
+
+	if workspace != "" {
+		t.Fatalf("%v: workspace can not be set when not under bazel", path)
+	}
+	if pkgName != binary {
+		t.Fatalf("%v: package name and binary must match", path)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("could not obtain current directory: %v", err)
+	}
+	dir := wd
+	if strings.HasPrefix(pkg, "go/src/") {
+		pkg = strings.TrimPrefix(pkg, "go/src/")
+	} else if root, err := ModuleRoot(wd); err == nil {
+		if info, err := os.Stat(filepath.Join(root, pkg)); err == nil && info.IsDir() {
+			dir, pkg = root, "./"+pkg
+		}
+	}
+	return buildGo(t, dir, pkg, binary, &config)
+}
+
+// buildGo builds the package pkg, relative to dir, with config, once per
+// process and configuration, and returns the path of the executable.
+func buildGo(t testing.TB, dir, pkg, binary string, config *buildConfig) string {
+	t.Helper()
+	args := config.args()
+	env := config.env
+	if env != nil {
+		env = append([]string(nil), env...)
+		sort.Strings(env)
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %q %q %q %v", dir, pkg, args, env, env == nil)
+	key := fmt.Sprintf("%x", h.Sum(nil)[:16])
+
+	goBuildsMu.Lock()
+	b, ok := goBuilds[key]
+	if !ok {
+		b = new(goBuild)
+		goBuilds[key] = b
+	}
+	goBuildsMu.Unlock()
+	b.once.Do(func() {
+		b.path, b.err = runGoBuild(key, dir, pkg, binary, args, config.env)
+	})
+	if b.err != nil {
+		t.Fatalf("%v", b.err)
+	}
+	return b.path
+}
+
+// runGoBuild runs go build, holding a lock on its output directory. The
+// executable is built under a temporary name and renamed into place, so
+// that processes running an executable built earlier are not affected.
+func runGoBuild(key, dir, pkg, binary string, args, env []string) (string, error) {
+	tempDir := filepath.Join(os.TempDir(), "go_build", key)
+	if err := os.MkdirAll(tempDir, 0700); err != nil {
+		return "", err
+	}
+	lock, err := os.OpenFile(filepath.Join(tempDir, "lock"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer lock.Close() // nolint: errcheck
+	if err := lockFile(lock); err != nil {
+		return "", fmt.Errorf("locking %v: %v", lock.Name(), err)
+	}
+	defer unlockFile(lock) // nolint: errcheck
+
+	tmp, err := ioutil.TempFile(tempDir, binary+".tmp")
+	if err != nil {
+		return "", err
+	}
+	tmpPath := tmp.Name()
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpPath) // nolint: errcheck
+	cmd := exec.Command("go", append(append([]string{"build", "-o", tmpPath}, args...), pkg)...)
+	cmd.Dir = dir
+	cmd.Env = env
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("go build %s %s: %v\n%s", strings.Join(args, " "), pkg, err, string(output))
+	}
+	xpath := filepath.Join(tempDir, binary)
+	if err := os.Rename(tmpPath, xpath); err != nil {
+		return "", err
+	}
+	return xpath, nil
+}
+
+// GoCoverDir returns the directory to which executables built with Cover
+// should write their coverage data, by running them with GOCOVERDIR set to
+// it. If the test is run with coverage enabled by go test (Go 1.20 or
+// later), this is the directory that go test merges into the test's
+// coverage profile; otherwise it is $GOCOVERDIR if set, or a new temporary
+// directory (see NewTempDir).
+func GoCoverDir(t testing.TB) string {
+	t.Helper()
+	if f := flag.Lookup("test.gocoverdir"); f != nil && f.Value.String() != "" {
+		return f.Value.String()
+	}
+	if dir := os.Getenv("GOCOVERDIR"); dir != "" {
+		return dir
+	}
+	return NewTempDir(t, "", "gocoverdir-")
+}
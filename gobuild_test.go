@@ -0,0 +1,210 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package testutil_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/grailbio/testutil"
+)
+
+const toolMain = `package main
+
+import "fmt"
+
+var version = "none"
+
+func main() { fmt.Println(version, tagged) }
+`
+
+const toolTagged = `// +build extra
+
+package main
+
+const tagged = true
+`
+
+const toolUntagged = `// +build !extra
+
+package main
+
+const tagged = false
+`
+
+// toolModule creates a module with a command in cmd/tool and makes it the
+// working directory. It returns a function that restores the working
+// directory.
+func toolModule(t *testing.T) func() {
+	if testutil.IsBazel() {
+		t.Skip("executables are not built under bazel")
+	}
+	root := testutil.NewTempDir(t, "", "gobuild-")
+	for name, contents := range map[string]string{
+		"go.mod":                  "module example.com/tool\n\ngo 1.13\n",
+		"cmd/tool/main.go":        toolMain,
+		"cmd/tool/tagged.go":      toolTagged,
+		"cmd/tool/untagged.go":    toolUntagged,
+		"cmd/broken/broken.go":    "package main\n\nfunc main() { undefined() }\n",
+		"cmd/tool/testdata/empty": "",
+	} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	return func() { os.Chdir(wd) } // nolint: errcheck
+}
+
+// goexitTB records the messages passed to Fatalf, which, like that of
+// testing.TB, stops the calling goroutine.
+type goexitTB struct {
+	testing.TB
+	fatal []string
+}
+
+func (g *goexitTB) Fatalf(format string, args ...interface{}) {
+	g.fatal = append(g.fatal, fmt.Sprintf(format, args...))
+	runtime.Goexit()
+}
+
+// buildFailures calls fn in a new goroutine and returns the messages that
+// it passed to Fatalf.
+func buildFailures(t *testing.T, fn func(t testing.TB)) []string {
+	tb := &goexitTB{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(tb)
+	}()
+	<-done
+	return tb.fatal
+}
+
+func runTool(t *testing.T, path string, env ...string) string {
+	t.Helper()
+	cmd := exec.Command(path)
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %v\n%s", path, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestGoExecutableOpts(t *testing.T) {
+	defer toolModule(t)()
+	plain := testutil.GoExecutableOpts(t, "//cmd/tool/tool")
+	if got, want := runTool(t, plain), "none false"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// The executable was built under a temporary name, which is gone.
+	if files, err := ioutil.ReadDir(filepath.Dir(plain)); err != nil || len(files) != 2 {
+		t.Errorf("%v: got %v, %v, want the executable and its lock", filepath.Dir(plain), files, err)
+	}
+	if got := testutil.GoExecutable(t, "//cmd/tool/tool"); got != plain {
+		t.Errorf("GoExecutable: got %v, want the cached %v", got, plain)
+	}
+	if got := testutil.GoExecutableOpts(t, "./cmd/tool"); got != plain {
+		t.Errorf("./cmd/tool: got %v, want the executable built for //cmd/tool/tool, %v", got, plain)
+	}
+
+	built := testutil.GoExecutableOpts(t, "example.com/tool/cmd/tool",
+		testutil.Tags("extra"), testutil.Ldflags("-X main.version=v1"))
+	if built == plain {
+		t.Errorf("builds with different options share %v", built)
+	}
+	if got, want := runTool(t, built), "v1 true"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := runTool(t, plain), "none false"; got != want {
+		t.Errorf("got %q after another build, want %q", got, want)
+	}
+}
+
+func TestGoExecutableOptsConcurrent(t *testing.T) {
+	defer toolModule(t)()
+	var (
+		wg    sync.WaitGroup
+		paths = make([]string, 8)
+	)
+	for i := range paths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			paths[i] = testutil.GoExecutableOpts(t, "//cmd/tool/tool", testutil.Ldflags("-X main.version=concurrent"))
+		}(i)
+	}
+	wg.Wait()
+	for _, path := range paths {
+		if path != paths[0] {
+			t.Fatalf("got paths %v, want a single executable", paths)
+		}
+	}
+	if got, want := runTool(t, paths[0]), "concurrent false"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestGoExecutableOptsRaceAndCover(t *testing.T) {
+	defer toolModule(t)()
+	if out, err := exec.Command("go", "env", "CGO_ENABLED").Output(); err != nil || strings.TrimSpace(string(out)) != "1" {
+		t.Skip("the race detector requires cgo")
+	}
+	race := testutil.GoExecutableOpts(t, "//cmd/tool/tool", testutil.Race())
+	if got, want := runTool(t, race), "none false"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	covered := testutil.GoExecutableOpts(t, "//cmd/tool/tool", testutil.Cover())
+	dir := testutil.GoCoverDir(t)
+	before, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runTool(t, covered, "GOCOVERDIR="+dir)
+	after, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) <= len(before) {
+		t.Errorf("no coverage data was written to %v", dir)
+	}
+}
+
+func TestGoExecutableOptsErrors(t *testing.T) {
+	defer toolModule(t)()
+	for _, test := range []struct {
+		path string
+		want string
+	}{
+		{"//cmd/broken/broken", "undefined"},
+		{"//cmd/tool/other", "package name and binary must match"},
+		{"@ws//cmd/tool/tool", "workspace can not be set when not under bazel"},
+		{"//tool", "path must be of format"},
+	} {
+		fatal := buildFailures(t, func(t testing.TB) { testutil.GoExecutableOpts(t, test.path) })
+		if len(fatal) != 1 || !strings.Contains(fatal[0], test.want) {
+			t.Errorf("%v: got %q, want an error containing %q", test.path, fatal, test.want)
+		}
+	}
+}
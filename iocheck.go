@@ -0,0 +1,258 @@
+package testutil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// This file implements checks of io implementations against the contracts
+// documented by package io. Each check reports at most one failure per
+// property, using the smallest failing example it finds.
+
+// ioProbes returns the lengths or offsets to probe for contents of the
+// given size: all of them for small contents, and those near the start and
+// the end of the contents otherwise. Probes are in increasing order and
+// extend slightly beyond size.
+func ioProbes(size int) []int {
+	const edge = 64
+	var probes []int
+	for i := 0; i <= size+2; i++ {
+		if i < edge || i >= size-edge {
+			probes = append(probes, i)
+		}
+	}
+	return probes
+}
+
+// CheckReaderAt verifies that r, whose contents are want, implements
+// io.ReaderAt: every read returns the requested data, a read that returns
+// fewer bytes than requested returns an error (io.EOF at the end of the
+// contents), reads at negative offsets fail, and concurrent reads are
+// safe (run the test with -race).
+func CheckReaderAt(t testing.TB, r io.ReaderAt, want []byte) {
+	t.Helper()
+	size := len(want)
+	describe := func(n, off int) string {
+		return fmt.Sprintf("ReadAt(len(p)=%d, off=%d) on %d bytes", n, off, size)
+	}
+	func() {
+		for _, n := range ioProbes(size) {
+			for _, off := range ioProbes(size) {
+				p := make([]byte, n)
+				got, err := r.ReadAt(p, int64(off))
+				wantN := 0
+				if off < size {
+					wantN = int(min(int64(n), int64(size-off)))
+				}
+				switch {
+				case got != wantN:
+					t.Errorf("%s = %d, %v; want %d bytes", describe(n, off), got, err, wantN)
+					return
+				case got > 0 && !bytes.Equal(p[:got], want[off:off+got]):
+					t.Errorf("%s read %q; want %q", describe(n, off), p[:got], want[off:off+got])
+					return
+				case got < n && err == nil:
+					t.Errorf("%s = %d, nil; want a non-nil error (io.EOF) for a short read", describe(n, off), got)
+					return
+				case got < n && err != io.EOF:
+					t.Errorf("%s = %d, %v; want io.EOF at the end of the contents", describe(n, off), got, err)
+					return
+				case got == n && err != nil && (err != io.EOF || off+got < size):
+					t.Errorf("%s = %d, %v; want a nil error", describe(n, off), got, err)
+					return
+				}
+			}
+		}
+	}()
+	if _, err := r.ReadAt(make([]byte, 1), -1); err == nil {
+		t.Errorf("ReadAt(len(p)=1, off=-1) on %d bytes: want an error for a negative offset", size)
+	}
+	checkConcurrentReads(t, r, want)
+}
+
+// checkConcurrentReads verifies that concurrent reads of r return want.
+func checkConcurrentReads(t testing.TB, r io.ReaderAt, want []byte) {
+	t.Helper()
+	if len(want) == 0 {
+		return
+	}
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed string
+	)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for i := 0; i < 100; i++ {
+				off := rnd.Intn(len(want))
+				p := make([]byte, 1+rnd.Intn(len(want)-off))
+				if n, err := r.ReadAt(p, int64(off)); n != len(p) || (err != nil && err != io.EOF) || !bytes.Equal(p, want[off:off+len(p)]) {
+					mu.Lock()
+					if failed == "" {
+						failed = fmt.Sprintf("concurrent ReadAt(len(p)=%d, off=%d) on %d bytes = %d, %v; want %q",
+							len(p), off, len(want), n, err, want[off:off+len(p)])
+					}
+					mu.Unlock()
+					return
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+	if failed != "" {
+		t.Errorf("%s", failed)
+	}
+}
+
+// CheckReadSeeker verifies that s, whose contents are want, implements
+// io.Seeker: Seek computes offsets relative to the start, the current
+// offset and the end according to whence, returns the new offset, rejects
+// invalid whence values and negative offsets, and allows seeking beyond the
+// end, where Read returns io.EOF; and that Read then reads from the new
+// offset.
+func CheckReadSeeker(t testing.TB, s io.ReadSeeker, want []byte) {
+	t.Helper()
+	size := int64(len(want))
+	seek := func(offset int64, whence int, wantPos int64) bool {
+		pos, err := s.Seek(offset, whence)
+		if err != nil || pos != wantPos {
+			t.Errorf("Seek(%d, %d) on %d bytes = %d, %v; want %d, nil", offset, whence, size, pos, err, wantPos)
+			return false
+		}
+		p := make([]byte, 1)
+		n, err := io.ReadFull(s, p)
+		switch {
+		case wantPos >= size && (n != 0 || err != io.EOF):
+			t.Errorf("Read after Seek(%d, %d) to %d on %d bytes = %d, %v; want 0, io.EOF", offset, whence, wantPos, size, n, err)
+			return false
+		case wantPos < size && (n != 1 || err != nil || p[0] != want[wantPos]):
+			t.Errorf("Read after Seek(%d, %d) to %d on %d bytes = %q, %v; want %q", offset, whence, wantPos, size, p[:n], err, want[wantPos:wantPos+1])
+			return false
+		}
+		return true
+	}
+	for _, pos := range ioProbes(len(want)) {
+		off := int64(pos)
+		if !seek(off, io.SeekStart, off) || !seek(off-size, io.SeekEnd, off) {
+			return
+		}
+		// The Read above advanced the offset by one byte, if not at the end.
+		cur := off
+		if off < size {
+			cur++
+		}
+		if cur > 0 && !seek(-1, io.SeekCurrent, cur-1) {
+			return
+		}
+	}
+	if _, err := s.Seek(0, io.SeekStart); err != nil {
+		t.Errorf("Seek(0, io.SeekStart) = %v", err)
+		return
+	}
+	for _, bad := range []struct {
+		offset int64
+		whence int
+	}{{-1, io.SeekStart}, {-size - 1, io.SeekEnd}, {-1, io.SeekCurrent}, {0, 3}, {0, -1}} {
+		if _, err := s.Seek(bad.offset, bad.whence); err == nil {
+			t.Errorf("Seek(%d, %d) on %d bytes at offset 0: want an error", bad.offset, bad.whence, size)
+			return
+		}
+	}
+}
+
+// CheckWriterAt verifies that the io.WriterAt returned by newWriter, which
+// must be empty, implements io.WriterAt: writes return a non-nil error if
+// they write fewer bytes than given, may be made in any order, extend the
+// contents (zero-filling any gap), overwrite existing data, and may be made
+// concurrently to non-overlapping ranges; writes at negative offsets fail.
+// Contents returns the data written to a WriterAt returned by newWriter.
+func CheckWriterAt(t testing.TB, newWriter func() io.WriterAt, contents func(io.WriterAt) []byte) {
+	t.Helper()
+	type write struct {
+		off  int64
+		data string
+	}
+	for _, test := range []struct {
+		writes []write
+		want   string
+	}{
+		{[]write{{0, "abc"}, {3, "def"}}, "abcdef"},
+		{[]write{{3, "def"}, {0, "abc"}}, "abcdef"},
+		{[]write{{2, "c"}}, "\x00\x00c"},
+		{[]write{{0, "abcdef"}, {2, "XY"}}, "abXYef"},
+		{[]write{{0, "ab"}, {1, "XYZ"}}, "aXYZ"},
+		{[]write{{0, ""}}, ""},
+	} {
+		w := newWriter()
+		for _, wr := range test.writes {
+			if n, err := w.WriteAt([]byte(wr.data), wr.off); n != len(wr.data) || err != nil {
+				t.Errorf("writes %v: WriteAt(%q, %d) = %d, %v; want %d, nil", test.writes, wr.data, wr.off, n, err, len(wr.data))
+				return
+			}
+		}
+		if got := contents(w); string(got) != test.want {
+			t.Errorf("writes %v: got contents %q, want %q", test.writes, got, test.want)
+			return
+		}
+	}
+	if _, err := newWriter().WriteAt([]byte("a"), -1); err == nil {
+		t.Errorf("WriteAt(\"a\", -1): want an error for a negative offset")
+	}
+
+	const (
+		chunks    = 64
+		chunkSize = 1 << 10
+	)
+	want := make([]byte, chunks*chunkSize)
+	rand.New(rand.NewSource(0)).Read(want) // nolint: errcheck
+	w := newWriter()
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed string
+	)
+	for _, i := range rand.New(rand.NewSource(1)).Perm(chunks) {
+		wg.Add(1)
+		go func(off int) {
+			defer wg.Done()
+			if n, err := w.WriteAt(want[off:off+chunkSize], int64(off)); n != chunkSize || err != nil {
+				mu.Lock()
+				failed = fmt.Sprintf("concurrent WriteAt(len(p)=%d, off=%d) = %d, %v", chunkSize, off, n, err)
+				mu.Unlock()
+			}
+		}(i * chunkSize)
+	}
+	wg.Wait()
+	if failed != "" {
+		t.Errorf("%s", failed)
+	} else if got := contents(w); !bytes.Equal(got, want) {
+		t.Errorf("concurrent writes of %d chunks: contents differ", chunks)
+	}
+}
+
+// CheckContentAt verifies that c, whose contents are want, implements
+// ContentAt: its reads conform to io.ReaderAt (see CheckReaderAt), its size
+// is that of want, and its checksum is non-empty and not changed by reads.
+// The checksum need not be the MD5 of want: that of generated contents
+// (e.g., RandomContent) is derived from their parameters.
+func CheckContentAt(t testing.TB, c ContentAt, want []byte) {
+	t.Helper()
+	if got := c.Size(); got != int64(len(want)) {
+		t.Errorf("Size() = %d, want %d", got, len(want))
+	}
+	sum := c.Checksum()
+	if sum == "" {
+		t.Errorf("Checksum() is empty")
+	}
+	CheckReaderAt(t, c, want)
+	if got := c.Checksum(); got != sum {
+		t.Errorf("Checksum() = %v after reads, want %v", got, sum)
+	}
+}
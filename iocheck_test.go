@@ -0,0 +1,156 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package testutil_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/testutil"
+)
+
+// checkMD5 checks that the checksum of c, which stores its contents want, is
+// their MD5.
+func checkMD5(t *testing.T, c testutil.ContentAt, want []byte) {
+	t.Helper()
+	if got, want := c.Checksum(), fmt.Sprintf("%x", md5.Sum(want)); got != want {
+		t.Errorf("Checksum() = %v, want %v", got, want)
+	}
+}
+
+func TestCheckContentAt(t *testing.T) {
+	const size = 300
+	for _, test := range []struct {
+		name string
+		c    testutil.ContentAt
+	}{
+		{"ByteContent", &testutil.ByteContent{Data: []byte(strings.Repeat("0123456789", size/10))}},
+		{"EmptyByteContent", &testutil.ByteContent{}},
+		{"FakeContentAt", &testutil.FakeContentAt{SizeInBytes: size}},
+		{"RandomContent", &testutil.RandomContent{Seed: 1, SizeInBytes: size}},
+		{"OffsetContent", &testutil.OffsetContent{SizeInBytes: size}},
+		{"SparseContent", &testutil.SparseContent{SizeInBytes: size, Extents: []testutil.Extent{{Offset: 10, Data: []byte("data")}}}},
+		{"ConcatContent", testutil.Concat(&testutil.OffsetContent{SizeInBytes: 100}, &testutil.ByteContent{}, &testutil.RandomContent{SizeInBytes: 200})},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			want := readAll(t, test.c)
+			testutil.CheckContentAt(t, test.c, want)
+			if _, ok := test.c.(*testutil.ByteContent); ok {
+				checkMD5(t, test.c, want)
+			}
+		})
+	}
+	t.Run("DiskContent", func(t *testing.T) {
+		for _, c := range []*testutil.DiskContent{testutil.NewDiskContent(t, ""), testutil.NewMappedContent(t, "")} {
+			want := []byte(strings.Repeat("abc", size/3))
+			if _, err := c.WriteAt(want, 0); err != nil {
+				t.Fatal(err)
+			}
+			testutil.CheckContentAt(t, c, want)
+			checkMD5(t, c, want)
+		}
+	})
+}
+
+func TestCheckReadSeeker(t *testing.T) {
+	want := []byte(strings.Repeat("abcdefghijklmnopqrstuvwxyz", 10))
+	testutil.CheckReadSeeker(t, bytes.NewReader(want), want)
+	testutil.CheckReadSeeker(t, &testutil.FakeContentAt{SizeInBytes: int64(len(want))}, want)
+	testutil.CheckReadSeeker(t, bytes.NewReader(nil), nil)
+}
+
+func TestCheckWriterAt(t *testing.T) {
+	testutil.CheckWriterAt(t,
+		func() io.WriterAt { return &testutil.ByteContent{} },
+		func(w io.WriterAt) []byte { return w.(*testutil.ByteContent).Bytes() })
+	testutil.CheckWriterAt(t,
+		func() io.WriterAt { return &testutil.SparseContent{} },
+		func(w io.WriterAt) []byte { return readAll(t, w.(*testutil.SparseContent)) })
+	testutil.CheckWriterAt(t,
+		func() io.WriterAt { return testutil.NewDiskContent(t, "") },
+		func(w io.WriterAt) []byte { return readAll(t, w.(*testutil.DiskContent)) })
+}
+
+// shortReaderAt returns no error when it reads fewer bytes than requested,
+// as FakeContentAt once did.
+type shortReaderAt struct{ data []byte }
+
+func (r shortReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off > int64(len(r.data)) {
+		return 0, io.EOF
+	}
+	return copy(p, r.data[off:]), nil
+}
+
+// badSeeker accepts any whence, treating unknown values as io.SeekStart.
+type badSeeker struct{ *bytes.Reader }
+
+func (s badSeeker) Seek(offset int64, whence int) (int64, error) {
+	if whence < io.SeekStart || whence > io.SeekEnd {
+		whence = io.SeekStart
+	}
+	return s.Reader.Seek(offset, whence)
+}
+
+// truncatingWriterAt drops writes beyond its capacity without an error.
+type truncatingWriterAt struct{ buf []byte }
+
+func (w *truncatingWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	copy(w.buf[off:], p)
+	return len(p), nil
+}
+
+func TestCheckFailures(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		check func(t testing.TB)
+		want  string
+	}{
+		{
+			"ReaderAt",
+			func(t testing.TB) { testutil.CheckReaderAt(t, shortReaderAt{[]byte("abc")}, []byte("abc")) },
+			"ReadAt(len(p)=1, off=3) on 3 bytes = 0, nil; want a non-nil error (io.EOF) for a short read",
+		},
+		{
+			"ReadSeeker",
+			func(t testing.TB) {
+				testutil.CheckReadSeeker(t, badSeeker{bytes.NewReader([]byte("abc"))}, []byte("abc"))
+			},
+			"Seek(0, 3) on 3 bytes at offset 0: want an error",
+		},
+		{
+			"WriterAt",
+			func(t testing.TB) {
+				testutil.CheckWriterAt(t,
+					func() io.WriterAt { return &truncatingWriterAt{make([]byte, 4)} },
+					func(w io.WriterAt) []byte { return w.(*truncatingWriterAt).buf })
+			},
+			`writes [{0 abc} {3 def}]: got contents "abcd", want "abcdef"`,
+		},
+		{
+			"ContentAt",
+			func(t testing.TB) {
+				testutil.CheckContentAt(t, &testutil.FakeContentAt{SizeInBytes: 3}, []byte("abcd"))
+			},
+			"Size() = 3, want 4",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tb := &errorsTB{TB: t}
+			test.check(tb)
+			if len(tb.errors) == 0 || !strings.HasPrefix(tb.errors[0], test.want) {
+				t.Errorf("got errors %q, want first error %q", tb.errors, test.want)
+			}
+		})
+	}
+}
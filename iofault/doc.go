@@ -0,0 +1,16 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+// Package iofault provides io.Reader, io.ReaderAt, io.Writer, io.WriterAt
+// and testutil.ContentAt wrappers that inject faults: errors at a given
+// byte, short and one-byte transfers, bit flips, premature ends, data
+// returned together with io.EOF, and delays. Faults are deterministic: the
+// pseudo-random ones are derived from a seed, so a failing test can be
+// reproduced exactly.
+//
+// For example, to check that a parser reports truncated input:
+//
+//	r := iofault.NewReader(bytes.NewReader(data), iofault.UnexpectedEOFAt(100), iofault.OneByte())
+//	_, err := parse(r)
+package iofault
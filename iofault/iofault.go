@@ -0,0 +1,367 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package iofault
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/grailbio/testutil"
+)
+
+// ErrInjected is the error injected by FailAt and FailRandomly when they
+// are not given one.
+var ErrInjected = errors.New("iofault: injected error")
+
+// Option configures the faults injected by a wrapper.
+type Option func(*injector)
+
+// FailAt makes reads and writes fail with err (ErrInjected if nil) once
+// they reach byte offset n: the data before n is transferred, along with
+// the error, and every later access fails.
+func FailAt(n int64, err error) Option {
+	if err == nil {
+		err = ErrInjected
+	}
+	return func(in *injector) { in.failAt, in.failErr = n, err }
+}
+
+// UnexpectedEOFAt makes the data end prematurely at byte offset n: reads
+// of the data at or after n fail with io.ErrUnexpectedEOF.
+func UnexpectedEOFAt(n int64) Option {
+	return func(in *injector) { in.eofAt = n }
+}
+
+// FailRandomly makes each access fail, with probability rate, with
+// ErrInjected. The failures are determined by seed.
+func FailRandomly(seed int64, rate float64) Option {
+	return func(in *injector) {
+		in.seed(seed)
+		in.failRate = rate
+	}
+}
+
+// ShortTransfers makes each access transfer a pseudo-random number of
+// bytes between 1 and the number requested, determined by seed. Short
+// writes return io.ErrShortWrite; short reads return no error, even through
+// io.ReaderAt, whose contract forbids them.
+func ShortTransfers(seed int64) Option {
+	return func(in *injector) {
+		in.seed(seed)
+		in.short = true
+	}
+}
+
+// OneByte makes each access transfer at most one byte. As for
+// ShortTransfers, short writes return io.ErrShortWrite.
+func OneByte() Option {
+	return func(in *injector) { in.oneByte = true }
+}
+
+// FlipBit inverts the given bit (0 is the least significant) of the byte
+// at offset off, whether it is read or written.
+func FlipBit(off int64, bit uint) Option {
+	return func(in *injector) {
+		if in.flips == nil {
+			in.flips = make(map[int64]byte)
+		}
+		in.flips[off] ^= 1 << (bit % 8)
+	}
+}
+
+// EOFWithData makes the read that returns the last bytes of the data also
+// return io.EOF, rather than leaving it to the next read, as io.Reader and
+// io.ReaderAt permit.
+func EOFWithData() Option {
+	return func(in *injector) { in.eofWithData = true }
+}
+
+// Delay makes each access sleep for d before proceeding.
+func Delay(d time.Duration) Option {
+	return func(in *injector) { in.delay = d }
+}
+
+// injector implements the faults common to all wrappers.
+type injector struct {
+	failAt      int64
+	failErr     error
+	eofAt       int64
+	failRate    float64
+	short       bool
+	oneByte     bool
+	flips       map[int64]byte
+	eofWithData bool
+	delay       time.Duration
+
+	mu  sync.Mutex // guards rng
+	rng *rand.Rand
+}
+
+func newInjector(opts []Option) *injector {
+	in := &injector{failAt: -1, eofAt: -1}
+	for _, opt := range opts {
+		opt(in)
+	}
+	return in
+}
+
+func (in *injector) seed(seed int64) {
+	if in.rng == nil {
+		in.rng = rand.New(rand.NewSource(seed))
+	}
+}
+
+// plan returns the number of bytes, at most n, to transfer at offset off,
+// and the error to return if fewer than n bytes are transferred. It
+// returns 0 and an error if the access must fail immediately.
+func (in *injector) plan(off int64, n int, read bool) (int, error) {
+	if in.delay > 0 {
+		time.Sleep(in.delay)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	var err error
+	if in.rng != nil {
+		in.mu.Lock()
+		fail := in.failRate > 0 && in.rng.Float64() < in.failRate
+		if !fail && in.short {
+			n = 1 + in.rng.Intn(n)
+		}
+		in.mu.Unlock()
+		if fail {
+			return 0, ErrInjected
+		}
+	}
+	if in.oneByte && n > 1 {
+		n = 1
+	}
+	limit := func(at int64, atErr error) {
+		if at >= 0 && off+int64(n) > at {
+			if off >= at {
+				n = 0
+			} else {
+				n = int(at - off)
+			}
+			err = atErr
+		}
+	}
+	limit(in.failAt, in.failErr)
+	if read {
+		limit(in.eofAt, io.ErrUnexpectedEOF)
+	}
+	return n, err
+}
+
+// flip applies the bit flips to p, which holds the data at offset off.
+func (in *injector) flip(p []byte, off int64) {
+	for at, mask := range in.flips {
+		if at >= off && at < off+int64(len(p)) {
+			p[at-off] ^= mask
+		}
+	}
+}
+
+// readAt reads into p from offset off with read, which reads at most
+// len(p) bytes at the given offset, injecting faults.
+func (in *injector) readAt(p []byte, off int64, read func(p []byte, off int64) (int, error)) (int, error) {
+	n, planErr := in.plan(off, len(p), true)
+	if n == 0 && planErr != nil {
+		return 0, planErr
+	}
+	n, err := read(p[:n], off)
+	in.flip(p[:n], off)
+	if err == nil && in.eofWithData && n > 0 {
+		// Probe for the end of the data.
+		var probe [1]byte
+		if m, perr := read(probe[:], off+int64(n)); m == 0 && perr == io.EOF {
+			err = io.EOF
+		}
+	}
+	if err == nil && planErr != nil {
+		// The plan truncated the read, which fails at the fault.
+		err = planErr
+	}
+	return n, err
+}
+
+// writeAt writes p at offset off with write, injecting faults.
+func (in *injector) writeAt(p []byte, off int64, write func(p []byte, off int64) (int, error)) (int, error) {
+	n, err := in.plan(off, len(p), false)
+	if n == 0 && err != nil {
+		return 0, err
+	}
+	buf := p[:n]
+	if len(in.flips) > 0 {
+		buf = append([]byte(nil), buf...)
+		in.flip(buf, off)
+	}
+	m, werr := write(buf, off)
+	if werr != nil {
+		return m, werr
+	}
+	if m < len(p) {
+		if err == nil {
+			err = io.ErrShortWrite
+		}
+		return m, err
+	}
+	return m, nil
+}
+
+// Reader wraps an io.Reader and injects faults.
+type Reader struct {
+	r   io.Reader
+	in  *injector
+	pos int64
+	// pending holds a byte read ahead of the caller, by EOFWithData.
+	pending []byte
+	err     error
+}
+
+// NewReader returns a Reader that reads from r with the given faults.
+// Offsets are counted from the first byte read.
+func NewReader(r io.Reader, opts ...Option) *Reader {
+	return &Reader{r: r, in: newInjector(opts)}
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.in.readAt(p, r.pos, func(p []byte, off int64) (int, error) {
+		if off != r.pos {
+			// The probe of EOFWithData reads ahead.
+			return r.readAhead(p)
+		}
+		return r.read(p)
+	})
+	r.pos += int64(n)
+	return n, err
+}
+
+// read reads from the underlying reader, after any byte read ahead.
+func (r *Reader) read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	if n == len(p) {
+		return n, nil
+	}
+	if r.err != nil {
+		if n > 0 {
+			return n, nil
+		}
+		return 0, r.err
+	}
+	m, err := r.r.Read(p[n:])
+	return n + m, err
+}
+
+// readAhead reads a byte ahead of the caller, keeping it for the next read.
+func (r *Reader) readAhead(p []byte) (int, error) {
+	if len(r.pending) > 0 {
+		return 1, nil
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	var b [1]byte
+	for {
+		n, err := r.r.Read(b[:])
+		if n > 0 {
+			r.pending = append(r.pending, b[0])
+			r.err = err
+			return n, nil
+		}
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+	}
+}
+
+// ReaderAt wraps an io.ReaderAt and injects faults.
+type ReaderAt struct {
+	r  io.ReaderAt
+	in *injector
+}
+
+// NewReaderAt returns a ReaderAt that reads from r with the given faults.
+func NewReaderAt(r io.ReaderAt, opts ...Option) *ReaderAt {
+	return &ReaderAt{r: r, in: newInjector(opts)}
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return r.in.readAt(p, off, r.r.ReadAt)
+}
+
+// Writer wraps an io.Writer and injects faults.
+type Writer struct {
+	w   io.Writer
+	in  *injector
+	pos int64
+}
+
+// NewWriter returns a Writer that writes to w with the given faults.
+// Offsets are counted from the first byte written.
+func NewWriter(w io.Writer, opts ...Option) *Writer {
+	return &Writer{w: w, in: newInjector(opts)}
+}
+
+// Write implements io.Writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	n, err := w.in.writeAt(p, w.pos, func(p []byte, _ int64) (int, error) { return w.w.Write(p) })
+	w.pos += int64(n)
+	return n, err
+}
+
+// WriterAt wraps an io.WriterAt and injects faults.
+type WriterAt struct {
+	w  io.WriterAt
+	in *injector
+}
+
+// NewWriterAt returns a WriterAt that writes to w with the given faults.
+func NewWriterAt(w io.WriterAt, opts ...Option) *WriterAt {
+	return &WriterAt{w: w, in: newInjector(opts)}
+}
+
+// WriteAt implements io.WriterAt.
+func (w *WriterAt) WriteAt(p []byte, off int64) (int, error) {
+	return w.in.writeAt(p, off, w.w.WriteAt)
+}
+
+// ContentAt wraps a testutil.ContentAt and injects faults into its reads
+// and writes. Size and Checksum report those of the wrapped content.
+type ContentAt struct {
+	c  testutil.ContentAt
+	in *injector
+}
+
+// NewContentAt returns a ContentAt that wraps c with the given faults.
+func NewContentAt(c testutil.ContentAt, opts ...Option) *ContentAt {
+	return &ContentAt{c: c, in: newInjector(opts)}
+}
+
+// ReadAt implements io.ReaderAt.
+func (c *ContentAt) ReadAt(p []byte, off int64) (int, error) {
+	return c.in.readAt(p, off, c.c.ReadAt)
+}
+
+// WriteAt implements io.WriterAt.
+func (c *ContentAt) WriteAt(p []byte, off int64) (int, error) {
+	return c.in.writeAt(p, off, c.c.WriteAt)
+}
+
+// Size implements testutil.ContentAt.
+func (c *ContentAt) Size() int64 { return c.c.Size() }
+
+// Checksum implements testutil.ContentAt.
+func (c *ContentAt) Checksum() string { return c.c.Checksum() }
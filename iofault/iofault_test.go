@@ -0,0 +1,150 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package iofault_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil"
+	"github.com/grailbio/testutil/expect"
+	"github.com/grailbio/testutil/iofault"
+	"github.com/grailbio/testutil/s3test"
+)
+
+var data = []byte("abcdefghijklmnopqrstuvwxyz")
+
+func TestReaderFailAt(t *testing.T) {
+	errBoom := errors.New("boom")
+	got, err := ioutil.ReadAll(iofault.NewReader(bytes.NewReader(data), iofault.FailAt(10, errBoom)))
+	expect.EQ(t, err, errBoom)
+	expect.EQ(t, string(got), "abcdefghij")
+
+	got, err = ioutil.ReadAll(iofault.NewReader(bytes.NewReader(data), iofault.UnexpectedEOFAt(3)))
+	expect.EQ(t, err, io.ErrUnexpectedEOF)
+	expect.EQ(t, string(got), "abc")
+}
+
+func TestReaderTransfers(t *testing.T) {
+	r := iofault.NewReader(bytes.NewReader(data), iofault.OneByte())
+	p := make([]byte, 10)
+	n, err := r.Read(p)
+	expect.EQ(t, n, 1)
+	expect.NoError(t, err)
+
+	// Short reads are reproducible.
+	sizes := func() []int {
+		var sizes []int
+		r := iofault.NewReader(bytes.NewReader(data), iofault.ShortTransfers(1))
+		for {
+			n, err := r.Read(p)
+			if err == io.EOF {
+				return sizes
+			}
+			expect.NoError(t, err)
+			sizes = append(sizes, n)
+		}
+	}
+	a := sizes()
+	expect.EQ(t, a, sizes())
+	expect.GT(t, len(a), len(data)/len(p))
+
+	got, err := ioutil.ReadAll(iofault.NewReader(bytes.NewReader(data), iofault.ShortTransfers(2), iofault.FlipBit(1, 0), iofault.FlipBit(25, 5)))
+	expect.NoError(t, err)
+	expect.EQ(t, string(got), "accdefghijklmnopqrstuvwxyZ")
+}
+
+func TestReaderEOFWithData(t *testing.T) {
+	r := iofault.NewReader(bytes.NewReader(data), iofault.EOFWithData())
+	p := make([]byte, 20)
+	n, err := r.Read(p)
+	expect.EQ(t, n, 20)
+	expect.NoError(t, err)
+	n, err = r.Read(p)
+	expect.EQ(t, n, 6)
+	expect.EQ(t, err, io.EOF)
+	expect.EQ(t, string(p[:n]), "uvwxyz")
+
+	// A reader that only returns io.EOF after the data.
+	got, err := ioutil.ReadAll(iofault.NewReader(iofault.NewReader(bytes.NewReader(data), iofault.OneByte()), iofault.EOFWithData()))
+	expect.NoError(t, err)
+	expect.EQ(t, string(got), string(data))
+}
+
+func TestReaderAt(t *testing.T) {
+	r := iofault.NewReaderAt(bytes.NewReader(data), iofault.FailAt(20, nil), iofault.FlipBit(2, 0))
+	p := make([]byte, 5)
+	n, err := r.ReadAt(p, 0)
+	expect.EQ(t, n, 5)
+	expect.NoError(t, err)
+	expect.EQ(t, string(p), "abbde")
+	n, err = r.ReadAt(p, 18)
+	expect.EQ(t, n, 2)
+	expect.EQ(t, err, iofault.ErrInjected)
+	_, err = r.ReadAt(p, 20)
+	expect.EQ(t, err, iofault.ErrInjected)
+
+	r = iofault.NewReaderAt(bytes.NewReader(data), iofault.EOFWithData())
+	n, err = r.ReadAt(p, 21)
+	expect.EQ(t, n, 5)
+	expect.EQ(t, err, io.EOF)
+}
+
+func TestFailRandomly(t *testing.T) {
+	failures := func(seed int64) []bool {
+		r := iofault.NewReaderAt(bytes.NewReader(data), iofault.FailRandomly(seed, 0.5))
+		var failed []bool
+		for i := 0; i < 20; i++ {
+			_, err := r.ReadAt(make([]byte, 1), 0)
+			failed = append(failed, err == iofault.ErrInjected)
+		}
+		return failed
+	}
+	expect.EQ(t, failures(1), failures(1))
+	expect.NEQ(t, failures(1), failures(2))
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := iofault.NewWriter(&buf, iofault.FailAt(5, nil), iofault.FlipBit(0, 1))
+	n, err := w.Write(data)
+	expect.EQ(t, n, 5)
+	expect.EQ(t, err, iofault.ErrInjected)
+	expect.EQ(t, buf.String(), "cbcde")
+	// The caller's data is not modified.
+	expect.EQ(t, string(data[:1]), "a")
+
+	buf.Reset()
+	w = iofault.NewWriter(&buf, iofault.OneByte())
+	n, err = w.Write(data)
+	expect.EQ(t, n, 1)
+	expect.EQ(t, err, io.ErrShortWrite)
+}
+
+func TestContentAt(t *testing.T) {
+	content := &testutil.ByteContent{Data: append([]byte(nil), data...)}
+	c := iofault.NewContentAt(content, iofault.Delay(time.Millisecond), iofault.FailAt(20, nil))
+	expect.EQ(t, c.Size(), int64(len(data)))
+	expect.EQ(t, c.Checksum(), content.Checksum())
+	n, err := c.WriteAt([]byte("ABC"), 18)
+	expect.EQ(t, n, 2)
+	expect.EQ(t, err, iofault.ErrInjected)
+	expect.EQ(t, string(content.Bytes()[18:21]), "ABu")
+
+	// s3test object bodies fail part way through.
+	client := s3test.NewClient(t, "bucket")
+	client.SetFileContentAt("key", c, "")
+	out, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")})
+	expect.NoError(t, err)
+	got, err := ioutil.ReadAll(out.Body)
+	expect.EQ(t, err, iofault.ErrInjected)
+	expect.EQ(t, len(got), 20)
+}
@@ -0,0 +1,16 @@
+// +build !darwin,!linux
+
+package testutil
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile is not supported on this platform: DiskContent reads from the
+// file instead.
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	return nil, errors.New("mmap not supported")
+}
+
+func munmap(b []byte) {}
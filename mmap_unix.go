@@ -0,0 +1,18 @@
+// +build darwin linux
+
+package testutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the first size bytes of f, read-only and shared, so that
+// the mapping reflects later writes to the file.
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmap(b []byte) {
+	syscall.Munmap(b) // nolint: errcheck
+}
@@ -0,0 +1,256 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package testutil
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// ResolvePath returns the location of the test data file or directory
+// named by path, which is one of:
+//
+//	"//dir/file"            relative to the root of the main workspace or module
+//	"@workspace//dir/file"  relative to the root of another Bazel workspace
+//	"dir/file"              relative to the test's package
+//
+// Under Bazel, paths are looked up in the runfiles manifest
+// ($RUNFILES_MANIFEST_FILE), applying the repository mapping of bzlmod to
+// workspace names, and in the runfiles directory ($TEST_SRCDIR or
+// $RUNFILES_DIR); paths relative to the package are relative to the main
+// workspace there, as for GetFilePath. If $GRAIL is set, paths are also
+// looked up relative to it. Otherwise, "//" paths are relative to the root
+// of the Go module containing the working directory (the directory holding
+// go.mod) and other paths are relative to the working directory, which go
+// test sets to the package directory, or to its testdata directory.
+//
+// Unlike GetFilePath, ResolvePath returns an error, listing the locations
+// it tried, if the file does not exist.
+func ResolvePath(path string) (string, error) {
+	workspace, rel, err := parseRunfilePath(path)
+	if err != nil {
+		return "", err
+	}
+	var tried []string
+	try := func(candidate string) bool {
+		tried = append(tried, candidate)
+		_, err := os.Stat(candidate)
+		return err == nil
+	}
+
+	mainRepo := os.Getenv("TEST_WORKSPACE")
+	if mainRepo == "" {
+		mainRepo = "_main"
+	}
+	if manifest := os.Getenv("RUNFILES_MANIFEST_FILE"); manifest != "" {
+		entries, err := readRunfilesManifest(manifest)
+		if err != nil {
+			return "", err
+		}
+		repo := mainRepo
+		if workspace != "" {
+			repo = mapRepo(workspace, entries["_repo_mapping"])
+		}
+		if p, ok := lookupManifest(entries, filepath.ToSlash(filepath.Join(repo, rel))); ok && try(p) {
+			return p, nil
+		}
+	}
+	for _, env := range []string{"TEST_SRCDIR", "RUNFILES_DIR"} {
+		dir := os.Getenv(env)
+		if dir == "" {
+			continue
+		}
+		if workspace == "" {
+			if p := filepath.Join(dir, mainRepo, rel); try(p) {
+				return p, nil
+			}
+			continue
+		}
+		repo := mapRepo(workspace, filepath.Join(dir, "_repo_mapping"))
+		for _, p := range []string{
+			filepath.Join(dir, repo, rel),
+			// The layout of WORKSPACE builds, as used by GetFilePath.
+			filepath.Join(dir, mainRepo, "external", workspace, rel),
+		} {
+			if try(p) {
+				return p, nil
+			}
+		}
+	}
+	if workspace != "" {
+		return "", fmt.Errorf("testutil.ResolvePath(%v): not found in the Bazel runfiles (tried %v); "+
+			"workspaces are only supported under Bazel", path, tried)
+	}
+	if grail := os.Getenv("GRAIL"); grail != "" {
+		if p := filepath.Join(grail, rel); try(p) {
+			return p, nil
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("testutil.ResolvePath(%v): %v", path, err)
+	}
+	if strings.HasPrefix(path, "//") {
+		root, err := ModuleRoot(wd)
+		if err != nil {
+			return "", fmt.Errorf("testutil.ResolvePath(%v): %v", path, err)
+		}
+		if p := filepath.Join(root, rel); try(p) {
+			return p, nil
+		}
+	} else {
+		for _, p := range []string{filepath.Join(wd, rel), filepath.Join(wd, "testdata", rel)} {
+			if try(p) {
+				return p, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("testutil.ResolvePath(%v): file not found, tried %v", path, tried)
+}
+
+// FilePath is like ResolvePath, but fails the test if path cannot be
+// resolved.
+func FilePath(t testing.TB, path string) string {
+	t.Helper()
+	p, err := ResolvePath(path)
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		t.Fatalf("%s:%d: %v (is the file a data dependency of the test under Bazel, "+
+			"or in the module or package directory under go test?)", filepath.Base(file), line, err)
+	}
+	return p
+}
+
+// ModuleRoot returns the root of the Go module containing dir: the nearest
+// directory, starting with dir, that holds a go.mod file.
+func ModuleRoot(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d, nil
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return "", fmt.Errorf("no go.mod in %v or its parents", dir)
+		}
+		d = parent
+	}
+}
+
+// parseRunfilePath splits a path accepted by ResolvePath into its
+// workspace, if any, and the path relative to the workspace or package.
+func parseRunfilePath(path string) (workspace, rel string, err error) {
+	rel = path
+	if strings.HasPrefix(path, "@") {
+		sep := strings.Index(path, "/")
+		if sep == -1 {
+			sep = len(path)
+		}
+		workspace, rel = path[1:sep], path[sep:]
+		if workspace == "" {
+			return "", "", fmt.Errorf("testutil.ResolvePath(%v): empty workspace name", path)
+		}
+	}
+	rel = strings.TrimLeft(rel, "/")
+	if rel == ".." || strings.HasPrefix(filepath.ToSlash(filepath.Clean(rel)), "../") {
+		return "", "", fmt.Errorf("testutil.ResolvePath(%v): path escapes its root", path)
+	}
+	return workspace, filepath.FromSlash(rel), nil
+}
+
+// readRunfilesManifest reads a Bazel runfiles manifest, which maps
+// runfiles paths to the locations of the files, one per line.
+func readRunfilesManifest(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("testutil: reading runfiles manifest: %v", err)
+	}
+	defer f.Close() // nolint: errcheck
+	entries := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		escaped := strings.HasPrefix(line, " ")
+		if escaped {
+			line = line[1:]
+		}
+		sep := strings.Index(line, " ")
+		if sep == -1 {
+			// An empty file, which has no location.
+			entries[unescapeManifest(line, escaped)] = ""
+			continue
+		}
+		key, value := line[:sep], line[sep+1:]
+		if escaped {
+			key = unescapeManifest(key, true)
+			value = strings.NewReplacer(`\n`, "\n", `\b`, `\`).Replace(value)
+		}
+		entries[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("testutil: reading runfiles manifest %v: %v", name, err)
+	}
+	return entries, nil
+}
+
+// unescapeManifest undoes the escaping of a runfiles manifest path, which
+// is used by lines that start with a space.
+func unescapeManifest(s string, escaped bool) string {
+	if !escaped {
+		return s
+	}
+	return strings.NewReplacer(`\s`, " ", `\n`, "\n", `\b`, `\`).Replace(s)
+}
+
+// lookupManifest returns the location of the runfile key. Manifests list
+// only files, so the location of a directory is derived from that of a
+// file within it.
+func lookupManifest(entries map[string]string, key string) (string, bool) {
+	if p, ok := entries[key]; ok && p != "" {
+		return p, true
+	}
+	prefix := key + "/"
+	for k, v := range entries {
+		if strings.HasPrefix(k, prefix) && strings.HasSuffix(filepath.ToSlash(v), k[len(key):]) {
+			return v[:len(v)-len(k)+len(key)], true
+		}
+	}
+	return "", false
+}
+
+// mapRepo returns the canonical name of the repository whose apparent name,
+// as seen from the main repository, is apparent, according to the bzlmod
+// repository mapping file mapping. It returns apparent if there is no
+// mapping for it.
+func mapRepo(apparent, mapping string) string {
+	if mapping == "" {
+		return apparent
+	}
+	f, err := os.Open(mapping)
+	if err != nil {
+		return apparent
+	}
+	defer f.Close() // nolint: errcheck
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Each line is "source canonical name,apparent name,target canonical
+		// name"; the canonical name of the main repository is empty.
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) == 3 && fields[0] == "" && fields[1] == apparent {
+			return fields[2]
+		}
+	}
+	return apparent
+}
@@ -0,0 +1,173 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package testutil_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/testutil"
+)
+
+// withEnv runs fn with the given environment variables set, or unset if
+// their values are empty, and then restores them.
+func withEnv(t *testing.T, vars map[string]string, fn func()) {
+	for name, value := range vars {
+		if old, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, old) // nolint: errcheck
+		} else {
+			defer os.Unsetenv(name) // nolint: errcheck
+		}
+		if value == "" {
+			os.Unsetenv(name) // nolint: errcheck
+		} else {
+			os.Setenv(name, value) // nolint: errcheck
+		}
+	}
+	fn()
+}
+
+// noBazel unsets the environment variables that ResolvePath consults.
+var noBazel = map[string]string{
+	"RUNFILES_MANIFEST_FILE": "",
+	"RUNFILES_DIR":           "",
+	"TEST_SRCDIR":            "",
+	"TEST_WORKSPACE":         "",
+	"GRAIL":                  "",
+}
+
+// writeFiles creates the named files, with their names as contents, in dir.
+func writeFiles(t *testing.T, dir string, names ...string) {
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func resolve(t *testing.T, path, want string) {
+	t.Helper()
+	if got, err := testutil.ResolvePath(path); err != nil || got != want {
+		t.Errorf("ResolvePath(%v) = %v, %v, want %v", path, got, err, want)
+	}
+}
+
+func TestResolvePathModule(t *testing.T) {
+	root := testutil.NewTempDir(t, "", "module-")
+	writeFiles(t, root, "go.mod", "data/file", "pkg/local", "pkg/testdata/golden")
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd) // nolint: errcheck
+	if err := os.Chdir(filepath.Join(root, "pkg")); err != nil {
+		t.Fatal(err)
+	}
+	// Resolve any symlinks in root, as os.Getwd does.
+	if pkg, err := os.Getwd(); err == nil {
+		root = filepath.Dir(pkg)
+	}
+
+	withEnv(t, noBazel, func() {
+		resolve(t, "//data/file", filepath.Join(root, "data/file"))
+		resolve(t, "//data", filepath.Join(root, "data"))
+		resolve(t, "local", filepath.Join(root, "pkg/local"))
+		resolve(t, "golden", filepath.Join(root, "pkg/testdata/golden"))
+		resolve(t, "testdata/golden", filepath.Join(root, "pkg/testdata/golden"))
+		for _, test := range []struct{ path, err string }{
+			{"//data/missing", "file not found, tried [" + filepath.Join(root, "data/missing") + "]"},
+			{"missing", "file not found"},
+			{"@dep//file", "workspaces are only supported under Bazel"},
+			{"//../escape", "path escapes its root"},
+		} {
+			if _, err := testutil.ResolvePath(test.path); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("ResolvePath(%v): got error %v, want %q", test.path, err, test.err)
+			}
+		}
+	})
+}
+
+func TestResolvePathBazel(t *testing.T) {
+	dir := testutil.NewTempDir(t, "", "runfiles-")
+	writeFiles(t, dir, "files/main/data/file", "files/dep/d/f", "files/with space")
+	mapping := filepath.Join(dir, "files", "_repo_mapping")
+	if err := ioutil.WriteFile(mapping, []byte(",dep,dep~1.0\n_main,other,other~2.0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	manifest := filepath.Join(dir, "MANIFEST")
+	lines := []string{
+		"_main/data/file " + filepath.Join(dir, "files/main/data/file"),
+		"dep~1.0/d/f " + filepath.Join(dir, "files/dep/d/f"),
+		// An escaped line, which starts with a space.
+		` _main/with\sspace ` + filepath.Join(dir, "files/with space"),
+		"_main/empty",
+		"_repo_mapping " + mapping,
+	}
+	if err := ioutil.WriteFile(manifest, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{}
+	for k, v := range noBazel {
+		env[k] = v
+	}
+	env["RUNFILES_MANIFEST_FILE"] = manifest
+	withEnv(t, env, func() {
+		resolve(t, "//data/file", filepath.Join(dir, "files/main/data/file"))
+		resolve(t, "data/file", filepath.Join(dir, "files/main/data/file"))
+		resolve(t, "//data", filepath.Join(dir, "files/main/data"))
+		resolve(t, "@dep//d/f", filepath.Join(dir, "files/dep/d/f"))
+		resolve(t, "//with space", filepath.Join(dir, "files/with space"))
+		if _, err := testutil.ResolvePath("@other//d/f"); err == nil {
+			t.Errorf("ResolvePath(@other//d/f): a mapping for another repository was applied")
+		}
+	})
+
+	srcdir := filepath.Join(dir, "srcdir")
+	writeFiles(t, srcdir, "ws/data/file", "dep~1.0/d/f", "ws/external/legacy/g")
+	if err := ioutil.WriteFile(filepath.Join(srcdir, "_repo_mapping"), []byte(",dep,dep~1.0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	env["RUNFILES_MANIFEST_FILE"] = ""
+	env["TEST_SRCDIR"] = srcdir
+	env["TEST_WORKSPACE"] = "ws"
+	withEnv(t, env, func() {
+		resolve(t, "//data/file", filepath.Join(srcdir, "ws/data/file"))
+		resolve(t, "@dep//d/f", filepath.Join(srcdir, "dep~1.0/d/f"))
+		resolve(t, "@legacy//g", filepath.Join(srcdir, "ws/external/legacy/g"))
+		if _, err := testutil.ResolvePath("//missing"); err == nil || !strings.Contains(err.Error(), filepath.Join(srcdir, "ws/missing")) {
+			t.Errorf("ResolvePath(//missing): got error %v, want one listing the locations tried", err)
+		}
+	})
+}
+
+// fatalTB records the messages passed to Fatalf.
+type fatalTB struct {
+	testing.TB
+	fatal []string
+}
+
+func (f *fatalTB) Fatalf(format string, args ...interface{}) {
+	f.fatal = append(f.fatal, fmt.Sprintf(format, args...))
+}
+
+func TestFilePath(t *testing.T) {
+	if got, want := testutil.FilePath(t, "runfiles_test.go"), "runfiles_test.go"; filepath.Base(got) != want {
+		t.Errorf("got %v, want a path to %v", got, want)
+	}
+	tb := &fatalTB{TB: t}
+	testutil.FilePath(tb, "//does/not/exist")
+	if len(tb.fatal) != 1 || !strings.HasPrefix(tb.fatal[0], "runfiles_test.go:") || !strings.Contains(tb.fatal[0], "data dependency") {
+		t.Errorf("got %q, want a helpful failure", tb.fatal)
+	}
+}
@@ -0,0 +1,313 @@
+package s3test
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// URIs of the predefined grantee groups.
+const (
+	allUsersURI           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	authenticatedUsersURI = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+)
+
+// aclPermissions maps the actions that object ACLs can authorize to the
+// permissions that grant them. FULL_CONTROL grants all of them.
+var aclPermissions = map[string]string{
+	"s3:GetObject":    s3.PermissionRead,
+	"s3:GetObjectAcl": s3.PermissionReadAcp,
+	"s3:PutObjectAcl": s3.PermissionWriteAcp,
+}
+
+func invalidACL(format string, args ...interface{}) error {
+	return awserr.NewRequestFailure(awserr.New("InvalidArgument", fmt.Sprintf(format, args...), nil),
+		http.StatusBadRequest, "")
+}
+
+func groupGrant(uri, permission string) *s3.Grant {
+	return &s3.Grant{
+		Grantee:    &s3.Grantee{Type: aws.String(s3.TypeGroup), URI: aws.String(uri)},
+		Permission: aws.String(permission),
+	}
+}
+
+// cannedACL returns the grants, besides the owner's, of a canned ACL.
+func cannedACL(acl string) ([]*s3.Grant, error) {
+	switch acl {
+	case s3.ObjectCannedACLPrivate, s3.ObjectCannedACLBucketOwnerRead,
+		s3.ObjectCannedACLBucketOwnerFullControl, s3.ObjectCannedACLAwsExecRead:
+		// The owner of the bucket is the owner of all objects.
+		return nil, nil
+	case s3.ObjectCannedACLPublicRead:
+		return []*s3.Grant{groupGrant(allUsersURI, s3.PermissionRead)}, nil
+	case s3.ObjectCannedACLPublicReadWrite:
+		return []*s3.Grant{groupGrant(allUsersURI, s3.PermissionRead), groupGrant(allUsersURI, s3.PermissionWrite)}, nil
+	case s3.ObjectCannedACLAuthenticatedRead:
+		return []*s3.Grant{groupGrant(authenticatedUsersURI, s3.PermissionRead)}, nil
+	}
+	return nil, invalidACL("invalid canned ACL %q", acl)
+}
+
+// parseGrantHeader parses the value of an x-amz-grant-* header, e.g.,
+// `id="user1", uri="http://acs.amazonaws.com/groups/global/AllUsers"`.
+func parseGrantHeader(header, permission string) ([]*s3.Grant, error) {
+	var grants []*s3.Grant
+	for _, g := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(g), "=", 2)
+		if len(kv) != 2 {
+			return nil, invalidACL("invalid grant %q", g)
+		}
+		value := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		grantee := &s3.Grantee{}
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "id":
+			grantee.Type, grantee.ID = aws.String(s3.TypeCanonicalUser), aws.String(value)
+		case "emailaddress":
+			grantee.Type, grantee.EmailAddress = aws.String(s3.TypeAmazonCustomerByEmail), aws.String(value)
+		case "uri":
+			grantee.Type, grantee.URI = aws.String(s3.TypeGroup), aws.String(value)
+		default:
+			return nil, invalidACL("invalid grantee type in %q", g)
+		}
+		grants = append(grants, &s3.Grant{Grantee: grantee, Permission: aws.String(permission)})
+	}
+	return grants, nil
+}
+
+// aclHeaders holds the ACL of a request, given as a canned ACL or as
+// x-amz-grant-* headers.
+type aclHeaders struct {
+	acl, fullControl, read, readACP, write, writeACP *string
+}
+
+// aclFields maps the ACL headers to the fields of the request inputs, e.g.,
+// s3.PutObjectInput, that hold them.
+var aclFields = []struct{ header, field string }{
+	{"x-amz-acl", "ACL"},
+	{"x-amz-grant-full-control", "GrantFullControl"},
+	{"x-amz-grant-read", "GrantRead"},
+	{"x-amz-grant-read-acp", "GrantReadACP"},
+	{"x-amz-grant-write", "GrantWrite"},
+	{"x-amz-grant-write-acp", "GrantWriteACP"},
+}
+
+// inputACL returns the ACL headers set in the request input, keyed by name,
+// or nil if there are none.
+func inputACL(input interface{}) map[string]string {
+	var acl map[string]string
+	for _, f := range aclFields {
+		if v := fieldValue(input, f.field); v.IsValid() && v.Type() == reflect.TypeOf((*string)(nil)) {
+			if acl == nil {
+				acl = make(map[string]string)
+			}
+			acl[f.header] = v.Elem().String()
+		}
+	}
+	return acl
+}
+
+// setInputACL sets the ACL headers of the request input, which must be a
+// pointer to a struct with the fields listed in aclFields.
+func setInputACL(input interface{}, acl map[string]string) {
+	v := reflect.ValueOf(input).Elem()
+	for _, f := range aclFields {
+		if value, ok := acl[f.header]; ok {
+			v.FieldByName(f.field).Set(reflect.ValueOf(aws.String(value)))
+		}
+	}
+}
+
+// grants returns the grants specified by h.
+func (h aclHeaders) grants() ([]*s3.Grant, error) {
+	headers := []struct {
+		value      *string
+		permission string
+	}{
+		{h.fullControl, s3.PermissionFullControl},
+		{h.read, s3.PermissionRead},
+		{h.readACP, s3.PermissionReadAcp},
+		{h.write, s3.PermissionWrite},
+		{h.writeACP, s3.PermissionWriteAcp},
+	}
+	var grants []*s3.Grant
+	for _, header := range headers {
+		if header.value == nil {
+			continue
+		}
+		g, err := parseGrantHeader(*header.value, header.permission)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, g...)
+	}
+	if h.acl != nil {
+		if grants != nil {
+			return nil, awserr.NewRequestFailure(awserr.New("InvalidRequest",
+				"Specifying both Canned ACLs and Header Grants is not allowed", nil), http.StatusBadRequest, "")
+		}
+		return cannedACL(*h.acl)
+	}
+	return grants, nil
+}
+
+// granteeMatches reports whether grantee designates principal.
+func granteeMatches(grantee *s3.Grantee, principal string) bool {
+	if grantee == nil {
+		return false
+	}
+	switch uri := aws.StringValue(grantee.URI); {
+	case uri == allUsersURI, uri == authenticatedUsersURI:
+		return true
+	case uri != "":
+		return false
+	}
+	return aws.StringValue(grantee.ID) == principal || aws.StringValue(grantee.EmailAddress) == principal
+}
+
+// aclAllows reports whether grants allow principal to perform action.
+func aclAllows(grants []*s3.Grant, principal, action string) bool {
+	permission, ok := aclPermissions[action]
+	if !ok {
+		return false
+	}
+	for _, g := range grants {
+		if p := aws.StringValue(g.Permission); (p == permission || p == s3.PermissionFullControl) &&
+			granteeMatches(g.Grantee, principal) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetObjectAcl returns the ACL of an object: the owner's full control and
+// the grants set when the object was written or by PutObjectAcl.
+func (c *Client) GetObjectAcl(input *s3.GetObjectAclInput) (output *s3.GetObjectAclOutput, err error) {
+	rec := c.record("GetObjectAcl", input)
+	defer rec.done(&output, &err)
+	return c.getObjectAcl(input)
+}
+
+// getObjectAcl implements GetObjectAcl and GetObjectAclRequest.
+func (c *Client) getObjectAcl(input *s3.GetObjectAclInput) (output *s3.GetObjectAclOutput, err error) {
+	if err := c.startRequest("GetObjectAcl", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("GetObjectAcl", input.Bucket); err != nil {
+		return nil, err
+	}
+	f, ok := c.GetFile(aws.StringValue(input.Key))
+	if !ok {
+		return nil, awserr.New("NoSuchKey", "Object not found", nil)
+	}
+	owner := &s3.Owner{ID: aws.String(BucketOwner)}
+	grants := []*s3.Grant{{
+		Grantee:    &s3.Grantee{Type: aws.String(s3.TypeCanonicalUser), ID: owner.ID},
+		Permission: aws.String(s3.PermissionFullControl),
+	}}
+	return &s3.GetObjectAclOutput{Owner: owner, Grants: append(grants, f.Grants...)}, nil
+}
+
+// GetObjectAclRequest implements the request variant of GetObjectAcl.
+func (c *Client) GetObjectAclRequest(input *s3.GetObjectAclInput) (req *request.Request, output *s3.GetObjectAclOutput) {
+	req, output = c.svc.GetObjectAclRequest(input)
+	rec := c.record("GetObjectAcl", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("GetObjectAclRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.getObjectAcl(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// GetObjectAclWithContext implements the corresponding s3iface.API method.
+func (c *Client) GetObjectAclWithContext(ctx aws.Context, input *s3.GetObjectAclInput, opts ...request.Option) (*s3.GetObjectAclOutput, error) {
+	req, out := c.GetObjectAclRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
+
+// PutObjectAcl sets the ACL of an object already in the bucket, given as a
+// canned ACL, grant headers or an AccessControlPolicy. Object ACLs can allow
+// principals other than the bucket owner to read the object (READ), and to
+// read (READ_ACP) and write (WRITE_ACP) its ACL; see Client.Principal.
+// Bucket ACLs are not supported.
+func (c *Client) PutObjectAcl(input *s3.PutObjectAclInput) (output *s3.PutObjectAclOutput, err error) {
+	rec := c.record("PutObjectAcl", input)
+	defer rec.done(&output, &err)
+	return c.putObjectAcl(input)
+}
+
+// putObjectAcl implements PutObjectAcl and PutObjectAclRequest.
+func (c *Client) putObjectAcl(input *s3.PutObjectAclInput) (output *s3.PutObjectAclOutput, err error) {
+	if err := c.startRequest("PutObjectAcl", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("PutObjectAcl", input.Bucket); err != nil {
+		return nil, err
+	}
+	grants, err := aclHeaders{input.ACL, input.GrantFullControl, input.GrantRead,
+		input.GrantReadACP, input.GrantWrite, input.GrantWriteACP}.grants()
+	if err != nil {
+		return nil, err
+	}
+	if policy := input.AccessControlPolicy; policy != nil {
+		if grants != nil || input.ACL != nil {
+			return nil, awserr.NewRequestFailure(awserr.New("UnexpectedContent",
+				"This request does not support content", nil), http.StatusBadRequest, "")
+		}
+		for _, g := range policy.Grants {
+			// The owner's full control is implicit.
+			if g.Grantee == nil || aws.StringValue(g.Grantee.ID) != BucketOwner {
+				grants = append(grants, g)
+			}
+		}
+	}
+	key := aws.StringValue(input.Key)
+	c.m.Lock()
+	defer c.m.Unlock()
+	f, ok := c.content[key]
+	if !ok {
+		return nil, awserr.New("NoSuchKey", "Object not found", nil)
+	}
+	f.Grants = grants
+	c.putLocked(key, f)
+	return &s3.PutObjectAclOutput{}, nil
+}
+
+// PutObjectAclRequest implements the request variant of PutObjectAcl.
+func (c *Client) PutObjectAclRequest(input *s3.PutObjectAclInput) (req *request.Request, output *s3.PutObjectAclOutput) {
+	req, output = c.svc.PutObjectAclRequest(input)
+	rec := c.record("PutObjectAcl", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("PutObjectAclRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.putObjectAcl(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// PutObjectAclWithContext implements the corresponding s3iface.API method.
+func (c *Client) PutObjectAclWithContext(ctx aws.Context, input *s3.PutObjectAclInput, opts ...request.Option) (*s3.PutObjectAclOutput, error) {
+	req, out := c.PutObjectAclRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
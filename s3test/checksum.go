@@ -0,0 +1,167 @@
+package s3test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// Checksum algorithms supported by S3's x-amz-checksum-<algorithm> headers.
+// (The version of the AWS SDK used by this package predates the
+// corresponding request fields, so the headers must be set on the request
+// directly.)
+const (
+	ChecksumCRC32  = "CRC32"
+	ChecksumCRC32C = "CRC32C"
+	ChecksumSHA1   = "SHA1"
+	ChecksumSHA256 = "SHA256"
+)
+
+var checksumAlgorithms = []string{ChecksumCRC32, ChecksumCRC32C, ChecksumSHA1, ChecksumSHA256}
+
+// Request headers that select the checksum algorithm of a multipart upload
+// or of an object whose checksum the caller wants S3 to compute.
+const (
+	checksumAlgorithmHeader    = "X-Amz-Checksum-Algorithm"
+	sdkChecksumAlgorithmHeader = "X-Amz-Sdk-Checksum-Algorithm"
+)
+
+// ChecksumHeader returns the name of the request header that carries the
+// base64-encoded checksum of a request body computed with alg.
+func ChecksumHeader(alg string) string {
+	return http.CanonicalHeaderKey("x-amz-checksum-" + strings.ToLower(alg))
+}
+
+func newChecksumHash(alg string) (hash.Hash, error) {
+	switch alg {
+	case ChecksumCRC32:
+		return crc32.NewIEEE(), nil
+	case ChecksumCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	case ChecksumSHA1:
+		return sha1.New(), nil
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	}
+	return nil, awserr.New("InvalidRequest", fmt.Sprintf("unsupported checksum algorithm %q", alg), nil)
+}
+
+// ComputeChecksum returns the base64-encoded checksum of data computed with
+// alg, in the form S3 expects in the x-amz-checksum-<algorithm> headers.
+func ComputeChecksum(alg string, data []byte) (string, error) {
+	h, err := newChecksumHash(alg)
+	if err != nil {
+		return "", err
+	}
+	h.Write(data) // nolint: errcheck
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// compositeChecksum returns the checksum of an object created by a multipart
+// upload: the checksum of the concatenated (binary) checksums of its parts,
+// followed by "-<number of parts>".
+func compositeChecksum(alg string, parts []*uploadedPart) (string, error) {
+	var buf []byte
+	for _, p := range parts {
+		sum, err := base64.StdEncoding.DecodeString(p.checksum)
+		if err != nil {
+			return "", err
+		}
+		buf = append(buf, sum...)
+	}
+	sum, err := ComputeChecksum(alg, buf)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%d", sum, len(parts)), nil
+}
+
+// checkChecksumHeaders verifies the x-amz-checksum-<algorithm> header sent
+// with a request whose body is data. It returns the algorithm and the
+// checksum, which are empty if the request has no checksum header and does
+// not select an algorithm.
+func (c *Client) checkChecksumHeaders(api string, h http.Header, data []byte) (alg, sum string, err error) {
+	for _, a := range checksumAlgorithms {
+		want := h.Get(ChecksumHeader(a))
+		if want == "" {
+			continue
+		}
+		if alg != "" {
+			return "", "", awserr.New("InvalidRequest",
+				fmt.Sprintf("%s: expecting a single x-amz-checksum- header", api), nil)
+		}
+		got, _ := ComputeChecksum(a, data)
+		if got != want {
+			return "", "", c.badDigest(api, fmt.Errorf("%s checksum mismatch: got %v, expect %v", a, want, got))
+		}
+		alg, sum = a, got
+	}
+	if alg != "" {
+		return alg, sum, nil
+	}
+	alg = checksumAlgorithm(h)
+	if alg == "" {
+		return "", "", nil
+	}
+	sum, err = ComputeChecksum(alg, data)
+	return alg, sum, err
+}
+
+// checksumAlgorithm returns the checksum algorithm selected by h.
+func checksumAlgorithm(h http.Header) string {
+	if alg := h.Get(checksumAlgorithmHeader); alg != "" {
+		return strings.ToUpper(alg)
+	}
+	return strings.ToUpper(h.Get(sdkChecksumAlgorithmHeader))
+}
+
+// checkContentMD5 verifies the Content-MD5 sent with a request whose body is
+// data.
+func (c *Client) checkContentMD5(api string, contentMD5 *string, data []byte) error {
+	if contentMD5 == nil {
+		return nil
+	}
+	want, err := base64.StdEncoding.DecodeString(*contentMD5)
+	if err != nil || len(want) != md5.Size {
+		return c.violation(awserr.New("InvalidDigest",
+			fmt.Sprintf("%s: the Content-MD5 you specified is not valid: %q", api, *contentMD5), nil))
+	}
+	if got := md5.Sum(data); !bytes.Equal(got[:], want) {
+		return c.badDigest(api, fmt.Errorf("Content-MD5 mismatch: got %v, expect %v",
+			*contentMD5, base64.StdEncoding.EncodeToString(got[:])))
+	}
+	return nil
+}
+
+// setPartChecksum sets the checksum of a part uploaded with a checksum of
+// the given algorithm (if any) to an upload that was created with a checksum
+// algorithm, computing it if the request did not include one.
+//
+// REQUIRES: c.m is locked.
+func (c *Client) setPartChecksum(r *multipartUpload, part *uploadedPart, alg, sum string) error {
+	uploadAlg := r.object.ChecksumAlgorithm
+	if uploadAlg == "" {
+		return nil
+	}
+	if alg != "" && alg != uploadAlg {
+		return awserr.New("InvalidRequest",
+			fmt.Sprintf("checksum type mismatch: upload %s uses %s, got %s", r.id, uploadAlg, alg), nil)
+	}
+	if alg == "" {
+		var err error
+		if sum, err = ComputeChecksum(uploadAlg, part.data); err != nil {
+			return err
+		}
+	}
+	part.checksum = sum
+	return nil
+}
@@ -0,0 +1,197 @@
+package s3test_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil/encryptiontest"
+	"github.com/grailbio/testutil/expect"
+	"github.com/grailbio/testutil/s3test"
+)
+
+func withHeader(key, value string) request.Option {
+	return func(r *request.Request) { r.HTTPRequest.Header.Set(key, value) }
+}
+
+func contentMD5(data []byte) *string {
+	sum := md5.Sum(data)
+	return aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+func TestContentMD5(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	data := []byte("contents")
+	put := func(md5 *string) error {
+		_, err := client.PutObject(&s3.PutObjectInput{
+			Bucket:     aws.String(testBucket),
+			Key:        aws.String("a"),
+			Body:       bytes.NewReader(data),
+			ContentMD5: md5,
+		})
+		return err
+	}
+	expect.NoError(t, put(contentMD5(data)))
+	expect.EQ(t, awsErrCode(put(contentMD5([]byte("other")))), "BadDigest")
+	expect.EQ(t, awsErrCode(put(aws.String("not base64"))), "InvalidDigest")
+
+	id := createUpload(t, client, "mp")
+	_, err := client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("mp"),
+		UploadId:   aws.String(id),
+		PartNumber: aws.Int64(1),
+		Body:       bytes.NewReader(data),
+		ContentMD5: contentMD5([]byte("other")),
+	})
+	expect.EQ(t, awsErrCode(err), "BadDigest")
+}
+
+func TestChecksumHeaders(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	data := []byte("contents")
+	for _, alg := range []string{s3test.ChecksumCRC32, s3test.ChecksumCRC32C, s3test.ChecksumSHA1, s3test.ChecksumSHA256} {
+		sum, err := s3test.ComputeChecksum(alg, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		input := &s3.PutObjectInput{Bucket: aws.String(testBucket), Key: aws.String(alg)}
+		input.Body = bytes.NewReader(data)
+		if _, err := client.PutObjectWithContext(ctx, input, withHeader(s3test.ChecksumHeader(alg), sum)); err != nil {
+			t.Fatal(err)
+		}
+		f := client.MustGetFile(alg)
+		expect.EQ(t, f.ChecksumAlgorithm, alg)
+		expect.EQ(t, f.Checksum, sum)
+
+		input.Body = bytes.NewReader([]byte("corrupted"))
+		_, err = client.PutObjectWithContext(ctx, input, withHeader(s3test.ChecksumHeader(alg), sum))
+		expect.EQ(t, awsErrCode(err), "BadDigest")
+	}
+	// Known values for "contents".
+	expect.EQ(t, client.MustGetFile(s3test.ChecksumCRC32).Checksum, "tPoRdw==")
+
+	// The caller may ask S3 to compute the checksum.
+	if _, err := client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("computed"),
+		Body:   bytes.NewReader(data),
+	}, withHeader("X-Amz-Sdk-Checksum-Algorithm", "sha256")); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := s3test.ComputeChecksum(s3test.ChecksumSHA256, data)
+	expect.EQ(t, client.MustGetFile("computed").Checksum, want)
+}
+
+func TestCompositeChecksum(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	client.MinPartSize = 1
+	out, err := client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("mp"),
+	}, withHeader("X-Amz-Checksum-Algorithm", s3test.ChecksumCRC32C))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := aws.StringValue(out.UploadId)
+	p1 := uploadPart(t, client, "mp", id, 1, []byte("part1"))
+	p2 := uploadPart(t, client, "mp", id, 2, []byte("part2"))
+
+	sum2, _ := s3test.ComputeChecksum(s3test.ChecksumCRC32C, []byte("part2"))
+	_, err = client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("mp"),
+		UploadId:   aws.String(id),
+		PartNumber: aws.Int64(2),
+		Body:       bytes.NewReader([]byte("part2")),
+	}, withHeader(s3test.ChecksumHeader(s3test.ChecksumSHA1), "AAAA"))
+	expect.EQ(t, awsErrCode(err), "BadDigest")
+	_, err = client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("mp"),
+		UploadId:   aws.String(id),
+		PartNumber: aws.Int64(2),
+		Body:       bytes.NewReader([]byte("part2")),
+	}, withHeader(s3test.ChecksumHeader(s3test.ChecksumCRC32C), sum2))
+	expect.NoError(t, err)
+
+	if _, err := completeUpload(client, "mp", id, p1, p2); err != nil {
+		t.Fatal(err)
+	}
+	sum1, _ := s3test.ComputeChecksum(s3test.ChecksumCRC32C, []byte("part1"))
+	raw1, _ := base64.StdEncoding.DecodeString(sum1)
+	raw2, _ := base64.StdEncoding.DecodeString(sum2)
+	composite, _ := s3test.ComputeChecksum(s3test.ChecksumCRC32C, append(raw1, raw2...))
+	f := client.MustGetFile("mp")
+	expect.EQ(t, f.ChecksumAlgorithm, s3test.ChecksumCRC32C)
+	expect.EQ(t, f.Checksum, fmt.Sprintf("%s-2", composite))
+}
+
+func TestSSECustomer(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	key := encryptiontest.NewFakeAESRegistry().SSECustomerKey()
+	other := (&encryptiontest.FakeAESRegistry{Key: []byte("fedcba9876543210")}).SSECustomerKey()
+
+	out, err := client.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String(testBucket),
+		Key:                  aws.String("a"),
+		Body:                 bytes.NewReader([]byte("secret")),
+		SSECustomerAlgorithm: aws.String("AES256"),
+		SSECustomerKey:       aws.String(key),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect.EQ(t, aws.StringValue(out.SSECustomerKeyMD5), s3test.SSECustomerKeyMD5(key))
+
+	get := func(key *string) error {
+		input := &s3.GetObjectInput{Bucket: aws.String(testBucket), Key: aws.String("a")}
+		if key != nil {
+			input.SSECustomerAlgorithm = aws.String("AES256")
+			input.SSECustomerKey = key
+		}
+		_, err := client.GetObjectWithContext(ctx, input)
+		return err
+	}
+	expect.NoError(t, get(aws.String(key)))
+	expect.EQ(t, statusCode(get(nil)), http.StatusBadRequest)
+	expect.EQ(t, awsErrCode(get(aws.String(other))), "AccessDenied")
+	expect.EQ(t, awsErrCode(get(aws.String("short"))), "InvalidArgument")
+
+	head, err := client.HeadObject(&s3.HeadObjectInput{
+		Bucket:               aws.String(testBucket),
+		Key:                  aws.String("a"),
+		SSECustomerAlgorithm: aws.String("AES256"),
+		SSECustomerKey:       aws.String(key),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect.EQ(t, aws.StringValue(head.SSECustomerAlgorithm), "AES256")
+
+	// Copies must present the source key, and are encrypted with the
+	// destination key, if any.
+	_, err = client.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("b"),
+		CopySource: aws.String(testBucket + "/a"),
+	})
+	expect.EQ(t, statusCode(err), http.StatusBadRequest)
+	if _, err := client.CopyObject(&s3.CopyObjectInput{
+		Bucket:                         aws.String(testBucket),
+		Key:                            aws.String("b"),
+		CopySource:                     aws.String(testBucket + "/a"),
+		CopySourceSSECustomerAlgorithm: aws.String("AES256"),
+		CopySourceSSECustomerKey:       aws.String(key),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(testBucket), Key: aws.String("b")})
+	expect.NoError(t, err)
+}
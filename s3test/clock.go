@@ -0,0 +1,154 @@
+package s3test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Clock is the source of time used by Client. It allows tests to control
+// time-dependent behavior, such as write visibility, deterministically.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// afterClock is implemented by clocks that can also be waited on. Client
+// uses time.After for clocks that do not implement it.
+type afterClock interface {
+	// After returns a channel that receives the current time once d has
+	// elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+type wallClock struct{}
+
+func (wallClock) Now() time.Time { return time.Now() }
+
+func (wallClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// FakeClock is a Clock whose time only changes when Advance or Set is
+// called. It is safe for concurrent use.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond // signaled when waiters changes; lazily initialized
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+// NewFakeClock returns a FakeClock set to the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now implements Clock.
+func (fc *FakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+// Advance moves the clock forward by d.
+func (fc *FakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	fc.now = fc.now.Add(d)
+	fc.fireLocked()
+	fc.mu.Unlock()
+}
+
+// Set sets the clock to the given time.
+func (fc *FakeClock) Set(now time.Time) {
+	fc.mu.Lock()
+	fc.now = now
+	fc.fireLocked()
+	fc.mu.Unlock()
+}
+
+// After returns a channel that receives the clock's time once it has been
+// advanced by at least d. Client uses it to simulate delays, see Network.
+func (fc *FakeClock) After(d time.Duration) <-chan time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	c := make(chan time.Time, 1)
+	if d <= 0 {
+		c <- fc.now
+		return c
+	}
+	fc.waiters = append(fc.waiters, fakeWaiter{fc.now.Add(d), c})
+	fc.condLocked().Broadcast()
+	return c
+}
+
+// BlockUntil blocks until at least n calls to After are waiting for the
+// clock to be advanced. Tests use it to advance the clock only once the code
+// under test is blocked on it. Waiters abandoned by their callers (e.g.,
+// because a request was canceled) count until the clock passes their
+// deadline.
+func (fc *FakeClock) BlockUntil(n int) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for len(fc.waiters) < n {
+		fc.condLocked().Wait()
+	}
+}
+
+// REQUIRES: fc.mu is locked.
+func (fc *FakeClock) condLocked() *sync.Cond {
+	if fc.cond == nil {
+		fc.cond = sync.NewCond(&fc.mu)
+	}
+	return fc.cond
+}
+
+// fireLocked notifies the waiters whose deadline has passed.
+//
+// REQUIRES: fc.mu is locked.
+func (fc *FakeClock) fireLocked() {
+	waiters := fc.waiters[:0]
+	for _, w := range fc.waiters {
+		if w.deadline.After(fc.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.c <- fc.now
+	}
+	fc.waiters = waiters
+	fc.condLocked().Broadcast()
+}
+
+// now returns the current time according to c.Clock.
+func (c *Client) now() time.Time {
+	if c.Clock == nil {
+		return wallClock{}.Now()
+	}
+	return c.Clock.Now()
+}
+
+// sleep waits for d to elapse according to c.Clock, or for ctx to be done.
+func (c *Client) sleep(ctx aws.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	var clock Clock = wallClock{}
+	if c.Clock != nil {
+		clock = c.Clock
+	}
+	var after <-chan time.Time
+	if ac, ok := clock.(afterClock); ok {
+		after = ac.After(d)
+	} else {
+		after = time.After(d)
+	}
+	select {
+	case <-after:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
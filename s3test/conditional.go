@@ -0,0 +1,99 @@
+package s3test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// conditions holds the preconditions of a conditional request: the If-*
+// headers of GetObject and HeadObject or the x-amz-copy-source-if-* headers
+// of CopyObject and UploadPartCopy.
+type conditions struct {
+	ifMatch, ifNoneMatch               *string
+	ifModifiedSince, ifUnmodifiedSince *time.Time
+}
+
+// eval evaluates the preconditions against f using the precedence rules of
+// RFC 7232 section 6, which S3 follows: If-Match takes precedence over
+// If-Unmodified-Since, and If-None-Match over If-Modified-Since. It returns
+// http.StatusOK if the request should proceed, and otherwise
+// http.StatusNotModified or http.StatusPreconditionFailed.
+func (cond conditions) eval(f FileContent) int {
+	// HTTP dates have a resolution of one second.
+	modified := f.LastModified.Truncate(time.Second)
+	if cond.ifMatch != nil {
+		if !etagMatches(*cond.ifMatch, f.etag()) {
+			return http.StatusPreconditionFailed
+		}
+	} else if cond.ifUnmodifiedSince != nil && modified.After(*cond.ifUnmodifiedSince) {
+		return http.StatusPreconditionFailed
+	}
+	if cond.ifNoneMatch != nil {
+		if etagMatches(*cond.ifNoneMatch, f.etag()) {
+			return http.StatusNotModified
+		}
+	} else if cond.ifModifiedSince != nil && !modified.After(*cond.ifModifiedSince) {
+		return http.StatusNotModified
+	}
+	return http.StatusOK
+}
+
+// check evaluates the preconditions of a GetObject or HeadObject request
+// and returns the corresponding S3 error, if any.
+func (cond conditions) check(f FileContent) error {
+	switch cond.eval(f) {
+	case http.StatusNotModified:
+		return awserr.NewRequestFailure(awserr.New("NotModified", "Not Modified", nil), http.StatusNotModified, "")
+	case http.StatusPreconditionFailed:
+		return preconditionFailed("At least one of the pre-conditions you specified did not hold")
+	}
+	return nil
+}
+
+// checkCopySource evaluates the preconditions of a CopyObject or
+// UploadPartCopy request. Unlike reads, copies fail with
+// PreconditionFailed whenever any condition does not hold.
+func (cond conditions) checkCopySource(f FileContent) error {
+	if cond.eval(f) != http.StatusOK {
+		return preconditionFailed("At least one of the copy source pre-conditions you specified did not hold")
+	}
+	return nil
+}
+
+func preconditionFailed(msg string) error {
+	return awserr.NewRequestFailure(awserr.New("PreconditionFailed", msg, nil), http.StatusPreconditionFailed, "")
+}
+
+// etagMatches reports whether etag matches the value of an If-Match or
+// If-None-Match header, which is either "*" or a comma-separated list of
+// (possibly quoted) ETags.
+func etagMatches(header, etag string) bool {
+	for _, h := range strings.Split(header, ",") {
+		h = strings.TrimSpace(h)
+		if h == "*" || trimETag(h) == trimETag(etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCreateOnlyLocked implements the "If-None-Match: *" header of PutObject,
+// which fails the request if key already exists. REQUIRES: c.m is locked.
+func (c *Client) checkCreateOnlyLocked(header http.Header, key string) error {
+	v := header.Get("If-None-Match")
+	if v == "" {
+		return nil
+	}
+	if v != "*" {
+		return awserr.NewRequestFailure(awserr.New("NotImplemented",
+			fmt.Sprintf("If-None-Match: %s is not supported by PutObject, only *", v), nil), http.StatusNotImplemented, "")
+	}
+	if _, ok := c.content[key]; ok {
+		return preconditionFailed("At least one of the pre-conditions you specified did not hold")
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package s3test_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil/s3test"
+)
+
+func statusCode(err error) int {
+	if rerr, ok := err.(awserr.RequestFailure); ok {
+		return rerr.StatusCode()
+	}
+	return 0
+}
+
+func TestConditionalGet(t *testing.T) {
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	client := s3test.NewClient(t, testBucket)
+	client.Clock = s3test.NewFakeClock(modified)
+	client.SetFile("obj", []byte("contents"), "")
+	etag := client.MustGetFile("obj").ETag
+	quoted := `"` + etag + `"`
+	before, after := modified.Add(-time.Hour), modified.Add(time.Hour)
+
+	for i, c := range []struct {
+		ifMatch, ifNoneMatch               *string
+		ifModifiedSince, ifUnmodifiedSince *time.Time
+		code                               string
+		status                             int
+	}{
+		{ifMatch: aws.String(etag)},
+		{ifMatch: aws.String(quoted)},
+		{ifMatch: aws.String(`"other", ` + quoted)},
+		{ifMatch: aws.String("*")},
+		{ifMatch: aws.String("other"), code: "PreconditionFailed", status: 412},
+		{ifNoneMatch: aws.String("other")},
+		{ifNoneMatch: aws.String(quoted), code: "NotModified", status: 304},
+		{ifNoneMatch: aws.String("*"), code: "NotModified", status: 304},
+		{ifModifiedSince: &before},
+		{ifModifiedSince: &modified, code: "NotModified", status: 304},
+		{ifModifiedSince: &after, code: "NotModified", status: 304},
+		{ifUnmodifiedSince: &after},
+		{ifUnmodifiedSince: &modified},
+		{ifUnmodifiedSince: &before, code: "PreconditionFailed", status: 412},
+		// If-Match takes precedence over If-Unmodified-Since, and
+		// If-None-Match over If-Modified-Since.
+		{ifMatch: aws.String(etag), ifUnmodifiedSince: &before},
+		{ifNoneMatch: aws.String("other"), ifModifiedSince: &after},
+		{ifNoneMatch: aws.String(etag), ifModifiedSince: &before, code: "NotModified", status: 304},
+	} {
+		_, getErr := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket:            aws.String(testBucket),
+			Key:               aws.String("obj"),
+			IfMatch:           c.ifMatch,
+			IfNoneMatch:       c.ifNoneMatch,
+			IfModifiedSince:   c.ifModifiedSince,
+			IfUnmodifiedSince: c.ifUnmodifiedSince,
+		})
+		_, headErr := client.HeadObject(&s3.HeadObjectInput{
+			Bucket:            aws.String(testBucket),
+			Key:               aws.String("obj"),
+			IfMatch:           c.ifMatch,
+			IfNoneMatch:       c.ifNoneMatch,
+			IfModifiedSince:   c.ifModifiedSince,
+			IfUnmodifiedSince: c.ifUnmodifiedSince,
+		})
+		for _, err := range []error{getErr, headErr} {
+			if got, want := awsErrCode(err), c.code; got != want {
+				t.Errorf("%d: got %v, want %v", i, err, want)
+			}
+			if got, want := statusCode(err), c.status; got != want {
+				t.Errorf("%d: got status %v, want %v", i, got, want)
+			}
+		}
+	}
+}
+
+func TestConditionalCopy(t *testing.T) {
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	client := s3test.NewClient(t, testBucket)
+	client.Clock = s3test.NewFakeClock(modified)
+	client.SetFile("src", []byte("contents"), "")
+	etag := client.MustGetFile("src").ETag
+	before := modified.Add(-time.Hour)
+
+	for i, c := range []struct {
+		input *s3.CopyObjectInput
+		code  string
+	}{
+		{&s3.CopyObjectInput{CopySourceIfMatch: aws.String(etag)}, ""},
+		{&s3.CopyObjectInput{CopySourceIfMatch: aws.String("other")}, "PreconditionFailed"},
+		{&s3.CopyObjectInput{CopySourceIfNoneMatch: aws.String(etag)}, "PreconditionFailed"},
+		{&s3.CopyObjectInput{CopySourceIfModifiedSince: &modified}, "PreconditionFailed"},
+		{&s3.CopyObjectInput{CopySourceIfUnmodifiedSince: &before}, "PreconditionFailed"},
+	} {
+		c.input.Bucket = aws.String(testBucket)
+		c.input.CopySource = aws.String(testBucket + "/src")
+		c.input.Key = aws.String("dst")
+		client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(testBucket), Key: aws.String("dst")}) // nolint: errcheck
+		_, err := client.CopyObject(c.input)
+		if got, want := awsErrCode(err), c.code; got != want {
+			t.Errorf("%d: got %v, want %v", i, err, want)
+		}
+		if _, ok := client.GetFile("dst"); ok != (c.code == "") {
+			t.Errorf("%d: dst exists: %v", i, ok)
+		}
+	}
+
+	id := createUpload(t, client, "dst")
+	_, err := client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+		Bucket:            aws.String(testBucket),
+		Key:               aws.String("dst"),
+		UploadId:          aws.String(id),
+		PartNumber:        aws.Int64(1),
+		CopySource:        aws.String(testBucket + "/src"),
+		CopySourceIfMatch: aws.String("other"),
+	})
+	if got, want := awsErrCode(err), "PreconditionFailed"; got != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+}
+
+func ifNoneMatchAny(r *request.Request) {
+	r.HTTPRequest.Header.Set("If-None-Match", "*")
+}
+
+func TestCreateOnlyPut(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	put := func(data string) error {
+		_, err := client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(testBucket),
+			Key:    aws.String("lock"),
+			Body:   bytes.NewReader([]byte(data)),
+		}, ifNoneMatchAny)
+		return err
+	}
+	if err := put("owner1"); err != nil {
+		t.Fatal(err)
+	}
+	err := put("owner2")
+	if got, want := awsErrCode(err), "PreconditionFailed"; got != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+	if got, want := statusCode(err), http.StatusPreconditionFailed; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := string(client.GetFileContentBytes("lock")), "owner1"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,231 @@
+package s3test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// RunManagerConformance runs a suite of tests that drive the S3 upload and
+// download managers (s3manager.Uploader and s3manager.Downloader) and
+// s3manager.BatchDelete against the API returned by newAPI, which is called
+// with the subtest's testing.T and must return an empty bucket. If newAPI is
+// nil, the suite runs against a Client, i.e., it checks this package's fake
+// against the AWS SDK in use.
+//
+// The suite covers a range of object sizes, part sizes and concurrency
+// levels, ranged downloads, and failures injected into individual part
+// uploads, downloads and deletes. Besides the methods used by s3manager, it
+// uses HeadObject and ListMultipartUploads to inspect the bucket.
+func RunManagerConformance(t *testing.T, bucket string, newAPI func(t *testing.T) s3iface.S3API) {
+	if newAPI == nil {
+		newAPI = func(t *testing.T) s3iface.S3API { return NewClient(t, bucket) }
+	}
+	const partSize = s3manager.MinUploadPartSize
+	sizes := []int64{0, 1, partSize - 1, partSize, partSize + 1, 2*partSize + 1234}
+	for _, size := range sizes {
+		for _, ps := range []int64{partSize, partSize + partSize/2} {
+			for _, concurrency := range []int{1, 4} {
+				size, ps, concurrency := size, ps, concurrency
+				name := fmt.Sprintf("size=%d,part=%d,concurrency=%d", size, ps, concurrency)
+				t.Run("UploadDownload/"+name, func(t *testing.T) {
+					api := newAPI(t)
+					data := conformanceData(size)
+					uploadConformance(t, api, bucket, "obj", data, ps, concurrency)
+					if got := downloadConformance(t, api, bucket, "obj", nil, ps, concurrency); !bytes.Equal(got, data) {
+						t.Errorf("downloaded %d bytes, differing from the %d uploaded", len(got), len(data))
+					}
+				})
+			}
+		}
+	}
+	t.Run("DownloadRange", func(t *testing.T) {
+		api := newAPI(t)
+		data := conformanceData(2*partSize + 1234)
+		uploadConformance(t, api, bucket, "obj", data, partSize, 4)
+		for _, r := range []struct{ start, last int64 }{
+			{0, 0}, {1, 100}, {partSize - 10, partSize + 10}, {int64(len(data)) - 1, int64(len(data)) - 1},
+		} {
+			rng := fmt.Sprintf("bytes=%d-%d", r.start, r.last)
+			if got, want := downloadConformance(t, api, bucket, "obj", &rng, partSize, 4), data[r.start:r.last+1]; !bytes.Equal(got, want) {
+				t.Errorf("%s: got %d bytes, want %d", rng, len(got), len(want))
+			}
+		}
+	})
+	for _, leaveParts := range []bool{false, true} {
+		leaveParts := leaveParts
+		t.Run(fmt.Sprintf("UploadPartFailure/leaveParts=%v", leaveParts), func(t *testing.T) {
+			api := &faultyAPI{S3API: newAPI(t), failAPI: "UploadPart", failAt: 2}
+			uploader := s3manager.NewUploaderWithClient(api, func(u *s3manager.Uploader) {
+				u.PartSize = partSize
+				u.Concurrency = 1
+				u.LeavePartsOnError = leaveParts
+			})
+			_, err := uploader.UploadWithContext(aws.BackgroundContext(), &s3manager.UploadInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String("obj"),
+				Body:   bytes.NewReader(conformanceData(3 * partSize)),
+			})
+			failure, ok := err.(s3manager.MultiUploadFailure)
+			if !ok {
+				t.Fatalf("got %v, want a MultiUploadFailure", err)
+			}
+			if _, err := api.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String("obj")}); err == nil {
+				t.Error("failed upload created an object")
+			}
+			uploads, err := api.ListMultipartUploads(&s3.ListMultipartUploadsInput{Bucket: aws.String(bucket)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var active bool
+			for _, u := range uploads.Uploads {
+				active = active || aws.StringValue(u.UploadId) == failure.UploadID()
+			}
+			if active != leaveParts {
+				t.Errorf("upload %s: got active %v, want %v", failure.UploadID(), active, leaveParts)
+			}
+		})
+	}
+	t.Run("DownloadFailure", func(t *testing.T) {
+		api := &faultyAPI{S3API: newAPI(t), failAPI: "GetObject", failAt: 2}
+		uploadConformance(t, api, bucket, "obj", conformanceData(3*partSize), partSize, 1)
+		downloader := s3manager.NewDownloaderWithClient(api, func(d *s3manager.Downloader) {
+			d.PartSize = partSize
+			d.Concurrency = 1
+		})
+		_, err := downloader.DownloadWithContext(aws.BackgroundContext(), aws.NewWriteAtBuffer(nil), &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String("obj"),
+		})
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+	t.Run("BatchDelete", func(t *testing.T) {
+		api := newAPI(t)
+		const n = 2*s3manager.DefaultBatchSize + 10
+		var objects []s3manager.BatchDeleteObject
+		for i := 0; i < n; i++ {
+			key := fmt.Sprintf("obj%03d", i)
+			uploadConformance(t, api, bucket, key, []byte(key), partSize, 1)
+			objects = append(objects, s3manager.BatchDeleteObject{
+				Object: &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)},
+			})
+		}
+		if err := s3manager.NewBatchDeleteWithClient(api).Delete(aws.BackgroundContext(),
+			&s3manager.DeleteObjectsIterator{Objects: objects}); err != nil {
+			t.Fatal(err)
+		}
+		for _, o := range objects {
+			if _, err := api.HeadObject(&s3.HeadObjectInput{Bucket: o.Object.Bucket, Key: o.Object.Key}); err == nil {
+				t.Errorf("%s: not deleted", aws.StringValue(o.Object.Key))
+			}
+		}
+	})
+	t.Run("BatchDeleteFailure", func(t *testing.T) {
+		api := &faultyAPI{S3API: newAPI(t), failAPI: "DeleteObjects", failAt: 1}
+		uploadConformance(t, api, bucket, "obj", []byte("data"), partSize, 1)
+		err := s3manager.NewBatchDeleteWithClient(api).Delete(aws.BackgroundContext(),
+			&s3manager.DeleteObjectsIterator{Objects: []s3manager.BatchDeleteObject{{
+				Object: &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String("obj")},
+			}}})
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+// conformanceData returns size bytes of deterministic, pseudo-random data.
+func conformanceData(size int64) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(size)).Read(data) // nolint: errcheck
+	return data
+}
+
+func uploadConformance(t *testing.T, api s3iface.S3API, bucket, key string, data []byte, partSize int64, concurrency int) {
+	uploader := s3manager.NewUploaderWithClient(api, func(u *s3manager.Uploader) {
+		u.PartSize = partSize
+		u.Concurrency = concurrency
+	})
+	if _, err := uploader.UploadWithContext(aws.BackgroundContext(), &s3manager.UploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	}); err != nil {
+		t.Fatalf("upload %s: %v", key, err)
+	}
+}
+
+func downloadConformance(t *testing.T, api s3iface.S3API, bucket, key string, rng *string, partSize int64, concurrency int) []byte {
+	downloader := s3manager.NewDownloaderWithClient(api, func(d *s3manager.Downloader) {
+		d.PartSize = partSize
+		d.Concurrency = concurrency
+	})
+	buf := aws.NewWriteAtBuffer(nil)
+	n, err := downloader.DownloadWithContext(aws.BackgroundContext(), buf, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Range:  rng,
+	})
+	if err != nil {
+		t.Fatalf("download %s: %v", key, err)
+	}
+	if got, want := n, int64(len(buf.Bytes())); got != want {
+		t.Errorf("download %s: got %d bytes, want %d", key, got, want)
+	}
+	return buf.Bytes()
+}
+
+// faultyAPI wraps an s3iface.S3API and fails the failAt'th (1-based) call
+// to the API named failAPI.
+type faultyAPI struct {
+	s3iface.S3API
+	failAPI string
+	failAt  int
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (f *faultyAPI) fail(api string) error {
+	if api != f.failAPI {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls != f.failAt {
+		return nil
+	}
+	return awserr.New("InjectedFailure", fmt.Sprintf("s3test: injected failure of %s call %d", api, f.calls), nil)
+}
+
+func (f *faultyAPI) UploadPartWithContext(ctx aws.Context, input *s3.UploadPartInput, opts ...request.Option) (*s3.UploadPartOutput, error) {
+	if err := f.fail("UploadPart"); err != nil {
+		return nil, err
+	}
+	return f.S3API.UploadPartWithContext(ctx, input, opts...)
+}
+
+func (f *faultyAPI) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	if err := f.fail("GetObject"); err != nil {
+		return nil, err
+	}
+	return f.S3API.GetObjectWithContext(ctx, input, opts...)
+}
+
+func (f *faultyAPI) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	if err := f.fail("DeleteObjects"); err != nil {
+		return nil, err
+	}
+	return f.S3API.DeleteObjectsWithContext(ctx, input, opts...)
+}
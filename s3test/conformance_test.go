@@ -0,0 +1,11 @@
+package s3test_test
+
+import (
+	"testing"
+
+	"github.com/grailbio/testutil/s3test"
+)
+
+func TestManagerConformance(t *testing.T) {
+	s3test.RunManagerConformance(t, testBucket, nil)
+}
@@ -0,0 +1,104 @@
+package s3test
+
+import "time"
+
+// Consistency configures an eventually consistent view of the objects
+// stored in a Client. When Client.Consistency is set, new keys, overwrites
+// and deletes are not immediately visible to ListObjectsV2, GetObject and
+// HeadObject: those requests continue to observe the previous state of a key
+// until the write becomes visible. A write becomes visible once both Delay
+// has elapsed on Client.Clock and Reads requests have observed the previous
+// state. Writing a key again before its previous write became visible
+// restarts both counters, but readers keep observing the last visible state.
+//
+// The test inspection methods (GetFile, GetFileContentBytes, etc.) always
+// observe the latest state.
+type Consistency struct {
+	// Delay is the time, as measured by Client.Clock, for which a write
+	// remains invisible.
+	Delay time.Duration
+
+	// Reads is the number of read requests that observe the previous state
+	// of a key after it is written. A ListObjectsV2 request counts as a read
+	// of every key that matches its prefix.
+	Reads int
+}
+
+// pendingWrite records the previously visible state of a key whose latest
+// write is not yet visible.
+type pendingWrite struct {
+	prev      FileContent
+	prevOK    bool // whether the key existed before the write
+	visibleAt time.Time
+	readsLeft int
+}
+
+func (p *pendingWrite) visible(now time.Time) bool {
+	return !now.Before(p.visibleAt) && p.readsLeft <= 0
+}
+
+// putLocked stores fc under key. REQUIRES: c.m is locked.
+func (c *Client) putLocked(key string, fc FileContent) {
+	c.recordWriteLocked(key)
+	c.content[key] = fc
+}
+
+// deleteLocked removes key. REQUIRES: c.m is locked.
+func (c *Client) deleteLocked(key string) {
+	c.recordWriteLocked(key)
+	delete(c.content, key)
+}
+
+// recordWriteLocked remembers the visible state of key before it is
+// modified. REQUIRES: c.m is locked.
+func (c *Client) recordWriteLocked(key string) {
+	if c.Consistency == nil {
+		return
+	}
+	now := c.now()
+	p, ok := c.pending[key]
+	if !ok || p.visible(now) {
+		prev, prevOK := c.content[key]
+		p = &pendingWrite{prev: prev, prevOK: prevOK}
+		c.pending[key] = p
+	}
+	p.visibleAt = now.Add(c.Consistency.Delay)
+	p.readsLeft = c.Consistency.Reads
+}
+
+// lookupLocked returns the state of key as observed by a read request.
+// REQUIRES: c.m is locked.
+func (c *Client) lookupLocked(key string) (FileContent, bool) {
+	if p, ok := c.pending[key]; ok {
+		if !p.visible(c.now()) {
+			p.readsLeft--
+			return p.prev, p.prevOK
+		}
+		delete(c.pending, key)
+	}
+	f, ok := c.content[key]
+	return f, ok
+}
+
+// readFile is like GetFile, but returns the state of key as observed by a
+// read request.
+func (c *Client) readFile(key string) (FileContent, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.lookupLocked(key)
+}
+
+// visibleKeysLocked returns every key that may be visible to a read request.
+// REQUIRES: c.m is locked.
+func (c *Client) visibleKeysLocked() []string {
+	keys := make([]string, 0, len(c.content)+len(c.pending))
+	for key := range c.content {
+		keys = append(keys, key)
+	}
+	for key := range c.pending {
+		if _, ok := c.content[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,124 @@
+package s3test_test
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil/s3test"
+)
+
+func listKeys(t *testing.T, client *s3test.Client, prefix string) []string {
+	out, err := client.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket: aws.String(testBucket),
+		Prefix: aws.String(prefix),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, obj := range out.Contents {
+		keys = append(keys, aws.StringValue(obj.Key))
+	}
+	return keys
+}
+
+func getString(t *testing.T, client *s3test.Client, key string) (string, error) {
+	out, err := client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b), nil
+}
+
+func isNoSuchKey(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == "NoSuchKey"
+}
+
+func TestConsistencyDelay(t *testing.T) {
+	clock := s3test.NewFakeClock(time.Unix(1000, 0))
+	client := s3test.NewClient(t, testBucket)
+	client.Clock = clock
+	client.Consistency = &s3test.Consistency{Delay: time.Minute}
+
+	client.SetFile("a", []byte("v1"), "")
+	if keys := listKeys(t, client, ""); len(keys) != 0 {
+		t.Errorf("got %v, want no keys", keys)
+	}
+	if _, err := getString(t, client, "a"); !isNoSuchKey(err) {
+		t.Errorf("got %v, want NoSuchKey", err)
+	}
+	if _, ok := client.GetFile("a"); !ok {
+		t.Error("GetFile should observe the latest state")
+	}
+
+	clock.Advance(time.Minute)
+	if got, err := getString(t, client, "a"); err != nil || got != "v1" {
+		t.Errorf("got %q, %v, want v1", got, err)
+	}
+
+	// Overwrites are stale until the delay has elapsed.
+	client.SetFile("a", []byte("v2"), "")
+	clock.Advance(30 * time.Second)
+	if got, _ := getString(t, client, "a"); got != "v1" {
+		t.Errorf("got %q, want v1", got)
+	}
+	// A second overwrite restarts the delay but keeps the visible state.
+	client.SetFile("a", []byte("v3"), "")
+	clock.Advance(45 * time.Second)
+	if got, _ := getString(t, client, "a"); got != "v1" {
+		t.Errorf("got %q, want v1", got)
+	}
+	clock.Advance(15 * time.Second)
+	if got, _ := getString(t, client, "a"); got != "v3" {
+		t.Errorf("got %q, want v3", got)
+	}
+
+	// Deletes are not visible until the delay has elapsed either.
+	if _, err := client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(testBucket), Key: aws.String("a")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(testBucket), Key: aws.String("a")}); err != nil {
+		t.Errorf("got %v, want stale object", err)
+	}
+	if keys := listKeys(t, client, ""); len(keys) != 1 {
+		t.Errorf("got %v, want [a]", keys)
+	}
+	clock.Advance(time.Minute)
+	if _, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(testBucket), Key: aws.String("a")}); !isNoSuchKey(err) {
+		t.Errorf("got %v, want NoSuchKey", err)
+	}
+	if keys := listKeys(t, client, ""); len(keys) != 0 {
+		t.Errorf("got %v, want no keys", keys)
+	}
+}
+
+func TestConsistencyReads(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	client.Consistency = &s3test.Consistency{Reads: 2}
+
+	client.SetFile("a", []byte("v1"), "")
+	if keys := listKeys(t, client, ""); len(keys) != 0 {
+		t.Errorf("got %v, want no keys", keys)
+	}
+	if _, err := getString(t, client, "a"); !isNoSuchKey(err) {
+		t.Errorf("got %v, want NoSuchKey", err)
+	}
+	if got, err := getString(t, client, "a"); err != nil || got != "v1" {
+		t.Errorf("got %q, %v, want v1", got, err)
+	}
+	if keys := listKeys(t, client, ""); len(keys) != 1 {
+		t.Errorf("got %v, want [a]", keys)
+	}
+}
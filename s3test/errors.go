@@ -0,0 +1,76 @@
+package s3test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// violation reports a request that real S3 would reject because the caller
+// misused the protocol, e.g., by naming the wrong bucket or an unknown upload.
+// It returns err, the error S3 would return; in strict mode (Client.Strict)
+// it also fails the test.
+func (c *Client) violation(err error) error {
+	if c.Strict {
+		c.t.Errorf("s3test: %v", err)
+	}
+	return err
+}
+
+// checkBucket returns NoSuchBucket if bucket is not the client's bucket.
+func (c *Client) checkBucket(api string, bucket *string) error {
+	if got, want := aws.StringValue(bucket), c.bucket; got != want {
+		return c.violation(awserr.New("NoSuchBucket",
+			fmt.Sprintf("%s received unexpected bucket got: %s want %s", api, got, want), nil))
+	}
+	return nil
+}
+
+// copySourceKey returns the key of a CopySource value of the form
+// "bucket/key".
+func (c *Client) copySourceKey(api, source string) (string, error) {
+	// S3 accepts a URL-encoded copy source, optionally with a leading slash.
+	source = strings.TrimPrefix(source, "/")
+	if !strings.HasPrefix(source, c.bucket+"/") {
+		return "", c.violation(awserr.New("NoSuchBucket",
+			fmt.Sprintf("%s expected copy source from the same bucket, got: %v", api, source), nil))
+	}
+	return strings.TrimPrefix(source, c.bucket+"/"), nil
+}
+
+// badDigest returns the error S3 returns when a checksum sent with a request
+// does not match the body.
+func (c *Client) badDigest(api string, err error) error {
+	return c.violation(awserr.New("BadDigest", fmt.Sprintf("%s: %v", api, err), nil))
+}
+
+// resolveRange returns the first and last byte offsets selected by the value
+// of a Range header for an object of the given size. It returns
+// InvalidRange, with status 416, if the range is malformed or not
+// satisfiable.
+func (c *Client) resolveRange(api string, rng *string, size int64) (start, last int64, err error) {
+	if rng == nil {
+		return 0, size - 1, nil
+	}
+	start, last, err = parseByteRange(*rng, size)
+	if err == nil {
+		if start < 0 {
+			// Suffix ranges longer than the object select the whole object.
+			start = 0
+		}
+		if last >= size {
+			last = size - 1
+		}
+		if start > last {
+			err = fmt.Errorf("range %s not satisfiable for object of size %d", *rng, size)
+		}
+	}
+	if err != nil {
+		return 0, 0, c.violation(awserr.NewRequestFailure(awserr.New("InvalidRange",
+			fmt.Sprintf("%s: %v", api, err), nil), http.StatusRequestedRangeNotSatisfiable, ""))
+	}
+	return start, last, nil
+}
@@ -0,0 +1,181 @@
+package s3test_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil/expect"
+	"github.com/grailbio/testutil/s3test"
+)
+
+func TestMisuseErrors(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	client.SetFile("a", []byte("0123456789"), "")
+
+	_, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String("other"), Key: aws.String("a")})
+	expect.EQ(t, awsErrCode(err), "NoSuchBucket")
+	_, err = client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("other"), Key: aws.String("a")})
+	expect.EQ(t, awsErrCode(err), "NoSuchBucket")
+	_, err = client.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String("other")})
+	expect.EQ(t, awsErrCode(err), "NoSuchBucket")
+	_, err = client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String("other"),
+		Key:    aws.String("b"),
+		Body:   bytes.NewReader(nil),
+	})
+	expect.EQ(t, awsErrCode(err), "NoSuchBucket")
+	_, err = client.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("b"),
+		CopySource: aws.String("other/a"),
+	})
+	expect.EQ(t, awsErrCode(err), "NoSuchBucket")
+	_, err = client.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("b"),
+		CopySource: aws.String(testBucket + "/missing"),
+	})
+	expect.EQ(t, awsErrCode(err), "NoSuchKey")
+
+	_, err = client.PutObject(&s3.PutObjectInput{
+		Bucket:   aws.String(testBucket),
+		Key:      aws.String("b"),
+		Body:     bytes.NewReader([]byte("contents")),
+		Metadata: map[string]*string{"Content-Sha256": aws.String("not the checksum")},
+	})
+	expect.EQ(t, awsErrCode(err), "BadDigest")
+	if _, ok := client.GetFile("b"); ok {
+		t.Error("object with a bad digest should not be stored")
+	}
+
+	_, err = client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("mp"),
+		UploadId:   aws.String("unknown"),
+		PartNumber: aws.Int64(1),
+		Body:       bytes.NewReader([]byte("part")),
+	})
+	expect.EQ(t, awsErrCode(err), "NoSuchUpload")
+	id := createUpload(t, client, "mp")
+	_, err = completeUpload(client, "other-key", id)
+	expect.EQ(t, awsErrCode(err), "NoSuchUpload")
+}
+
+func TestRanges(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	client.SetFile("a", []byte("0123456789"), "")
+
+	for _, test := range []struct {
+		rng, want, contentRange string
+	}{
+		{"bytes=2-5", "2345", "bytes 2-5/10"},
+		{"bytes=7-", "789", "bytes 7-9/10"},
+		{"bytes=-3", "789", "bytes 7-9/10"},
+		{"bytes=-30", "0123456789", ""},
+		{"bytes=8-100", "89", "bytes 8-9/10"},
+		{"bytes=0-9", "0123456789", ""},
+	} {
+		// The plain and context variants of GetObject share the implementation
+		// of ranges.
+		for _, get := range []func(*s3.GetObjectInput) (*s3.GetObjectOutput, error){
+			client.GetObject,
+			func(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+				return client.GetObjectWithContext(ctx, input)
+			},
+		} {
+			out, err := get(&s3.GetObjectInput{
+				Bucket: aws.String(testBucket),
+				Key:    aws.String("a"),
+				Range:  aws.String(test.rng),
+			})
+			if err != nil {
+				t.Errorf("%s: %v", test.rng, err)
+				continue
+			}
+			data, err := ioutil.ReadAll(out.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect.EQ(t, string(data), test.want)
+			expect.EQ(t, aws.Int64Value(out.ContentLength), int64(len(test.want)))
+			expect.EQ(t, aws.StringValue(out.ContentRange), test.contentRange)
+		}
+	}
+
+	for _, rng := range []string{"bytes=10-", "bytes=5-2", "lines=1-2", "bytes=1-2,4-5", "bytes=x-"} {
+		_, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(testBucket),
+			Key:    aws.String("a"),
+			Range:  aws.String(rng),
+		})
+		expect.EQ(t, awsErrCode(err), "InvalidRange")
+		expect.EQ(t, statusCode(err), http.StatusRequestedRangeNotSatisfiable)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	// In strict mode, well-formed requests, including those that fail for
+	// reasons other than misuse, do not fail the test.
+	client := s3test.NewClient(t, testBucket)
+	client.Strict = true
+	client.SetFile("a", []byte("0123456789"), "")
+	if _, err := client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("a"),
+		Range:  aws.String("bytes=1-2"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(testBucket), Key: aws.String("missing")})
+	expect.EQ(t, awsErrCode(err), "NoSuchKey")
+}
+
+// TestStrictCompleteMultipartUpload checks that strict mode fails the test
+// for a completion with unsorted or missing parts. The completion runs in a
+// child process, since the failure cannot otherwise be observed.
+func TestStrictCompleteMultipartUpload(t *testing.T) {
+	tests := []struct {
+		name, code string
+		parts      func(part1, part2 *s3.CompletedPart) []*s3.CompletedPart
+	}{
+		{"unsorted", "InvalidPartOrder", func(part1, part2 *s3.CompletedPart) []*s3.CompletedPart {
+			return []*s3.CompletedPart{part2, part1}
+		}},
+		{"missing", "InvalidPart", func(part1, part2 *s3.CompletedPart) []*s3.CompletedPart {
+			return []*s3.CompletedPart{part1, {PartNumber: aws.Int64(3), ETag: part2.ETag}}
+		}},
+	}
+	if child := os.Getenv("S3TEST_STRICT_CHILD"); child != "" {
+		for _, test := range tests {
+			if test.name != child {
+				continue
+			}
+			client := s3test.NewClient(t, testBucket)
+			client.Strict = true
+			id := createUpload(t, client, "obj")
+			part1 := uploadPart(t, client, "obj", id, 1, bytes.Repeat([]byte{'a'}, s3test.DefaultMinPartSize))
+			part2 := uploadPart(t, client, "obj", id, 2, []byte("tail"))
+			_, err := completeUpload(client, "obj", id, test.parts(part1, part2)...)
+			expect.EQ(t, awsErrCode(err), test.code)
+		}
+		return
+	}
+	for _, test := range tests {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestStrictCompleteMultipartUpload$")
+		cmd.Env = append(os.Environ(), "S3TEST_STRICT_CHILD="+test.name)
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			t.Errorf("%s: strict mode did not fail the test:\n%s", test.name, out)
+		}
+		if !strings.Contains(string(out), "s3test: "+test.code+":") {
+			t.Errorf("%s: got output\n%s\nwant an error for %s", test.name, out, test.code)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package s3test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the events emitted by a Client, as in S3 event notifications.
+const (
+	EventObjectCreatedPut                       = "s3:ObjectCreated:Put"
+	EventObjectCreatedCopy                      = "s3:ObjectCreated:Copy"
+	EventObjectCreatedCompleteMultipartUpload   = "s3:ObjectCreated:CompleteMultipartUpload"
+	EventObjectRemovedDelete                    = "s3:ObjectRemoved:Delete"
+	EventObjectRemovedDeleteMarkerCreated       = "s3:ObjectRemoved:DeleteMarkerCreated"
+	EventLifecycleExpirationDelete              = "s3:LifecycleExpiration:Delete"
+	EventLifecycleExpirationDeleteMarkerCreated = "s3:LifecycleExpiration:DeleteMarkerCreated"
+)
+
+// Event describes a change to an object in the bucket, in the manner of an
+// S3 event notification record.
+type Event struct {
+	// Name is the event name, e.g., EventObjectCreatedPut.
+	Name string
+	// Time is the time of the event according to the Client's Clock.
+	Time   time.Time
+	Bucket string
+	Key    string
+	// Size and ETag describe the new object; they are empty for removals.
+	Size int64
+	ETag string
+	// Sequencer orders events: the sequencers of two events for the same
+	// key (in fact, for any key) compare, as strings, in the order in which
+	// the events occurred.
+	Sequencer string
+}
+
+// EventFilter selects the events delivered to a subscription.
+type EventFilter struct {
+	// Events lists the event names of interest. A name may end with "*" to
+	// select all events of a kind, e.g., "s3:ObjectCreated:*". Empty means
+	// all events.
+	Events []string
+	// Prefix and Suffix, if non-empty, restrict the events to keys with the
+	// given prefix and suffix.
+	Prefix, Suffix string
+}
+
+func (f EventFilter) matches(e Event) bool {
+	if !strings.HasPrefix(e.Key, f.Prefix) || !strings.HasSuffix(e.Key, f.Suffix) {
+		return false
+	}
+	if len(f.Events) == 0 {
+		return true
+	}
+	for _, name := range f.Events {
+		if name == e.Name || strings.HasSuffix(name, "*") && strings.HasPrefix(e.Name, strings.TrimSuffix(name, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// subscription delivers events to a callback, in order, from its own
+// goroutine, so that writers never wait for subscribers.
+type subscription struct {
+	filter EventFilter
+	fn     func(Event)
+	stop   chan struct{} // closed on unsubscribe
+	done   chan struct{} // closed when run returns
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []Event
+	closed bool
+}
+
+func (s *subscription) push(e Event) {
+	s.mu.Lock()
+	s.queue = append(s.queue, e)
+	s.mu.Unlock()
+	s.cond.Signal()
+}
+
+func (s *subscription) run() {
+	defer close(s.done)
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		e := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		s.fn(e)
+	}
+}
+
+// Subscribe arranges for fn to be called with each subsequent event that
+// matches filter. As with S3, events are delivered asynchronously: fn is
+// called from a separate goroutine, one event at a time, in the order in
+// which the events occurred. Events are emitted for objects written by
+// PutObject, CopyObject and CompleteMultipartUpload, removed by
+// DeleteObject(s), and expired by the lifecycle configuration (see
+// ApplyLifecycle); objects set directly by the test, e.g., by SetFile, do
+// not emit events.
+//
+// The returned function cancels the subscription. It waits for a call to fn
+// in progress, if any, to return; undelivered events are dropped.
+func (c *Client) Subscribe(filter EventFilter, fn func(Event)) (unsubscribe func()) {
+	s := newSubscription(filter)
+	s.fn = fn
+	return c.subscribe(s)
+}
+
+// Events is like Subscribe, but delivers the events on the returned
+// channel, which is closed when the subscription is canceled. Events are
+// buffered without limit until they are received.
+func (c *Client) Events(filter EventFilter) (events <-chan Event, unsubscribe func()) {
+	ch := make(chan Event)
+	s := newSubscription(filter)
+	s.fn = func(e Event) {
+		select {
+		case ch <- e:
+		case <-s.stop:
+		}
+	}
+	cancel := c.subscribe(s)
+	return ch, func() {
+		cancel()
+		close(ch)
+	}
+}
+
+func newSubscription(filter EventFilter) *subscription {
+	s := &subscription{
+		filter: filter,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// subscribe starts delivering events to s and returns a function that
+// cancels the subscription.
+func (c *Client) subscribe(s *subscription) (unsubscribe func()) {
+	c.m.Lock()
+	c.subscriptions = append(c.subscriptions, s)
+	c.m.Unlock()
+	go s.run()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.m.Lock()
+			for i, other := range c.subscriptions {
+				if other == s {
+					c.subscriptions = append(c.subscriptions[:i], c.subscriptions[i+1:]...)
+					break
+				}
+			}
+			c.m.Unlock()
+			s.mu.Lock()
+			s.closed = true
+			s.mu.Unlock()
+			close(s.stop)
+			s.cond.Signal()
+			<-s.done
+		})
+	}
+}
+
+// notifyLocked emits an event of the given name for key, whose new content,
+// if any, is fc. REQUIRES: c.m is locked.
+func (c *Client) notifyLocked(name, key string, fc *FileContent) {
+	c.eventSeq++
+	e := Event{
+		Name:      name,
+		Time:      c.now(),
+		Bucket:    c.bucket,
+		Key:       key,
+		Sequencer: fmt.Sprintf("%016X", c.eventSeq),
+	}
+	if fc != nil && len(c.subscriptions) > 0 {
+		e.Size = fc.Content.Size()
+		e.ETag = fc.etag()
+	}
+	for _, s := range c.subscriptions {
+		if s.filter.matches(e) {
+			s.push(e)
+		}
+	}
+}
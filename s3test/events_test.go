@@ -0,0 +1,111 @@
+package s3test_test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil/expect"
+	"github.com/grailbio/testutil/s3test"
+)
+
+func putString(t *testing.T, client *s3test.Client, key, data string) {
+	if _, err := client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader([]byte(data)),
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	client.MinPartSize = 1
+	events, unsubscribe := client.Events(s3test.EventFilter{})
+	defer unsubscribe()
+
+	putString(t, client, "a", "contents")
+	_, err := client.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("b"),
+		CopySource: aws.String(testBucket + "/a"),
+	})
+	expect.NoError(t, err)
+	id := createUpload(t, client, "mp")
+	p1 := uploadPart(t, client, "mp", id, 1, []byte("part1"))
+	if _, err := completeUpload(client, "mp", id, p1); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(testBucket),
+		Delete: &s3.Delete{Objects: []*s3.ObjectIdentifier{{Key: aws.String("a")}}},
+	})
+	expect.NoError(t, err)
+	// Test setup does not emit events.
+	client.SetFile("untracked", []byte("x"), "")
+
+	want := []struct {
+		name, key string
+		size      int64
+	}{
+		{s3test.EventObjectCreatedPut, "a", 8},
+		{s3test.EventObjectCreatedCopy, "b", 8},
+		{s3test.EventObjectCreatedCompleteMultipartUpload, "mp", 5},
+		{s3test.EventObjectRemovedDelete, "a", 0},
+	}
+	var last string
+	for _, w := range want {
+		e := <-events
+		expect.EQ(t, e.Name, w.name)
+		expect.EQ(t, e.Bucket, testBucket)
+		expect.EQ(t, e.Key, w.key)
+		expect.EQ(t, e.Size, w.size)
+		if w.key != "a" { // a has since been deleted
+			expect.EQ(t, e.ETag, client.MustGetFile(w.key).ETag)
+		}
+		expect.GT(t, e.Sequencer, last)
+		last = e.Sequencer
+	}
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event %+v", e)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	var (
+		mu   sync.Mutex
+		keys []string
+		done = make(chan bool)
+	)
+	unsubscribe := client.Subscribe(s3test.EventFilter{
+		Events: []string{"s3:ObjectCreated:*"},
+		Prefix: "logs/",
+		Suffix: ".gz",
+	}, func(e s3test.Event) {
+		mu.Lock()
+		keys = append(keys, e.Key)
+		mu.Unlock()
+		if e.Key == "logs/last.gz" {
+			close(done)
+		}
+	})
+	putString(t, client, "logs/1.gz", "1")
+	putString(t, client, "logs/2.txt", "2")
+	putString(t, client, "other/3.gz", "3")
+	_, err := client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(testBucket), Key: aws.String("logs/1.gz")})
+	expect.NoError(t, err)
+	putString(t, client, "logs/last.gz", "last")
+	<-done
+	unsubscribe()
+	putString(t, client, "logs/after.gz", "after")
+	mu.Lock()
+	defer mu.Unlock()
+	expect.EQ(t, keys, []string{"logs/1.gz", "logs/last.gz"})
+}
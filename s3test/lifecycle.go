@@ -0,0 +1,442 @@
+package s3test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// maxLifecycleRules is the maximum number of rules in a lifecycle
+// configuration.
+const maxLifecycleRules = 1000
+
+func malformedLifecycle(format string, args ...interface{}) error {
+	return awserr.New("MalformedXML", fmt.Sprintf(format, args...), nil)
+}
+
+// checkLifecycleRules validates rules as S3 does when they are put.
+func checkLifecycleRules(rules []*s3.LifecycleRule) error {
+	if len(rules) == 0 || len(rules) > maxLifecycleRules {
+		return malformedLifecycle("a lifecycle configuration must have between 1 and %d rules, got %d",
+			maxLifecycleRules, len(rules))
+	}
+	ids := map[string]bool{}
+	for _, rule := range rules {
+		id := aws.StringValue(rule.ID)
+		if id != "" {
+			if ids[id] {
+				return awserr.New("InvalidArgument", fmt.Sprintf("rule ID %q must be unique", id), nil)
+			}
+			ids[id] = true
+		}
+		switch status := aws.StringValue(rule.Status); status {
+		case s3.ExpirationStatusEnabled, s3.ExpirationStatusDisabled:
+		default:
+			return malformedLifecycle("rule %q: invalid status %q", id, status)
+		}
+		if rule.Expiration == nil && rule.AbortIncompleteMultipartUpload == nil &&
+			rule.NoncurrentVersionExpiration == nil && rule.Transitions == nil &&
+			rule.NoncurrentVersionTransitions == nil {
+			return awserr.New("InvalidRequest",
+				fmt.Sprintf("rule %q: at least one action needs to be specified", id), nil)
+		}
+		if exp := rule.Expiration; exp != nil {
+			if (exp.Days != nil) == (exp.Date != nil) && !aws.BoolValue(exp.ExpiredObjectDeleteMarker) {
+				return malformedLifecycle("rule %q: expiration must specify exactly one of Days and Date", id)
+			}
+			if exp.Days != nil && *exp.Days <= 0 {
+				return awserr.New("InvalidArgument",
+					fmt.Sprintf("rule %q: expiration days must be a positive integer", id), nil)
+			}
+		}
+		if abort := rule.AbortIncompleteMultipartUpload; abort != nil && aws.Int64Value(abort.DaysAfterInitiation) <= 0 {
+			return awserr.New("InvalidArgument",
+				fmt.Sprintf("rule %q: DaysAfterInitiation must be a positive integer", id), nil)
+		}
+		if exp := rule.NoncurrentVersionExpiration; exp != nil && aws.Int64Value(exp.NoncurrentDays) <= 0 {
+			return awserr.New("InvalidArgument",
+				fmt.Sprintf("rule %q: NoncurrentDays must be a positive integer", id), nil)
+		}
+		for _, t := range rule.NoncurrentVersionTransitions {
+			if t.NoncurrentDays == nil || *t.NoncurrentDays < 0 {
+				return awserr.New("InvalidArgument",
+					fmt.Sprintf("rule %q: NoncurrentDays must be a non-negative integer", id), nil)
+			}
+		}
+	}
+	return nil
+}
+
+// lifecycleDeadline returns the time at which an action that applies days
+// after t takes effect. As with S3, the time is rounded up to the next
+// midnight UTC.
+func lifecycleDeadline(t time.Time, days int64) time.Time {
+	deadline := t.Add(time.Duration(days) * 24 * time.Hour)
+	midnight := deadline.Truncate(24 * time.Hour)
+	if midnight.Before(deadline) {
+		midnight = midnight.Add(24 * time.Hour)
+	}
+	return midnight
+}
+
+// lifecycleFilter returns the prefix and tags selected by rule.
+func lifecycleFilter(rule *s3.LifecycleRule) (prefix string, tags []*s3.Tag) {
+	prefix = aws.StringValue(rule.Prefix)
+	if f := rule.Filter; f != nil {
+		switch {
+		case f.And != nil:
+			prefix, tags = aws.StringValue(f.And.Prefix), f.And.Tags
+		case f.Tag != nil:
+			tags = []*s3.Tag{f.Tag}
+		default:
+			prefix = aws.StringValue(f.Prefix)
+		}
+	}
+	return
+}
+
+// lifecycleMatches reports whether the object stored under key is subject
+// to rule.
+func lifecycleMatches(rule *s3.LifecycleRule, key string, f FileContent) bool {
+	prefix, tags := lifecycleFilter(rule)
+	if !strings.HasPrefix(key, prefix) {
+		return false
+	}
+	for _, tag := range tags {
+		if v, ok := f.Tags[aws.StringValue(tag.Key)]; !ok || v != aws.StringValue(tag.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Advance advances the client's Clock, which must be a *FakeClock, by d and
+// then applies the bucket's lifecycle configuration (see
+// ApplyLifecycle). It allows tests to assert what remains of the bucket
+// after some number of simulated days.
+func (c *Client) Advance(d time.Duration) {
+	clock, ok := c.Clock.(*FakeClock)
+	if !ok {
+		c.t.Fatalf("s3test.Advance: Client.Clock must be a *FakeClock, got %T", c.Clock)
+		return
+	}
+	clock.Advance(d)
+	c.ApplyLifecycle()
+}
+
+// ApplyLifecycle applies the bucket's lifecycle configuration at the
+// current time: it deletes the objects whose Expiration rule has come due
+// (in a versioned bucket, they become noncurrent behind a delete marker),
+// moves objects to the storage class of their latest due Transition (see
+// RestoreObject for archival classes), and aborts the multipart uploads
+// whose AbortIncompleteMultipartUpload rule has come due. In a versioned
+// bucket (see PutBucketVersioning), it also permanently deletes the
+// noncurrent versions whose NoncurrentVersionExpiration has come due, counted
+// from the time they became noncurrent, applies NoncurrentVersionTransitions
+// likewise, and removes delete markers that are the only version of their
+// key if ExpiredObjectDeleteMarker is set. S3 applies lifecycle rules
+// asynchronously; s3test applies them only when ApplyLifecycle or Advance is
+// called.
+func (c *Client) ApplyLifecycle() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	now := c.now()
+	for _, rule := range c.lifecycle {
+		if aws.StringValue(rule.Status) != s3.ExpirationStatusEnabled {
+			continue
+		}
+		if exp := rule.Expiration; exp != nil && (exp.Days != nil || exp.Date != nil) {
+			for key, f := range c.content {
+				if !lifecycleMatches(rule, key, f) {
+					continue
+				}
+				var deadline time.Time
+				if exp.Date != nil {
+					deadline = *exp.Date
+				} else {
+					deadline = lifecycleDeadline(f.LastModified, *exp.Days)
+				}
+				if now.Before(deadline) {
+					continue
+				}
+				if _, marker := c.deleteCurrentLocked(key); marker {
+					c.notifyLocked(EventLifecycleExpirationDeleteMarkerCreated, key, nil)
+				} else {
+					c.notifyLocked(EventLifecycleExpirationDelete, key, nil)
+				}
+			}
+		}
+		if exp := rule.Expiration; exp != nil && aws.BoolValue(exp.ExpiredObjectDeleteMarker) {
+			// A delete marker expires once it is the only version of its
+			// key.
+			for key, versions := range c.versions {
+				if _, ok := c.content[key]; !ok && len(versions) == 1 && versions[0].deleteMarker &&
+					lifecycleMatches(rule, key, versions[0].FileContent) {
+					delete(c.versions, key)
+				}
+			}
+		}
+		if exp := rule.NoncurrentVersionExpiration; exp != nil {
+			for key, versions := range c.versions {
+				var kept []objectVersion
+				for _, v := range versions {
+					if !v.noncurrent.IsZero() && lifecycleMatches(rule, key, v.FileContent) &&
+						!now.Before(lifecycleDeadline(v.noncurrent, *exp.NoncurrentDays)) {
+						if !v.deleteMarker {
+							c.notifyLocked(EventLifecycleExpirationDelete, key, nil)
+						}
+						continue
+					}
+					kept = append(kept, v)
+				}
+				c.setVersionsLocked(key, kept)
+			}
+		}
+		if len(rule.NoncurrentVersionTransitions) > 0 {
+			for key, versions := range c.versions {
+				for i, v := range versions {
+					if v.noncurrent.IsZero() || v.deleteMarker || !lifecycleMatches(rule, key, v.FileContent) {
+						continue
+					}
+					if class := noncurrentTransition(rule.NoncurrentVersionTransitions, v.noncurrent, now); class != "" {
+						versions[i].StorageClass = class
+					}
+				}
+			}
+		}
+		if len(rule.Transitions) > 0 {
+			for key, f := range c.content {
+				if !lifecycleMatches(rule, key, f) {
+					continue
+				}
+				if class := transitionLocked(rule.Transitions, f, now); class != "" && class != f.StorageClass {
+					f.StorageClass = class
+					f.RestoreReady, f.RestoreExpiry = time.Time{}, time.Time{}
+					c.putLocked(key, f)
+				}
+			}
+		}
+		if abort := rule.AbortIncompleteMultipartUpload; abort != nil {
+			prefix, _ := lifecycleFilter(rule)
+			for _, r := range c.uploads {
+				if r.status != multipartUploadActive || !strings.HasPrefix(r.key, prefix) {
+					continue
+				}
+				if !now.Before(lifecycleDeadline(r.initiated, *abort.DaysAfterInitiation)) {
+					r.status = multipartUploadAborted
+					r.partial = nil
+				}
+			}
+		}
+	}
+}
+
+// transitionLocked returns the storage class of the latest of transitions
+// that is due for f at time now, or "" if there is none.
+func transitionLocked(transitions []*s3.Transition, f FileContent, now time.Time) string {
+	var (
+		class  string
+		latest time.Time
+	)
+	for _, t := range transitions {
+		var deadline time.Time
+		switch {
+		case t.Date != nil:
+			deadline = *t.Date
+		case t.Days != nil:
+			deadline = lifecycleDeadline(f.LastModified, *t.Days)
+		default:
+			continue
+		}
+		if !now.Before(deadline) && !deadline.Before(latest) {
+			class, latest = aws.StringValue(t.StorageClass), deadline
+		}
+	}
+	return class
+}
+
+// noncurrentTransition returns the storage class of the latest of
+// transitions that is due at time now for a version that became noncurrent
+// at time noncurrent, or "" if there is none.
+func noncurrentTransition(transitions []*s3.NoncurrentVersionTransition, noncurrent, now time.Time) string {
+	var (
+		class  string
+		latest time.Time
+	)
+	for _, t := range transitions {
+		deadline := lifecycleDeadline(noncurrent, *t.NoncurrentDays)
+		if !now.Before(deadline) && !deadline.Before(latest) {
+			class, latest = aws.StringValue(t.StorageClass), deadline
+		}
+	}
+	return class
+}
+
+// PutBucketLifecycleConfiguration replaces the bucket's lifecycle
+// configuration. See ApplyLifecycle.
+func (c *Client) PutBucketLifecycleConfiguration(input *s3.PutBucketLifecycleConfigurationInput) (output *s3.PutBucketLifecycleConfigurationOutput, err error) {
+	rec := c.record("PutBucketLifecycleConfiguration", input)
+	defer rec.done(&output, &err)
+	return c.putBucketLifecycleConfiguration(input)
+}
+
+// putBucketLifecycleConfiguration implements PutBucketLifecycleConfiguration and PutBucketLifecycleConfigurationRequest.
+func (c *Client) putBucketLifecycleConfiguration(input *s3.PutBucketLifecycleConfigurationInput) (output *s3.PutBucketLifecycleConfigurationOutput, err error) {
+	if err := c.startRequest("PutBucketLifecycleConfiguration", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("PutBucketLifecycleConfiguration", input.Bucket); err != nil {
+		return nil, err
+	}
+	var rules []*s3.LifecycleRule
+	if input.LifecycleConfiguration != nil {
+		rules = input.LifecycleConfiguration.Rules
+	}
+	if err := checkLifecycleRules(rules); err != nil {
+		return nil, err
+	}
+	// Copy the rules so that later changes by the caller have no effect.
+	var config s3.BucketLifecycleConfiguration
+	awsutil.Copy(&config, input.LifecycleConfiguration)
+	c.m.Lock()
+	c.lifecycle = config.Rules
+	c.m.Unlock()
+	return &s3.PutBucketLifecycleConfigurationOutput{}, nil
+}
+
+// PutBucketLifecycleConfigurationRequest implements the request variant of
+// PutBucketLifecycleConfiguration.
+func (c *Client) PutBucketLifecycleConfigurationRequest(input *s3.PutBucketLifecycleConfigurationInput) (req *request.Request, output *s3.PutBucketLifecycleConfigurationOutput) {
+	req, output = c.svc.PutBucketLifecycleConfigurationRequest(input)
+	rec := c.record("PutBucketLifecycleConfiguration", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("PutBucketLifecycleConfigurationRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.putBucketLifecycleConfiguration(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// PutBucketLifecycleConfigurationWithContext implements the corresponding
+// s3iface.API method.
+func (c *Client) PutBucketLifecycleConfigurationWithContext(ctx aws.Context, input *s3.PutBucketLifecycleConfigurationInput, opts ...request.Option) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	req, out := c.PutBucketLifecycleConfigurationRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
+
+// GetBucketLifecycleConfiguration returns the bucket's lifecycle
+// configuration.
+func (c *Client) GetBucketLifecycleConfiguration(input *s3.GetBucketLifecycleConfigurationInput) (output *s3.GetBucketLifecycleConfigurationOutput, err error) {
+	rec := c.record("GetBucketLifecycleConfiguration", input)
+	defer rec.done(&output, &err)
+	return c.getBucketLifecycleConfiguration(input)
+}
+
+// getBucketLifecycleConfiguration implements GetBucketLifecycleConfiguration and GetBucketLifecycleConfigurationRequest.
+func (c *Client) getBucketLifecycleConfiguration(input *s3.GetBucketLifecycleConfigurationInput) (output *s3.GetBucketLifecycleConfigurationOutput, err error) {
+	if err := c.startRequest("GetBucketLifecycleConfiguration", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("GetBucketLifecycleConfiguration", input.Bucket); err != nil {
+		return nil, err
+	}
+	c.m.Lock()
+	rules := c.lifecycle
+	c.m.Unlock()
+	if len(rules) == 0 {
+		return nil, awserr.NewRequestFailure(awserr.New("NoSuchLifecycleConfiguration",
+			"The lifecycle configuration does not exist", nil), http.StatusNotFound, "")
+	}
+	var config s3.BucketLifecycleConfiguration
+	awsutil.Copy(&config, &s3.BucketLifecycleConfiguration{Rules: rules})
+	return &s3.GetBucketLifecycleConfigurationOutput{Rules: config.Rules}, nil
+}
+
+// GetBucketLifecycleConfigurationRequest implements the request variant of
+// GetBucketLifecycleConfiguration.
+func (c *Client) GetBucketLifecycleConfigurationRequest(input *s3.GetBucketLifecycleConfigurationInput) (req *request.Request, output *s3.GetBucketLifecycleConfigurationOutput) {
+	req, output = c.svc.GetBucketLifecycleConfigurationRequest(input)
+	rec := c.record("GetBucketLifecycleConfiguration", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("GetBucketLifecycleConfigurationRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.getBucketLifecycleConfiguration(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// GetBucketLifecycleConfigurationWithContext implements the corresponding
+// s3iface.API method.
+func (c *Client) GetBucketLifecycleConfigurationWithContext(ctx aws.Context, input *s3.GetBucketLifecycleConfigurationInput, opts ...request.Option) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	req, out := c.GetBucketLifecycleConfigurationRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
+
+// DeleteBucketLifecycle removes the bucket's lifecycle configuration.
+func (c *Client) DeleteBucketLifecycle(input *s3.DeleteBucketLifecycleInput) (output *s3.DeleteBucketLifecycleOutput, err error) {
+	rec := c.record("DeleteBucketLifecycle", input)
+	defer rec.done(&output, &err)
+	return c.deleteBucketLifecycle(input)
+}
+
+// deleteBucketLifecycle implements DeleteBucketLifecycle and DeleteBucketLifecycleRequest.
+func (c *Client) deleteBucketLifecycle(input *s3.DeleteBucketLifecycleInput) (output *s3.DeleteBucketLifecycleOutput, err error) {
+	if err := c.startRequest("DeleteBucketLifecycle", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("DeleteBucketLifecycle", input.Bucket); err != nil {
+		return nil, err
+	}
+	c.m.Lock()
+	c.lifecycle = nil
+	c.m.Unlock()
+	return &s3.DeleteBucketLifecycleOutput{}, nil
+}
+
+// DeleteBucketLifecycleRequest implements the request variant of
+// DeleteBucketLifecycle.
+func (c *Client) DeleteBucketLifecycleRequest(input *s3.DeleteBucketLifecycleInput) (req *request.Request, output *s3.DeleteBucketLifecycleOutput) {
+	req, output = c.svc.DeleteBucketLifecycleRequest(input)
+	rec := c.record("DeleteBucketLifecycle", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("DeleteBucketLifecycleRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.deleteBucketLifecycle(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// DeleteBucketLifecycleWithContext implements the corresponding s3iface.API
+// method.
+func (c *Client) DeleteBucketLifecycleWithContext(ctx aws.Context, input *s3.DeleteBucketLifecycleInput, opts ...request.Option) (*s3.DeleteBucketLifecycleOutput, error) {
+	req, out := c.DeleteBucketLifecycleRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
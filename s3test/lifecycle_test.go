@@ -0,0 +1,183 @@
+package s3test_test
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil/expect"
+	"github.com/grailbio/testutil/s3test"
+)
+
+const day = 24 * time.Hour
+
+func putLifecycle(client *s3test.Client, rules ...*s3.LifecycleRule) error {
+	_, err := client.PutBucketLifecycleConfigurationWithContext(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(testBucket),
+		LifecycleConfiguration: &s3.BucketLifecycleConfiguration{Rules: rules},
+	})
+	return err
+}
+
+func TestLifecycleConfiguration(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	_, err := client.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(testBucket)})
+	expect.EQ(t, awsErrCode(err), "NoSuchLifecycleConfiguration")
+	expect.EQ(t, statusCode(err), http.StatusNotFound)
+
+	expect.EQ(t, awsErrCode(putLifecycle(client)), "MalformedXML")
+	expect.EQ(t, awsErrCode(putLifecycle(client, &s3.LifecycleRule{
+		Status: aws.String("Enabled"),
+	})), "InvalidRequest")
+	expect.EQ(t, awsErrCode(putLifecycle(client, &s3.LifecycleRule{
+		Status:     aws.String("Enabled"),
+		Expiration: &s3.LifecycleExpiration{Days: aws.Int64(0)},
+	})), "InvalidArgument")
+
+	rule := &s3.LifecycleRule{
+		ID:         aws.String("tmp"),
+		Status:     aws.String("Enabled"),
+		Filter:     &s3.LifecycleRuleFilter{Prefix: aws.String("tmp/")},
+		Expiration: &s3.LifecycleExpiration{Days: aws.Int64(1)},
+	}
+	expect.EQ(t, awsErrCode(putLifecycle(client, rule, rule)), "InvalidArgument")
+	expect.EQ(t, awsErrCode(putLifecycle(client, &s3.LifecycleRule{
+		Status:                      aws.String("Enabled"),
+		NoncurrentVersionExpiration: &s3.NoncurrentVersionExpiration{NoncurrentDays: aws.Int64(0)},
+	})), "InvalidArgument")
+	expect.NoError(t, putLifecycle(client, rule))
+	out, err := client.GetBucketLifecycleConfigurationWithContext(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(testBucket)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect.EQ(t, len(out.Rules), 1)
+	expect.EQ(t, aws.StringValue(out.Rules[0].ID), "tmp")
+
+	_, err = client.DeleteBucketLifecycle(&s3.DeleteBucketLifecycleInput{Bucket: aws.String(testBucket)})
+	expect.NoError(t, err)
+	_, err = client.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(testBucket)})
+	expect.EQ(t, awsErrCode(err), "NoSuchLifecycleConfiguration")
+}
+
+func TestLifecycleExpiration(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	client.Clock = s3test.NewFakeClock(epoch.Add(12 * time.Hour))
+	expect.NoError(t, putLifecycle(client,
+		&s3.LifecycleRule{
+			Status:     aws.String("Enabled"),
+			Filter:     &s3.LifecycleRuleFilter{Prefix: aws.String("tmp/")},
+			Expiration: &s3.LifecycleExpiration{Days: aws.Int64(1)},
+		},
+		&s3.LifecycleRule{
+			Status:     aws.String("Enabled"),
+			Filter:     &s3.LifecycleRuleFilter{Tag: &s3.Tag{Key: aws.String("retain"), Value: aws.String("short")}},
+			Expiration: &s3.LifecycleExpiration{Days: aws.Int64(3)},
+		},
+		&s3.LifecycleRule{
+			Status:     aws.String("Disabled"),
+			Expiration: &s3.LifecycleExpiration{Days: aws.Int64(1)},
+		},
+	))
+	client.SetFile("tmp/a", []byte("a"), "")
+	client.SetFile("keep", []byte("keep"), "")
+	_, err := client.PutObject(&s3.PutObjectInput{
+		Bucket:  aws.String(testBucket),
+		Key:     aws.String("tagged"),
+		Body:    bytes.NewReader([]byte("tagged")),
+		Tagging: aws.String("retain=short"),
+	})
+	expect.NoError(t, err)
+
+	keys := func() []string {
+		keys := listKeys(t, client, "")
+		sort.Strings(keys)
+		return keys
+	}
+	// Expiration times are rounded up to the next midnight UTC: tmp/a
+	// expires at the start of January 3, tagged at the start of January 5.
+	client.Advance(day + 11*time.Hour)
+	expect.EQ(t, keys(), []string{"keep", "tagged", "tmp/a"})
+	client.Advance(time.Hour)
+	expect.EQ(t, keys(), []string{"keep", "tagged"})
+	client.Advance(day)
+	expect.EQ(t, keys(), []string{"keep", "tagged"})
+	client.Advance(day)
+	expect.EQ(t, keys(), []string{"keep"})
+	client.Advance(30 * day)
+	expect.EQ(t, keys(), []string{"keep"})
+}
+
+func TestLifecycleNoncurrentVersions(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	client.Clock = s3test.NewFakeClock(epoch)
+	expect.NoError(t, putVersioning(client, s3.BucketVersioningStatusEnabled))
+	expect.NoError(t, putLifecycle(client,
+		&s3.LifecycleRule{
+			Status:                      aws.String("Enabled"),
+			Filter:                      &s3.LifecycleRuleFilter{Prefix: aws.String("")},
+			Expiration:                  &s3.LifecycleExpiration{ExpiredObjectDeleteMarker: aws.Bool(true)},
+			NoncurrentVersionExpiration: &s3.NoncurrentVersionExpiration{NoncurrentDays: aws.Int64(2)},
+		},
+		&s3.LifecycleRule{
+			Status:     aws.String("Enabled"),
+			Filter:     &s3.LifecycleRuleFilter{Prefix: aws.String("tmp/")},
+			Expiration: &s3.LifecycleExpiration{Days: aws.Int64(1)},
+		},
+	))
+	v1 := putVersion(t, client, "a", "v1")
+	client.Advance(day)
+	v2 := putVersion(t, client, "a", "v2")
+	tmp := putVersion(t, client, "tmp/b", "b")
+	expect.EQ(t, listVersions(t, client), []string{"a " + v2 + " *", "a " + v1, "tmp/b " + tmp + " *"})
+
+	// tmp/b expires behind a delete marker.
+	client.Advance(day)
+	versions := listVersions(t, client)
+	expect.EQ(t, len(versions), 4)
+	expect.EQ(t, versions[:3], []string{"a " + v2 + " *", "a " + v1, "tmp/b " + tmp})
+	expect.True(t, strings.HasSuffix(versions[3], " marker *"))
+	// v1 expires two days after it became noncurrent, tmp/b two days after
+	// its expiration, and then its delete marker, the only version left.
+	client.Advance(day)
+	expect.EQ(t, listVersions(t, client), []string{"a " + v2 + " *", "tmp/b " + tmp, versions[3]})
+	client.Advance(day)
+	expect.EQ(t, listVersions(t, client), []string{"a " + v2 + " *", versions[3]})
+	client.Advance(day)
+	expect.EQ(t, listVersions(t, client), []string{"a " + v2 + " *"})
+	data, err := getString(t, client, "a")
+	expect.NoError(t, err)
+	expect.EQ(t, data, "v2")
+}
+
+func TestLifecycleAbortMultipart(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	client.Clock = s3test.NewFakeClock(epoch)
+	expect.NoError(t, putLifecycle(client, &s3.LifecycleRule{
+		Status:                         aws.String("Enabled"),
+		Filter:                         &s3.LifecycleRuleFilter{Prefix: aws.String("")},
+		AbortIncompleteMultipartUpload: &s3.AbortIncompleteMultipartUpload{DaysAfterInitiation: aws.Int64(7)},
+	}))
+	id := createUpload(t, client, "mp")
+	client.Advance(6 * day)
+	uploads, err := client.ListMultipartUploads(&s3.ListMultipartUploadsInput{Bucket: aws.String(testBucket)})
+	expect.NoError(t, err)
+	expect.EQ(t, len(uploads.Uploads), 1)
+
+	client.Advance(day)
+	uploads, err = client.ListMultipartUploads(&s3.ListMultipartUploadsInput{Bucket: aws.String(testBucket)})
+	expect.NoError(t, err)
+	expect.EQ(t, len(uploads.Uploads), 0)
+	_, err = client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("mp"),
+		UploadId:   aws.String(id),
+		PartNumber: aws.Int64(1),
+		Body:       bytes.NewReader([]byte("part")),
+	})
+	expect.EQ(t, awsErrCode(err), "NoSuchUpload")
+}
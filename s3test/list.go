@@ -0,0 +1,201 @@
+package s3test
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// defaultMaxKeys is the default (and maximum) number of entries returned by
+// a ListObjects request.
+const defaultMaxKeys = 1000
+
+// listLocked lists, in lexicographic order as S3 does, the visible objects
+// with the given prefix and, if delimiter is non-empty, the common prefixes
+// that group the keys containing the delimiter after prefix. Only entries
+// that sort after marker are returned. If maxKeys is positive, at most
+// maxKeys entries (objects and common prefixes) are returned, and truncated
+// is set if there are more; next is the last entry returned. REQUIRES: c.m
+// is locked.
+func (c *Client) listLocked(prefix, delimiter, marker string, maxKeys int64) (
+	objects []*s3.Object, prefixes []*s3.CommonPrefix, truncated bool, next string) {
+	keys := c.visibleKeysLocked()
+	sort.Strings(keys)
+	var n int64
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) || key <= marker {
+			continue
+		}
+		content, ok := c.lookupLocked(key)
+		if !ok {
+			continue
+		}
+		var group string
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				group = key[:len(prefix)+i+len(delimiter)]
+				if group == next || group <= marker {
+					continue
+				}
+			}
+		}
+		if maxKeys > 0 && n == maxKeys {
+			truncated = true
+			break
+		}
+		n++
+		if group != "" {
+			prefixes = append(prefixes, &s3.CommonPrefix{Prefix: aws.String(group)})
+			next = group
+			continue
+		}
+		objects = append(objects, &s3.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(content.Content.Size()),
+			LastModified: aws.Time(content.LastModified),
+			ETag:         aws.String(content.etag()),
+			StorageClass: stringOrNil(content.StorageClass),
+		})
+		next = key
+	}
+	return
+}
+
+// ListObjects implements version 1 of the object listing API, including
+// pagination by Marker and MaxKeys.
+func (c *Client) ListObjects(input *s3.ListObjectsInput) (output *s3.ListObjectsOutput, err error) {
+	rec := c.record("ListObjects", input)
+	defer rec.done(&output, &err)
+	return c.listObjects(input)
+}
+
+// listObjects implements ListObjects and ListObjectsRequest.
+func (c *Client) listObjects(input *s3.ListObjectsInput) (output *s3.ListObjectsOutput, err error) {
+	if err := c.startRequest("ListObjects", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("ListObjects", input.Bucket); err != nil {
+		return nil, err
+	}
+	maxKeys := aws.Int64Value(input.MaxKeys)
+	if maxKeys <= 0 || maxKeys > defaultMaxKeys {
+		maxKeys = defaultMaxKeys
+	}
+	output = &s3.ListObjectsOutput{
+		Name:      aws.String(c.bucket),
+		Prefix:    input.Prefix,
+		Delimiter: input.Delimiter,
+		Marker:    aws.String(aws.StringValue(input.Marker)),
+		MaxKeys:   aws.Int64(maxKeys),
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	var (
+		truncated bool
+		next      string
+	)
+	output.Contents, output.CommonPrefixes, truncated, next = c.listLocked(aws.StringValue(input.Prefix),
+		aws.StringValue(input.Delimiter), aws.StringValue(input.Marker), maxKeys)
+	output.IsTruncated = aws.Bool(truncated)
+	if truncated {
+		output.NextMarker = aws.String(next)
+	}
+	return output, nil
+}
+
+// ListObjectsRequest implements the request variant of ListObjects.
+func (c *Client) ListObjectsRequest(input *s3.ListObjectsInput) (req *request.Request, output *s3.ListObjectsOutput) {
+	req, output = c.svc.ListObjectsRequest(input)
+	rec := c.record("ListObjects", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("ListObjectsRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.listObjects(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// ListObjectsWithContext implements the corresponding s3iface.API method.
+func (c *Client) ListObjectsWithContext(ctx aws.Context, input *s3.ListObjectsInput, opts ...request.Option) (*s3.ListObjectsOutput, error) {
+	req, out := c.ListObjectsRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
+
+// ListObjectsPages implements the corresponding s3iface.API method.
+func (c *Client) ListObjectsPages(input *s3.ListObjectsInput, fn func(*s3.ListObjectsOutput, bool) bool) error {
+	return c.ListObjectsPagesWithContext(aws.BackgroundContext(), input, fn)
+}
+
+// ListObjectsPagesWithContext implements the corresponding s3iface.API
+// method.
+func (c *Client) ListObjectsPagesWithContext(ctx aws.Context, input *s3.ListObjectsInput, fn func(*s3.ListObjectsOutput, bool) bool, opts ...request.Option) error {
+	page := *input
+	for {
+		out, err := c.ListObjectsWithContext(ctx, &page, opts...)
+		if err != nil {
+			return err
+		}
+		last := !aws.BoolValue(out.IsTruncated)
+		if !fn(out, last) || last {
+			return nil
+		}
+		page.Marker = out.NextMarker
+	}
+}
+
+// HeadBucket reports whether the bucket exists and the client's principal
+// may access it.
+func (c *Client) HeadBucket(input *s3.HeadBucketInput) (output *s3.HeadBucketOutput, err error) {
+	rec := c.record("HeadBucket", input)
+	defer rec.done(&output, &err)
+	return c.headBucket(input)
+}
+
+// headBucket implements HeadBucket and HeadBucketRequest.
+func (c *Client) headBucket(input *s3.HeadBucketInput) (output *s3.HeadBucketOutput, err error) {
+	if err := c.startRequest("HeadBucket", input); err != nil {
+		return nil, err
+	}
+	// Probing for a bucket is not a misuse, so this is not a violation.
+	if aws.StringValue(input.Bucket) != c.bucket {
+		return nil, awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), http.StatusNotFound, "")
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+// HeadBucketRequest implements the request variant of HeadBucket.
+func (c *Client) HeadBucketRequest(input *s3.HeadBucketInput) (req *request.Request, output *s3.HeadBucketOutput) {
+	req, output = c.svc.HeadBucketRequest(input)
+	rec := c.record("HeadBucket", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("HeadBucketRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.headBucket(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// HeadBucketWithContext implements the corresponding s3iface.API method.
+func (c *Client) HeadBucketWithContext(ctx aws.Context, input *s3.HeadBucketInput, opts ...request.Option) (*s3.HeadBucketOutput, error) {
+	req, out := c.HeadBucketRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
@@ -0,0 +1,73 @@
+package s3test_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil/expect"
+	"github.com/grailbio/testutil/s3test"
+)
+
+func TestListObjects(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	for _, key := range []string{"e", "a/2", "c", "a/1", "b/x/1", "d"} {
+		client.SetFile(key, []byte(key), "")
+	}
+	var (
+		keys     []string
+		prefixes []string
+		pages    int
+	)
+	err := client.ListObjectsPages(&s3.ListObjectsInput{
+		Bucket:    aws.String(testBucket),
+		Delimiter: aws.String("/"),
+		MaxKeys:   aws.Int64(2),
+	}, func(out *s3.ListObjectsOutput, last bool) bool {
+		pages++
+		for _, obj := range out.Contents {
+			keys = append(keys, aws.StringValue(obj.Key))
+		}
+		for _, p := range out.CommonPrefixes {
+			prefixes = append(prefixes, aws.StringValue(p.Prefix))
+		}
+		expect.EQ(t, last, !aws.BoolValue(out.IsTruncated))
+		return true
+	})
+	expect.NoError(t, err)
+	expect.EQ(t, pages, 3)
+	expect.EQ(t, keys, []string{"c", "d", "e"})
+	expect.EQ(t, prefixes, []string{"a/", "b/"})
+
+	out, err := client.ListObjectsWithContext(ctx, &s3.ListObjectsInput{
+		Bucket: aws.String(testBucket),
+		Prefix: aws.String("a/"),
+		Marker: aws.String("a/1"),
+	})
+	expect.NoError(t, err)
+	expect.EQ(t, len(out.Contents), 1)
+	expect.EQ(t, aws.StringValue(out.Contents[0].Key), "a/2")
+	expect.False(t, aws.BoolValue(out.IsTruncated))
+
+	// ListObjectsV2 also lists keys in order.
+	expect.EQ(t, listKeys(t, client, ""), []string{"a/1", "a/2", "b/x/1", "c", "d", "e"})
+}
+
+func TestHeadBucket(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	_, err := client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(testBucket)})
+	expect.NoError(t, err)
+	_, err = client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String("other")})
+	expect.EQ(t, statusCode(err), http.StatusNotFound)
+}
+
+func TestNotImplemented(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	_, err := client.GetBucketCors(&s3.GetBucketCorsInput{Bucket: aws.String(testBucket)})
+	expect.EQ(t, awsErrCode(err), "NotImplemented")
+	expect.HasSubstr(t, err.Error(), "not implemented by s3test: GetBucketCors")
+	expect.EQ(t, statusCode(err), http.StatusNotImplemented)
+	_, err = client.GetBucketTaggingWithContext(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(testBucket)})
+	expect.EQ(t, awsErrCode(err), "NotImplemented")
+}
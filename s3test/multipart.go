@@ -0,0 +1,290 @@
+package s3test
+
+import (
+	"crypto/md5"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// DefaultMinPartSize is S3's minimum size of every part but the last of a
+	// multipart upload.
+	DefaultMinPartSize = 5 << 20
+
+	// MaxPartNumber is the largest part number, and hence the maximum number
+	// of parts, permitted in a multipart upload.
+	MaxPartNumber = 10000
+
+	// defaultMaxListParts is the default and maximum number of entries
+	// returned by ListParts and ListMultipartUploads.
+	defaultMaxListParts = 1000
+)
+
+// uploadedPart is a single part of a multipart upload.
+type uploadedPart struct {
+	data         []byte
+	etag         string
+	checksum     string // base64-encoded, if the upload has a checksum algorithm
+	lastModified time.Time
+}
+
+func (c *Client) newPart(data []byte) *uploadedPart {
+	return &uploadedPart{
+		data:         data,
+		etag:         fmt.Sprintf("%x", md5.Sum(data)),
+		lastModified: c.now(),
+	}
+}
+
+func (c *Client) minPartSize() int64 {
+	if c.MinPartSize == 0 {
+		return DefaultMinPartSize
+	}
+	return c.MinPartSize
+}
+
+// multipartETag computes the ETag of an object assembled from parts in the
+// same way S3 does: the MD5 of the concatenated binary MD5s of the parts,
+// followed by "-" and the number of parts.
+func multipartETag(parts []*uploadedPart) string {
+	digests := make([]byte, 0, md5.Size*len(parts))
+	for _, p := range parts {
+		sum := md5.Sum(p.data)
+		digests = append(digests, sum[:]...)
+	}
+	return fmt.Sprintf("%x-%d", md5.Sum(digests), len(parts))
+}
+
+// trimETag removes the quotes that S3 places around ETags.
+func trimETag(etag string) string {
+	return strings.Trim(etag, `"`)
+}
+
+func checkPartNumber(n int64) error {
+	if n < 1 || n > MaxPartNumber {
+		return awserr.New("InvalidArgument",
+			fmt.Sprintf("Part number must be an integer between 1 and %d, inclusive", MaxPartNumber), nil)
+	}
+	return nil
+}
+
+func noSuchUpload(uploadID string) error {
+	return awserr.New("NoSuchUpload",
+		fmt.Sprintf("The specified upload %s does not exist. The upload ID may be invalid, or the upload may have been aborted or completed.", uploadID), nil)
+}
+
+func maxEntries(max *int64) int {
+	if n := aws.Int64Value(max); n > 0 && n < defaultMaxListParts {
+		return int(n)
+	}
+	return defaultMaxListParts
+}
+
+// ListParts lists the parts uploaded so far to an active multipart upload.
+func (c *Client) ListParts(input *s3.ListPartsInput) (output *s3.ListPartsOutput, err error) {
+	rec := c.record("ListParts", input)
+	defer rec.done(&output, &err)
+	return c.listParts(input)
+}
+
+// listParts implements ListParts and ListPartsRequest.
+func (c *Client) listParts(input *s3.ListPartsInput) (output *s3.ListPartsOutput, err error) {
+	if err := c.startRequest("ListParts", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("ListParts", input.Bucket); err != nil {
+		return nil, err
+	}
+	uploadID := aws.StringValue(input.UploadId)
+	c.m.Lock()
+	defer c.m.Unlock()
+	r := c.uploads[uploadID]
+	if r == nil || r.status != multipartUploadActive || r.key != aws.StringValue(input.Key) {
+		return nil, noSuchUpload(uploadID)
+	}
+	var nums []int64
+	for num := range r.partial {
+		if num > aws.Int64Value(input.PartNumberMarker) {
+			nums = append(nums, num)
+		}
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+	max := maxEntries(input.MaxParts)
+	output = &s3.ListPartsOutput{
+		Bucket:           input.Bucket,
+		Key:              input.Key,
+		UploadId:         input.UploadId,
+		MaxParts:         aws.Int64(int64(max)),
+		PartNumberMarker: aws.Int64(aws.Int64Value(input.PartNumberMarker)),
+		IsTruncated:      aws.Bool(len(nums) > max),
+	}
+	if len(nums) > max {
+		nums = nums[:max]
+	}
+	for _, num := range nums {
+		p := r.partial[num]
+		output.Parts = append(output.Parts, &s3.Part{
+			PartNumber:   aws.Int64(num),
+			ETag:         aws.String(p.etag),
+			Size:         aws.Int64(int64(len(p.data))),
+			LastModified: aws.Time(p.lastModified),
+		})
+	}
+	if len(nums) > 0 {
+		output.NextPartNumberMarker = aws.Int64(nums[len(nums)-1])
+	}
+	return output, nil
+}
+
+// ListPartsRequest implements the request variant of ListParts.
+func (c *Client) ListPartsRequest(input *s3.ListPartsInput) (req *request.Request, output *s3.ListPartsOutput) {
+	req, output = c.svc.ListPartsRequest(input)
+	rec := c.record("ListParts", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("ListPartsRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.listParts(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// ListPartsWithContext is the same as ListParts, but allows passing a
+// context and options.
+func (c *Client) ListPartsWithContext(ctx aws.Context, input *s3.ListPartsInput, opts ...request.Option) (*s3.ListPartsOutput, error) {
+	req, out := c.ListPartsRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
+
+// ListMultipartUploads lists the active multipart uploads, ordered by key and
+// then by initiation time.
+func (c *Client) ListMultipartUploads(input *s3.ListMultipartUploadsInput) (output *s3.ListMultipartUploadsOutput, err error) {
+	rec := c.record("ListMultipartUploads", input)
+	defer rec.done(&output, &err)
+	return c.listMultipartUploads(input)
+}
+
+// listMultipartUploads implements ListMultipartUploads and ListMultipartUploadsRequest.
+func (c *Client) listMultipartUploads(input *s3.ListMultipartUploadsInput) (output *s3.ListMultipartUploadsOutput, err error) {
+	if err := c.startRequest("ListMultipartUploads", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("ListMultipartUploads", input.Bucket); err != nil {
+		return nil, err
+	}
+	var (
+		prefix         = aws.StringValue(input.Prefix)
+		delimiter      = aws.StringValue(input.Delimiter)
+		keyMarker      = aws.StringValue(input.KeyMarker)
+		uploadIDMarker = aws.StringValue(input.UploadIdMarker)
+		max            = maxEntries(input.MaxUploads)
+	)
+	c.m.Lock()
+	var uploads []*multipartUpload
+	for _, r := range c.uploads {
+		if r.status == multipartUploadActive && strings.HasPrefix(r.key, prefix) {
+			uploads = append(uploads, r)
+		}
+	}
+	c.m.Unlock()
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].key != uploads[j].key {
+			return uploads[i].key < uploads[j].key
+		}
+		return uploads[i].seq < uploads[j].seq
+	})
+	// Skip past the markers. An upload ID marker is only meaningful together
+	// with a key marker.
+	start := sort.Search(len(uploads), func(i int) bool { return uploads[i].key > keyMarker })
+	if keyMarker != "" && uploadIDMarker != "" {
+		for i, r := range uploads {
+			if r.key == keyMarker && r.id == uploadIDMarker {
+				start = i + 1
+				break
+			}
+		}
+	}
+	uploads = uploads[start:]
+
+	output = &s3.ListMultipartUploadsOutput{
+		Bucket:         input.Bucket,
+		Prefix:         input.Prefix,
+		Delimiter:      input.Delimiter,
+		KeyMarker:      input.KeyMarker,
+		UploadIdMarker: input.UploadIdMarker,
+		MaxUploads:     aws.Int64(int64(max)),
+		IsTruncated:    aws.Bool(false),
+	}
+	seenPrefixes := make(map[string]bool)
+	n := 0
+	for i, r := range uploads {
+		var commonPrefix string
+		if delimiter != "" {
+			if off := strings.Index(r.key[len(prefix):], delimiter); off >= 0 {
+				commonPrefix = r.key[:len(prefix)+off+len(delimiter)]
+				if seenPrefixes[commonPrefix] {
+					continue
+				}
+			}
+		}
+		if n == max {
+			output.IsTruncated = aws.Bool(true)
+			prev := uploads[i-1]
+			output.NextKeyMarker = aws.String(prev.key)
+			output.NextUploadIdMarker = aws.String(prev.id)
+			break
+		}
+		n++
+		if commonPrefix != "" {
+			seenPrefixes[commonPrefix] = true
+			output.CommonPrefixes = append(output.CommonPrefixes, &s3.CommonPrefix{Prefix: aws.String(commonPrefix)})
+			continue
+		}
+		output.Uploads = append(output.Uploads, &s3.MultipartUpload{
+			Key:       aws.String(r.key),
+			UploadId:  aws.String(r.id),
+			Initiated: aws.Time(r.initiated),
+		})
+	}
+	return output, nil
+}
+
+// ListMultipartUploadsRequest implements the request variant of
+// ListMultipartUploads.
+func (c *Client) ListMultipartUploadsRequest(input *s3.ListMultipartUploadsInput) (req *request.Request, output *s3.ListMultipartUploadsOutput) {
+	req, output = c.svc.ListMultipartUploadsRequest(input)
+	rec := c.record("ListMultipartUploads", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("ListMultipartUploadsRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.listMultipartUploads(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// ListMultipartUploadsWithContext is the same as ListMultipartUploads, but
+// allows passing a context and options.
+func (c *Client) ListMultipartUploadsWithContext(ctx aws.Context, input *s3.ListMultipartUploadsInput, opts ...request.Option) (*s3.ListMultipartUploadsOutput, error) {
+	req, out := c.ListMultipartUploadsRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
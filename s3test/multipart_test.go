@@ -0,0 +1,221 @@
+package s3test_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil/s3test"
+)
+
+var ctx = aws.BackgroundContext()
+
+func awsErrCode(err error) string {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code()
+	}
+	return ""
+}
+
+func createUpload(t *testing.T, client *s3test.Client, key string) string {
+	out, err := client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aws.StringValue(out.UploadId)
+}
+
+func uploadPart(t *testing.T, client *s3test.Client, key, uploadID string, num int64, data []byte) *s3.CompletedPart {
+	out, err := client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String(key),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int64(num),
+		Body:       bytes.NewReader(data),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &s3.CompletedPart{PartNumber: aws.Int64(num), ETag: out.ETag}
+}
+
+func completeUpload(client *s3test.Client, key, uploadID string, parts ...*s3.CompletedPart) (*s3.CompleteMultipartUploadOutput, error) {
+	return client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(testBucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+}
+
+func TestMultipartComplete(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	id := createUpload(t, client, "obj")
+	p1 := bytes.Repeat([]byte{'a'}, s3test.DefaultMinPartSize)
+	p2 := []byte("tail")
+	part1 := uploadPart(t, client, "obj", id, 1, p1)
+	part2 := uploadPart(t, client, "obj", id, 2, p2)
+
+	out, err := completeUpload(client, "obj", id, part1, part2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1, s2 := md5.Sum(p1), md5.Sum(p2)
+	want := fmt.Sprintf("%x-2", md5.Sum(append(s1[:], s2[:]...)))
+	if got := aws.StringValue(out.ETag); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := client.MustGetFile("obj").ETag; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := client.GetFileContentBytes("obj"); !bytes.Equal(got, append(p1, p2...)) {
+		t.Errorf("got %d bytes, want %d", len(got), len(p1)+len(p2))
+	}
+	if _, err := client.ListParts(&s3.ListPartsInput{
+		Bucket: aws.String(testBucket), Key: aws.String("obj"), UploadId: aws.String(id),
+	}); awsErrCode(err) != "NoSuchUpload" {
+		t.Errorf("got %v, want NoSuchUpload", err)
+	}
+}
+
+func TestMultipartErrors(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	id := createUpload(t, client, "obj")
+	part1 := uploadPart(t, client, "obj", id, 1, []byte("small"))
+	part2 := uploadPart(t, client, "obj", id, 2, []byte("tail"))
+
+	for _, c := range []struct {
+		parts []*s3.CompletedPart
+		code  string
+	}{
+		{[]*s3.CompletedPart{part1, part2}, "EntityTooSmall"},
+		{[]*s3.CompletedPart{part2, part1}, "InvalidPartOrder"},
+		{[]*s3.CompletedPart{part1, {PartNumber: aws.Int64(2), ETag: aws.String("bad")}}, "InvalidPart"},
+		{[]*s3.CompletedPart{part1, {PartNumber: aws.Int64(3), ETag: part2.ETag}}, "InvalidPart"},
+		{nil, "MalformedXML"},
+	} {
+		if _, err := completeUpload(client, "obj", id, c.parts...); awsErrCode(err) != c.code {
+			t.Errorf("%v: got %v, want %v", c.parts, err, c.code)
+		}
+	}
+	// A failed completion leaves the upload active; the last part may be small.
+	if _, err := completeUpload(client, "obj", id, part2); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := completeUpload(client, "obj", "nonexistent", part1); awsErrCode(err) != "NoSuchUpload" {
+		t.Errorf("got %v, want NoSuchUpload", err)
+	}
+	for _, num := range []int64{0, s3test.MaxPartNumber + 1} {
+		_, err := client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(testBucket),
+			Key:        aws.String("obj2"),
+			UploadId:   aws.String(createUpload(t, client, "obj2")),
+			PartNumber: aws.Int64(num),
+			Body:       bytes.NewReader(nil),
+		})
+		if awsErrCode(err) != "InvalidArgument" {
+			t.Errorf("part %d: got %v, want InvalidArgument", num, err)
+		}
+	}
+
+	id = createUpload(t, client, "aborted")
+	if _, err := client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket: aws.String(testBucket), Key: aws.String("aborted"), UploadId: aws.String(id),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("aborted"),
+		UploadId:   aws.String(id),
+		PartNumber: aws.Int64(1),
+		Body:       bytes.NewReader(nil),
+	}); awsErrCode(err) != "NoSuchUpload" {
+		t.Errorf("got %v, want NoSuchUpload", err)
+	}
+}
+
+func TestListParts(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	id := createUpload(t, client, "obj")
+	for _, num := range []int64{3, 1, 2} {
+		uploadPart(t, client, "obj", id, num, []byte(fmt.Sprint(num)))
+	}
+	var got []int64
+	input := &s3.ListPartsInput{
+		Bucket:   aws.String(testBucket),
+		Key:      aws.String("obj"),
+		UploadId: aws.String(id),
+		MaxParts: aws.Int64(2),
+	}
+	for {
+		out, err := client.ListParts(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range out.Parts {
+			got = append(got, aws.Int64Value(p.PartNumber))
+			if aws.Int64Value(p.Size) != 1 {
+				t.Errorf("part %d: got size %d, want 1", *p.PartNumber, *p.Size)
+			}
+		}
+		if !aws.BoolValue(out.IsTruncated) {
+			break
+		}
+		input.PartNumberMarker = out.NextPartNumberMarker
+	}
+	if fmt.Sprint(got) != "[1 2 3]" {
+		t.Errorf("got %v, want [1 2 3]", got)
+	}
+}
+
+func TestListMultipartUploads(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	var want []string
+	for _, key := range []string{"b", "a", "dir/x", "dir/y", "b"} {
+		id := createUpload(t, client, key)
+		if key != "dir/y" {
+			want = append(want, key+":"+id)
+		}
+	}
+	done := createUpload(t, client, "done")
+	if _, err := completeUpload(client, "done", done, uploadPart(t, client, "done", done, 1, nil)); err != nil {
+		t.Fatal(err)
+	}
+	// Expected order: a, b (first), b (second), then dir/ as a common prefix.
+	want = []string{want[1], want[0], want[3], "dir/"}
+
+	var got []string
+	input := &s3.ListMultipartUploadsInput{
+		Bucket:     aws.String(testBucket),
+		Delimiter:  aws.String("/"),
+		MaxUploads: aws.Int64(2),
+	}
+	for {
+		out, err := client.ListMultipartUploads(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, u := range out.Uploads {
+			got = append(got, aws.StringValue(u.Key)+":"+aws.StringValue(u.UploadId))
+		}
+		for _, p := range out.CommonPrefixes {
+			got = append(got, aws.StringValue(p.Prefix))
+		}
+		if !aws.BoolValue(out.IsTruncated) {
+			break
+		}
+		input.KeyMarker, input.UploadIdMarker = out.NextKeyMarker, out.NextUploadIdMarker
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
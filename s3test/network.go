@@ -0,0 +1,209 @@
+package s3test
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// networkChunkSize is the granularity at which object bodies are streamed
+// under a Network's bandwidth caps.
+const networkChunkSize = 32 << 10
+
+// Network models the latency, bandwidth and request rate limits of the
+// network between a Client and S3, so that timeouts, context cancellation
+// and adaptive concurrency can be tested. All delays are measured by the
+// Client's Clock; with a FakeClock, the test advances time explicitly (see
+// FakeClock.BlockUntil).
+//
+// The model applies when a request is sent, i.e., to the Request variants
+// (as used by s3manager) and the WithContext methods; the plain methods,
+// e.g., GetObject, return immediately. Requests are first subject to
+// throttling, then to Latency; GetObject bodies are then streamed, and
+// PutObject and UploadPart bodies transferred, at the modeled bandwidth.
+// While waiting, requests and bodies honor the cancellation of the
+// request's context.
+//
+// Object and multipart upload requests (PutObject, CopyObject,
+// DeleteObject, CreateMultipartUpload, UploadPart, UploadPartCopy,
+// CompleteMultipartUpload and AbortMultipartUpload) take effect only once
+// the Network has admitted them, so a throttled or canceled request has no
+// effect. Other requests are processed by the Client before they are sent,
+// so those with side effects, e.g., PutObjectTagging, still take effect.
+type Network struct {
+	// Latency, if non-nil, returns the latency of a request to the named API
+	// (e.g., "GetObject"), that is, the time until its response headers are
+	// received. It may return random values to model a latency
+	// distribution.
+	Latency func(api string) time.Duration
+
+	// ConnBandwidth is the maximum rate, in bytes per second, at which the
+	// body of a single request or response is transferred. Zero means
+	// unlimited.
+	ConnBandwidth int64
+
+	// Bandwidth is the maximum aggregate rate, in bytes per second, of all
+	// concurrent transfers. Zero means unlimited.
+	Bandwidth int64
+
+	// RequestRate is the maximum sustained rate of requests per second.
+	// Requests in excess of it fail with SlowDown (HTTP status 503). Zero
+	// means unlimited.
+	RequestRate float64
+
+	// Burst is the number of requests that may be issued at once in excess
+	// of RequestRate. Values less than 1 are treated as 1.
+	Burst int
+
+	mu        sync.Mutex
+	aggregate bandwidth
+	tokens    float64
+	last      time.Time // time tokens was last updated
+}
+
+// bandwidth schedules transfers at a fixed rate.
+type bandwidth struct {
+	rate int64
+	next time.Time // time at which the last scheduled transfer completes
+}
+
+// reserve schedules the transfer of n bytes and returns the time at which
+// it completes.
+func (b *bandwidth) reserve(now time.Time, n int) time.Time {
+	if b.rate <= 0 {
+		return now
+	}
+	start := b.next
+	if start.Before(now) {
+		start = now
+	}
+	b.next = start.Add(time.Duration(float64(n) / float64(b.rate) * float64(time.Second)))
+	return b.next
+}
+
+// allow reports whether a request issued at now is within the rate limit.
+func (n *Network) allow(now time.Time) bool {
+	if n.RequestRate <= 0 {
+		return true
+	}
+	burst := float64(n.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.last.IsZero() {
+		n.tokens = burst
+	} else if now.After(n.last) {
+		n.tokens += now.Sub(n.last).Seconds() * n.RequestRate
+		if n.tokens > burst {
+			n.tokens = burst
+		}
+	}
+	n.last = now
+	if n.tokens < 1 {
+		return false
+	}
+	n.tokens--
+	return true
+}
+
+func slowDown() error {
+	return awserr.NewRequestFailure(awserr.New("SlowDown", "Please reduce your request rate.", nil),
+		http.StatusServiceUnavailable, "")
+}
+
+func canceled(err error) error {
+	return awserr.New(request.CanceledErrorCode, "request context canceled", err)
+}
+
+// transfer waits for n bytes to be transferred over a connection whose
+// bandwidth is tracked by conn.
+func (c *Client) transfer(ctx aws.Context, conn *bandwidth, n int) error {
+	net := c.Network
+	if net == nil || n == 0 {
+		return nil
+	}
+	now := c.now()
+	done := conn.reserve(now, n)
+	net.mu.Lock()
+	net.aggregate.rate = net.Bandwidth
+	if t := net.aggregate.reserve(now, n); t.After(done) {
+		done = t
+	}
+	net.mu.Unlock()
+	if err := c.sleep(ctx, done.Sub(now)); err != nil {
+		return canceled(err)
+	}
+	return nil
+}
+
+// uploadBody models the transfer of a request body of n bytes.
+func (c *Client) uploadBody(ctx aws.Context, n int) error {
+	if c.Network == nil {
+		return nil
+	}
+	return c.transfer(ctx, &bandwidth{rate: c.Network.ConnBandwidth}, n)
+}
+
+// sendNetwork is installed as a send handler on all requests. It applies
+// c.Network, if any, to the request.
+func (c *Client) sendNetwork(r *request.Request) {
+	net := c.Network
+	if net == nil {
+		return
+	}
+	if !net.allow(c.now()) {
+		r.Error = slowDown()
+		r.Retryable = aws.Bool(true)
+		return
+	}
+	if net.Latency != nil {
+		if err := c.sleep(r.Context(), net.Latency(r.Operation.Name)); err != nil {
+			r.Error = canceled(err)
+			return
+		}
+	}
+	if out, ok := r.Data.(*s3.GetObjectOutput); ok && out.Body != nil {
+		out.Body = &networkReader{
+			ctx:  r.Context(),
+			c:    c,
+			conn: bandwidth{rate: net.ConnBandwidth},
+			body: out.Body,
+		}
+	}
+}
+
+// networkReader streams a response body at the rate modeled by a Network.
+type networkReader struct {
+	ctx  aws.Context
+	c    *Client
+	conn bandwidth
+	body io.ReadCloser
+}
+
+// Read implements io.Reader.
+func (r *networkReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, canceled(err)
+	}
+	if len(p) > networkChunkSize {
+		p = p[:networkChunkSize]
+	}
+	n, err := r.body.Read(p)
+	if werr := r.c.transfer(r.ctx, &r.conn, n); werr != nil {
+		return 0, werr
+	}
+	return n, err
+}
+
+// Close implements io.Closer.
+func (r *networkReader) Close() error {
+	return r.body.Close()
+}
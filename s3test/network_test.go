@@ -0,0 +1,236 @@
+package s3test_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil/expect"
+	"github.com/grailbio/testutil/s3test"
+)
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func getObject(ctx context.Context, client *s3test.Client, key string) (*s3.GetObjectOutput, error) {
+	return client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String(key),
+	})
+}
+
+func TestNetworkThrottling(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	clock := s3test.NewFakeClock(epoch)
+	client.Clock = clock
+	client.Network = &s3test.Network{RequestRate: 1, Burst: 2}
+	client.SetFile("a", []byte("a"), "")
+
+	for i := 0; i < 2; i++ {
+		if _, err := getObject(ctx, client, "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := getObject(ctx, client, "a")
+	expect.EQ(t, awsErrCode(err), "SlowDown")
+	expect.EQ(t, statusCode(err), http.StatusServiceUnavailable)
+
+	clock.Advance(time.Second)
+	_, err = getObject(ctx, client, "a")
+	expect.NoError(t, err)
+	// A throttled PutObject has no effect.
+	_, err = client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("b"),
+		Body:   bytes.NewReader([]byte("b")),
+	})
+	expect.EQ(t, awsErrCode(err), "SlowDown")
+	_, ok := client.GetFile("b")
+	expect.False(t, ok)
+	// Nor do a throttled CopyObject or DeleteObject.
+	_, err = client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("c"),
+		CopySource: aws.String(testBucket + "/a"),
+	})
+	expect.EQ(t, awsErrCode(err), "SlowDown")
+	_, ok = client.GetFile("c")
+	expect.False(t, ok)
+	_, err = client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("a"),
+	})
+	expect.EQ(t, awsErrCode(err), "SlowDown")
+	_, ok = client.GetFile("a")
+	expect.True(t, ok)
+}
+
+func TestNetworkLatency(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	clock := s3test.NewFakeClock(epoch)
+	client.Clock = clock
+	client.Network = &s3test.Network{Latency: func(api string) time.Duration {
+		expect.EQ(t, api, "GetObject")
+		return time.Second
+	}}
+	client.SetFile("a", []byte("a"), "")
+
+	errc := make(chan error)
+	go func() {
+		_, err := getObject(ctx, client, "a")
+		errc <- err
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	expect.NoError(t, <-errc)
+
+	cctx, cancel := context.WithCancel(ctx)
+	go func() {
+		_, err := getObject(cctx, client, "a")
+		errc <- err
+	}()
+	clock.BlockUntil(1)
+	cancel()
+	expect.EQ(t, awsErrCode(<-errc), request.CanceledErrorCode)
+}
+
+func TestNetworkBandwidth(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	clock := s3test.NewFakeClock(epoch)
+	client.Clock = clock
+	client.Network = &s3test.Network{ConnBandwidth: 1000, Bandwidth: 1500}
+	client.SetFile("a", bytes.Repeat([]byte{'a'}, 3000), "")
+
+	// Two concurrent streams share the aggregate bandwidth.
+	done := make(chan time.Time)
+	for i := 0; i < 2; i++ {
+		out, err := getObject(ctx, client, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			data, err := ioutil.ReadAll(out.Body)
+			expect.NoError(t, err)
+			expect.EQ(t, len(data), 3000)
+			done <- clock.Now()
+		}()
+	}
+	var finished []time.Duration
+	for len(finished) < 2 {
+		select {
+		case now := <-done:
+			finished = append(finished, now.Sub(epoch))
+		case <-time.After(10 * time.Millisecond):
+			clock.Advance(100 * time.Millisecond)
+		}
+	}
+	// 6000 bytes at 1500 bytes/s; each stream at most 1000 bytes/s. (The
+	// clock may be advanced past a stream's completion before it is
+	// observed.)
+	expect.GE(t, finished[0], 3*time.Second)
+	expect.GE(t, finished[1], 4*time.Second)
+	expect.LT(t, finished[1], 4*time.Second+500*time.Millisecond)
+
+	// Streams honor context cancellation.
+	client.SetFile("big", bytes.Repeat([]byte{'b'}, 1<<20), "")
+	cctx, cancel := context.WithCancel(ctx)
+	out, err := getObject(cctx, client, "big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error)
+	go func() {
+		_, err := ioutil.ReadAll(out.Body)
+		errc <- err
+	}()
+	clock.BlockUntil(1)
+	cancel()
+	expect.EQ(t, awsErrCode(<-errc), request.CanceledErrorCode)
+
+	// Uploads are subject to the same bandwidth limits.
+	start := clock.Now()
+	go func() {
+		_, err := client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(testBucket),
+			Key:    aws.String("c"),
+			Body:   bytes.NewReader(make([]byte, 2000)),
+		})
+		errc <- err
+	}()
+	clock.BlockUntil(2) // including the abandoned waiter above
+	clock.Advance(2 * time.Second)
+	expect.NoError(t, <-errc)
+	expect.EQ(t, client.MustGetFile("c").LastModified, start.Add(2*time.Second))
+}
+
+func TestNetworkThrottledMultipartUpload(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	clock := s3test.NewFakeClock(epoch)
+	client.Clock = clock
+	client.SetFile("src", []byte("src"), "")
+	create, err := client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("key"),
+	})
+	expect.NoError(t, err)
+	part, err := client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("key"),
+		UploadId:   create.UploadId,
+		PartNumber: aws.Int64(1),
+		Body:       bytes.NewReader([]byte("data")),
+	})
+	expect.NoError(t, err)
+
+	// Throttle all requests. None of them takes effect.
+	client.Network = &s3test.Network{RequestRate: 1}
+	_, err = client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(testBucket)})
+	expect.NoError(t, err)
+	_, err = client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("other"),
+	})
+	expect.EQ(t, awsErrCode(err), "SlowDown")
+	_, err = client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("key"),
+		UploadId:   create.UploadId,
+		PartNumber: aws.Int64(2),
+		CopySource: aws.String(testBucket + "/src"),
+	})
+	expect.EQ(t, awsErrCode(err), "SlowDown")
+	_, err = client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(testBucket),
+		Key:      aws.String("key"),
+		UploadId: create.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: []*s3.CompletedPart{{ETag: part.ETag, PartNumber: aws.Int64(1)}},
+		},
+	})
+	expect.EQ(t, awsErrCode(err), "SlowDown")
+	_, ok := client.GetFile("key")
+	expect.False(t, ok)
+	_, err = client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(testBucket),
+		Key:      aws.String("key"),
+		UploadId: create.UploadId,
+	})
+	expect.EQ(t, awsErrCode(err), "SlowDown")
+
+	client.Network = nil
+	uploads, err := client.ListMultipartUploads(&s3.ListMultipartUploadsInput{Bucket: aws.String(testBucket)})
+	expect.NoError(t, err)
+	expect.EQ(t, len(uploads.Uploads), 1)
+	parts, err := client.ListParts(&s3.ListPartsInput{
+		Bucket:   aws.String(testBucket),
+		Key:      aws.String("key"),
+		UploadId: create.UploadId,
+	})
+	expect.NoError(t, err)
+	expect.EQ(t, len(parts.Parts), 1)
+}
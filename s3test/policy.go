@@ -0,0 +1,444 @@
+package s3test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// BucketOwner is the principal that owns the bucket and its objects. A
+// Client whose Principal is empty acts as BucketOwner.
+const BucketOwner = "s3test-bucket-owner"
+
+// s3ARNPrefix is the prefix of the ARNs of S3 buckets and objects.
+const s3ARNPrefix = "arn:aws:s3:::"
+
+// apiActions maps the APIs subject to access control to the policy actions
+// that authorize them.
+var apiActions = map[string]string{
+	"GetObject":                       "s3:GetObject",
+	"HeadObject":                      "s3:GetObject",
+	"PutObject":                       "s3:PutObject",
+	"CopyObject":                      "s3:PutObject",
+	"CreateMultipartUpload":           "s3:PutObject",
+	"UploadPart":                      "s3:PutObject",
+	"UploadPartCopy":                  "s3:PutObject",
+	"CompleteMultipartUpload":         "s3:PutObject",
+	"AbortMultipartUpload":            "s3:AbortMultipartUpload",
+	"ListParts":                       "s3:ListMultipartUploadParts",
+	"DeleteObject":                    "s3:DeleteObject",
+	"GetObjectTagging":                "s3:GetObjectTagging",
+	"PutObjectTagging":                "s3:PutObjectTagging",
+	"DeleteObjectTagging":             "s3:DeleteObjectTagging",
+	"GetObjectAcl":                    "s3:GetObjectAcl",
+	"PutObjectAcl":                    "s3:PutObjectAcl",
+	"ListObjectV2":                    "s3:ListBucket",
+	"ListObjectsV2":                   "s3:ListBucket",
+	"ListMultipartUploads":            "s3:ListBucketMultipartUploads",
+	"ListObjects":                     "s3:ListBucket",
+	"HeadBucket":                      "s3:ListBucket",
+	"RestoreObject":                   "s3:RestoreObject",
+	"SelectObjectContent":             "s3:GetObject",
+	"GetBucketLocation":               "s3:GetBucketLocation",
+	"PutBucketLifecycleConfiguration": "s3:PutLifecycleConfiguration",
+	"GetBucketLifecycleConfiguration": "s3:GetLifecycleConfiguration",
+	"DeleteBucketLifecycle":           "s3:PutLifecycleConfiguration",
+	"PutBucketPolicy":                 "s3:PutBucketPolicy",
+	"GetBucketPolicy":                 "s3:GetBucketPolicy",
+	"DeleteBucketPolicy":              "s3:DeleteBucketPolicy",
+	"PutBucketVersioning":             "s3:PutBucketVersioning",
+	"GetBucketVersioning":             "s3:GetBucketVersioning",
+	"ListObjectVersions":              "s3:ListBucketVersions",
+}
+
+// bucketActions are the actions whose resource is the bucket rather than an
+// object. The list actions are also authorized by object resources that
+// match the requested prefix.
+var bucketActions = map[string]bool{
+	"s3:ListBucket":                 true,
+	"s3:ListBucketMultipartUploads": true,
+	"s3:GetBucketLocation":          true,
+	"s3:PutLifecycleConfiguration":  true,
+	"s3:GetLifecycleConfiguration":  true,
+	"s3:PutBucketPolicy":            true,
+	"s3:GetBucketPolicy":            true,
+	"s3:DeleteBucketPolicy":         true,
+	"s3:PutBucketVersioning":        true,
+	"s3:GetBucketVersioning":        true,
+	"s3:ListBucketVersions":         true,
+}
+
+func accessDenied() error {
+	return awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "")
+}
+
+func malformedPolicy(format string, args ...interface{}) error {
+	return awserr.NewRequestFailure(awserr.New("MalformedPolicy", fmt.Sprintf(format, args...), nil),
+		http.StatusBadRequest, "")
+}
+
+// stringList is a policy element that is either a string or a list of
+// strings.
+type stringList []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = stringList{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// policyDocument is the subset of the IAM policy language understood by
+// s3test.
+type policyDocument struct {
+	Version   string
+	Statement []policyStatement
+}
+
+type policyStatement struct {
+	Sid       string
+	Effect    string
+	Principal json.RawMessage
+	Action    stringList
+	Resource  stringList
+	Condition json.RawMessage
+
+	principals         []string
+	actions, resources []*regexp.Regexp
+}
+
+// wildcard compiles a policy pattern, in which "*" matches any sequence of
+// characters and "?" any single character.
+func wildcard(pattern string, caseInsensitive bool) *regexp.Regexp {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.Replace(re, `\*`, ".*", -1)
+	re = strings.Replace(re, `\?`, ".", -1)
+	if caseInsensitive {
+		re = "(?i)" + re
+	}
+	return regexp.MustCompile("^" + re + "$")
+}
+
+// parsePolicy parses and validates a bucket policy for bucket.
+func parsePolicy(bucket, policy string) ([]policyStatement, error) {
+	var doc policyDocument
+	dec := json.NewDecoder(bytes.NewReader([]byte(policy)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, malformedPolicy("%v", err)
+	}
+	if len(doc.Statement) == 0 {
+		return nil, malformedPolicy("Missing required field Statement")
+	}
+	for i := range doc.Statement {
+		st := &doc.Statement[i]
+		if st.Effect != "Allow" && st.Effect != "Deny" {
+			return nil, malformedPolicy("Invalid effect: %q", st.Effect)
+		}
+		if len(st.Condition) > 0 {
+			return nil, awserr.NewRequestFailure(awserr.New("NotImplemented",
+				"s3test: policy conditions are not supported", nil), http.StatusNotImplemented, "")
+		}
+		if len(st.Principal) == 0 {
+			return nil, malformedPolicy("Missing required field Principal")
+		}
+		var star string
+		if err := json.Unmarshal(st.Principal, &star); err == nil {
+			if star != "*" {
+				return nil, malformedPolicy("Invalid principal in policy: %q", star)
+			}
+			st.principals = []string{"*"}
+		} else {
+			var principals map[string]stringList
+			if err := json.Unmarshal(st.Principal, &principals); err != nil {
+				return nil, malformedPolicy("Invalid principal in policy: %v", err)
+			}
+			for _, list := range principals {
+				st.principals = append(st.principals, list...)
+			}
+		}
+		if len(st.Action) == 0 {
+			return nil, malformedPolicy("Missing required field Action")
+		}
+		for _, action := range st.Action {
+			if action != "*" && !strings.HasPrefix(strings.ToLower(action), "s3:") {
+				return nil, malformedPolicy("Policy has invalid action: %q", action)
+			}
+			st.actions = append(st.actions, wildcard(action, true))
+		}
+		if len(st.Resource) == 0 {
+			return nil, malformedPolicy("Missing required field Resource")
+		}
+		for _, resource := range st.Resource {
+			res := strings.TrimPrefix(resource, s3ARNPrefix)
+			if res == resource || (res != bucket && !strings.HasPrefix(res, bucket+"/")) {
+				return nil, malformedPolicy("Policy has invalid resource: %q", resource)
+			}
+			st.resources = append(st.resources, wildcard(res, false))
+		}
+	}
+	return doc.Statement, nil
+}
+
+// matches reports whether st applies to the given principal, action and
+// resources; the statement matches if any of the resources do.
+func (st *policyStatement) matches(principal, action string, resources ...string) bool {
+	var ok bool
+	for _, p := range st.principals {
+		if p == "*" || p == principal {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return false
+	}
+	ok = false
+	for _, re := range st.actions {
+		if re.MatchString(action) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return false
+	}
+	for _, re := range st.resources {
+		for _, r := range resources {
+			if re.MatchString(r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// principal returns the principal that c's requests are made as.
+func (c *Client) principal() string {
+	if c.Principal == "" {
+		return BucketOwner
+	}
+	return c.Principal
+}
+
+// authorize checks that c's principal may make a request to the given API
+// (e.g., "GetObjectRequest") with the given input.
+func (c *Client) authorize(api string, input interface{}) error {
+	api = strings.TrimSuffix(strings.TrimSuffix(api, "WithContext"), "Request")
+	action, ok := apiActions[api]
+	if !ok {
+		return nil
+	}
+	if bucketActions[action] {
+		return c.authorizeAction(action, stringField(input, "Prefix"), true)
+	}
+	return c.authorizeAction(action, stringField(input, "Key"), false)
+}
+
+// authorizeAction checks that c's principal may perform action on key or,
+// for bucket actions, on the bucket with key as the requested prefix, if
+// any. A request is denied if a statement of the bucket policy denies it.
+// Otherwise the bucket owner is allowed all actions; other principals need
+// a statement that allows the action or, for object actions, a grant in the
+// object's ACL (see PutObjectAcl).
+func (c *Client) authorizeAction(action, key string, bucketAction bool) error {
+	principal := c.principal()
+	c.m.Lock()
+	policy := c.policy
+	f, exists := c.content[key]
+	c.m.Unlock()
+	resources := []string{c.bucket + "/" + key}
+	if bucketAction {
+		resources = append(resources, c.bucket)
+		exists = false
+	}
+	allowed := principal == BucketOwner
+	for i := range policy {
+		if !policy[i].matches(principal, action, resources...) {
+			continue
+		}
+		if policy[i].Effect == "Deny" {
+			return accessDenied()
+		}
+		allowed = true
+	}
+	if !allowed && exists && aclAllows(f.Grants, principal, action) {
+		allowed = true
+	}
+	if !allowed {
+		return accessDenied()
+	}
+	return nil
+}
+
+// PutBucketPolicy sets the bucket policy. s3test understands a subset of
+// the policy language: statements with an Effect, a Principal ("*" or a map
+// whose values list principals that are compared with Client.Principal),
+// Actions and Resources, in which "*" and "?" are wildcards. Conditions are
+// not supported. The list actions, e.g., s3:ListBucket, are authorized by
+// the bucket's ARN or by an object resource that matches the requested
+// prefix (in lieu of the s3:prefix condition key).
+func (c *Client) PutBucketPolicy(input *s3.PutBucketPolicyInput) (output *s3.PutBucketPolicyOutput, err error) {
+	rec := c.record("PutBucketPolicy", input)
+	defer rec.done(&output, &err)
+	return c.putBucketPolicy(input)
+}
+
+// putBucketPolicy implements PutBucketPolicy and PutBucketPolicyRequest.
+func (c *Client) putBucketPolicy(input *s3.PutBucketPolicyInput) (output *s3.PutBucketPolicyOutput, err error) {
+	if err := c.startRequest("PutBucketPolicy", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("PutBucketPolicy", input.Bucket); err != nil {
+		return nil, err
+	}
+	policy, err := parsePolicy(c.bucket, aws.StringValue(input.Policy))
+	if err != nil {
+		return nil, err
+	}
+	c.m.Lock()
+	c.policy, c.policyText = policy, aws.StringValue(input.Policy)
+	c.m.Unlock()
+	return &s3.PutBucketPolicyOutput{}, nil
+}
+
+// PutBucketPolicyRequest implements the request variant of PutBucketPolicy.
+func (c *Client) PutBucketPolicyRequest(input *s3.PutBucketPolicyInput) (req *request.Request, output *s3.PutBucketPolicyOutput) {
+	req, output = c.svc.PutBucketPolicyRequest(input)
+	rec := c.record("PutBucketPolicy", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("PutBucketPolicyRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.putBucketPolicy(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// PutBucketPolicyWithContext implements the corresponding s3iface.API
+// method.
+func (c *Client) PutBucketPolicyWithContext(ctx aws.Context, input *s3.PutBucketPolicyInput, opts ...request.Option) (*s3.PutBucketPolicyOutput, error) {
+	req, out := c.PutBucketPolicyRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
+
+// GetBucketPolicy returns the bucket policy.
+func (c *Client) GetBucketPolicy(input *s3.GetBucketPolicyInput) (output *s3.GetBucketPolicyOutput, err error) {
+	rec := c.record("GetBucketPolicy", input)
+	defer rec.done(&output, &err)
+	return c.getBucketPolicy(input)
+}
+
+// getBucketPolicy implements GetBucketPolicy and GetBucketPolicyRequest.
+func (c *Client) getBucketPolicy(input *s3.GetBucketPolicyInput) (output *s3.GetBucketPolicyOutput, err error) {
+	if err := c.startRequest("GetBucketPolicy", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("GetBucketPolicy", input.Bucket); err != nil {
+		return nil, err
+	}
+	c.m.Lock()
+	text := c.policyText
+	c.m.Unlock()
+	if text == "" {
+		return nil, awserr.NewRequestFailure(awserr.New("NoSuchBucketPolicy",
+			"The bucket policy does not exist", nil), http.StatusNotFound, "")
+	}
+	return &s3.GetBucketPolicyOutput{Policy: aws.String(text)}, nil
+}
+
+// GetBucketPolicyRequest implements the request variant of GetBucketPolicy.
+func (c *Client) GetBucketPolicyRequest(input *s3.GetBucketPolicyInput) (req *request.Request, output *s3.GetBucketPolicyOutput) {
+	req, output = c.svc.GetBucketPolicyRequest(input)
+	rec := c.record("GetBucketPolicy", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("GetBucketPolicyRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.getBucketPolicy(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// GetBucketPolicyWithContext implements the corresponding s3iface.API
+// method.
+func (c *Client) GetBucketPolicyWithContext(ctx aws.Context, input *s3.GetBucketPolicyInput, opts ...request.Option) (*s3.GetBucketPolicyOutput, error) {
+	req, out := c.GetBucketPolicyRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
+
+// DeleteBucketPolicy removes the bucket policy.
+func (c *Client) DeleteBucketPolicy(input *s3.DeleteBucketPolicyInput) (output *s3.DeleteBucketPolicyOutput, err error) {
+	rec := c.record("DeleteBucketPolicy", input)
+	defer rec.done(&output, &err)
+	return c.deleteBucketPolicy(input)
+}
+
+// deleteBucketPolicy implements DeleteBucketPolicy and DeleteBucketPolicyRequest.
+func (c *Client) deleteBucketPolicy(input *s3.DeleteBucketPolicyInput) (output *s3.DeleteBucketPolicyOutput, err error) {
+	if err := c.startRequest("DeleteBucketPolicy", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("DeleteBucketPolicy", input.Bucket); err != nil {
+		return nil, err
+	}
+	c.m.Lock()
+	c.policy, c.policyText = nil, ""
+	c.m.Unlock()
+	return &s3.DeleteBucketPolicyOutput{}, nil
+}
+
+// DeleteBucketPolicyRequest implements the request variant of
+// DeleteBucketPolicy.
+func (c *Client) DeleteBucketPolicyRequest(input *s3.DeleteBucketPolicyInput) (req *request.Request, output *s3.DeleteBucketPolicyOutput) {
+	req, output = c.svc.DeleteBucketPolicyRequest(input)
+	rec := c.record("DeleteBucketPolicy", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("DeleteBucketPolicyRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.deleteBucketPolicy(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// DeleteBucketPolicyWithContext implements the corresponding s3iface.API
+// method.
+func (c *Client) DeleteBucketPolicyWithContext(ctx aws.Context, input *s3.DeleteBucketPolicyInput, opts ...request.Option) (*s3.DeleteBucketPolicyOutput, error) {
+	req, out := c.DeleteBucketPolicyRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
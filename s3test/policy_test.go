@@ -0,0 +1,219 @@
+package s3test_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil/expect"
+	"github.com/grailbio/testutil/s3test"
+)
+
+const testPolicy = `{
+	"Version": "2012-10-17",
+	"Statement": [
+		{
+			"Effect": "Allow",
+			"Principal": {"AWS": ["writer", "reader"]},
+			"Action": ["s3:GetObject", "s3:ListBucket"],
+			"Resource": "arn:aws:s3:::` + testBucket + `/data/*"
+		},
+		{
+			"Effect": "Allow",
+			"Principal": {"AWS": "writer"},
+			"Action": "s3:Put*",
+			"Resource": "arn:aws:s3:::` + testBucket + `/data/*"
+		},
+		{
+			"Effect": "Deny",
+			"Principal": "*",
+			"Action": "s3:*",
+			"Resource": "arn:aws:s3:::` + testBucket + `/data/secret*"
+		}
+	]
+}`
+
+func TestBucketPolicy(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	_, err := client.GetBucketPolicy(&s3.GetBucketPolicyInput{Bucket: aws.String(testBucket)})
+	expect.EQ(t, awsErrCode(err), "NoSuchBucketPolicy")
+	for _, bad := range []string{
+		`{"Statement": []}`,
+		`{"Statement": [{"Effect": "Maybe", "Principal": "*", "Action": "s3:*", "Resource": "arn:aws:s3:::` + testBucket + `"}]}`,
+		`{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:*", "Resource": "arn:aws:s3:::other/*"}]}`,
+	} {
+		_, err = client.PutBucketPolicy(&s3.PutBucketPolicyInput{Bucket: aws.String(testBucket), Policy: aws.String(bad)})
+		expect.EQ(t, awsErrCode(err), "MalformedPolicy")
+	}
+	_, err = client.PutBucketPolicyWithContext(ctx, &s3.PutBucketPolicyInput{
+		Bucket: aws.String(testBucket),
+		Policy: aws.String(testPolicy),
+	})
+	expect.NoError(t, err)
+	out, err := client.GetBucketPolicy(&s3.GetBucketPolicyInput{Bucket: aws.String(testBucket)})
+	expect.NoError(t, err)
+	expect.EQ(t, aws.StringValue(out.Policy), testPolicy)
+
+	client.SetFile("data/a", []byte("a"), "")
+	client.SetFile("data/secret", []byte("secret"), "")
+	client.SetFile("other", []byte("other"), "")
+	put := func(key string) error {
+		_, err := client.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(testBucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader([]byte(key)),
+		})
+		return err
+	}
+	list := func(prefix string) error {
+		_, err := client.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String(testBucket), Prefix: aws.String(prefix)})
+		return err
+	}
+
+	// The owner is allowed everything not explicitly denied.
+	_, err = getString(t, client, "other")
+	expect.NoError(t, err)
+	_, err = getString(t, client, "data/secret")
+	expect.EQ(t, statusCode(err), http.StatusForbidden)
+
+	client.Principal = "reader"
+	_, err = getString(t, client, "data/a")
+	expect.NoError(t, err)
+	_, err = getString(t, client, "other")
+	expect.EQ(t, awsErrCode(err), "AccessDenied")
+	expect.EQ(t, awsErrCode(put("data/b")), "AccessDenied")
+	expect.NoError(t, list("data/"))
+	expect.EQ(t, awsErrCode(list("")), "AccessDenied")
+
+	client.Principal = "writer"
+	expect.NoError(t, put("data/b"))
+	expect.EQ(t, awsErrCode(put("data/secret2")), "AccessDenied")
+	_, err = client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(testBucket), Key: aws.String("data/b")})
+	expect.EQ(t, awsErrCode(err), "AccessDenied")
+	// Copies need read access to the source.
+	_, err = client.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("data/c"),
+		CopySource: aws.String(testBucket + "/other"),
+	})
+	expect.EQ(t, awsErrCode(err), "AccessDenied")
+
+	client.Principal = "stranger"
+	_, err = client.DeleteBucketPolicy(&s3.DeleteBucketPolicyInput{Bucket: aws.String(testBucket)})
+	expect.EQ(t, awsErrCode(err), "AccessDenied")
+	client.Principal = ""
+	_, err = client.DeleteBucketPolicy(&s3.DeleteBucketPolicyInput{Bucket: aws.String(testBucket)})
+	expect.NoError(t, err)
+	_, err = getString(t, client, "data/secret")
+	expect.NoError(t, err)
+}
+
+func TestObjectACL(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	_, err := client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("public"),
+		Body:   bytes.NewReader([]byte("public")),
+		ACL:    aws.String(s3.ObjectCannedACLPublicRead),
+	})
+	expect.NoError(t, err)
+	client.SetFile("private", []byte("private"), "")
+	_, err = client.PutObject(&s3.PutObjectInput{
+		Bucket:    aws.String(testBucket),
+		Key:       aws.String("bad"),
+		Body:      bytes.NewReader(nil),
+		ACL:       aws.String(s3.ObjectCannedACLPublicRead),
+		GrantRead: aws.String(`id="reader"`),
+	})
+	expect.EQ(t, awsErrCode(err), "InvalidRequest")
+
+	client.Principal = "reader"
+	_, err = getString(t, client, "public")
+	expect.NoError(t, err)
+	_, err = getString(t, client, "private")
+	expect.EQ(t, awsErrCode(err), "AccessDenied")
+	_, err = client.PutObjectAcl(&s3.PutObjectAclInput{
+		Bucket:    aws.String(testBucket),
+		Key:       aws.String("private"),
+		GrantRead: aws.String(`id="reader"`),
+	})
+	expect.EQ(t, awsErrCode(err), "AccessDenied")
+
+	client.Principal = ""
+	_, err = client.PutObjectAclWithContext(ctx, &s3.PutObjectAclInput{
+		Bucket:    aws.String(testBucket),
+		Key:       aws.String("private"),
+		GrantRead: aws.String(`id="reader"`),
+	})
+	expect.NoError(t, err)
+	acl, err := client.GetObjectAcl(&s3.GetObjectAclInput{Bucket: aws.String(testBucket), Key: aws.String("private")})
+	expect.NoError(t, err)
+	expect.EQ(t, len(acl.Grants), 2)
+	expect.EQ(t, aws.StringValue(acl.Owner.ID), s3test.BucketOwner)
+
+	client.Principal = "reader"
+	_, err = getString(t, client, "private")
+	expect.NoError(t, err)
+	_, err = client.GetObjectAcl(&s3.GetObjectAclInput{Bucket: aws.String(testBucket), Key: aws.String("private")})
+	expect.EQ(t, awsErrCode(err), "AccessDenied")
+	client.Principal = "other"
+	_, err = getString(t, client, "private")
+	expect.EQ(t, awsErrCode(err), "AccessDenied")
+}
+
+func TestDeniedMultipartUpload(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	create, err := client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("key"),
+	})
+	expect.NoError(t, err)
+	part, err := client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("key"),
+		UploadId:   create.UploadId,
+		PartNumber: aws.Int64(1),
+		Body:       bytes.NewReader([]byte("data")),
+	})
+	expect.NoError(t, err)
+
+	// A denied request has no effect.
+	client.Principal = "stranger"
+	req, _ := client.CreateMultipartUploadRequest(&s3.CreateMultipartUploadInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("other"),
+	})
+	expect.EQ(t, awsErrCode(req.Send()), "AccessDenied")
+	req, _ = client.CompleteMultipartUploadRequest(&s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(testBucket),
+		Key:      aws.String("key"),
+		UploadId: create.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: []*s3.CompletedPart{{ETag: part.ETag, PartNumber: aws.Int64(1)}},
+		},
+	})
+	expect.EQ(t, awsErrCode(req.Send()), "AccessDenied")
+	_, ok := client.GetFile("key")
+	expect.False(t, ok)
+	_, err = client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(testBucket),
+		Key:      aws.String("key"),
+		UploadId: create.UploadId,
+	})
+	expect.EQ(t, awsErrCode(err), "AccessDenied")
+
+	client.Principal = ""
+	uploads, err := client.ListMultipartUploads(&s3.ListMultipartUploadsInput{Bucket: aws.String(testBucket)})
+	expect.NoError(t, err)
+	expect.EQ(t, len(uploads.Uploads), 1)
+	_, err = client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("key"),
+		UploadId:   create.UploadId,
+		PartNumber: aws.Int64(2),
+		Body:       bytes.NewReader([]byte("more")),
+	})
+	expect.NoError(t, err)
+}
@@ -0,0 +1,308 @@
+package s3test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// presignTimeFormat is the format of the X-Amz-Date query parameter.
+	presignTimeFormat = "20060102T150405Z"
+	// maxPresignExpiry is the longest validity of a presigned URL.
+	maxPresignExpiry = 7 * 24 * time.Hour
+	// presignAlgorithm is the signing algorithm reported in presigned URLs.
+	presignAlgorithm = "AWS4-HMAC-SHA256"
+	// presignCredential is the (fake) credential reported in presigned URLs.
+	presignCredential = "s3test"
+)
+
+// presignSecret is the key used to sign presigned URLs.
+var presignSecret = []byte("s3test presign secret")
+
+// Server returns the HTTP server that serves the URLs returned by
+// presigned requests, e.g.,
+//
+//	req, _ := client.GetObjectRequest(&s3.GetObjectInput{...})
+//	url, err := req.Presign(time.Hour)
+//
+// GetObject, HeadObject, PutObject and DeleteObject requests can be
+// presigned. The server is backed by the client's store: a GET of a URL
+// presigned for GetObject calls GetObject, and so on. It honors the Range
+// and If-* request headers of GET and HEAD requests, and the Content-Type,
+// Content-MD5 and x-amz-meta-* headers of PUT requests. Requests fail with
+// an S3 error response if the URL has expired, according to the client's
+// Clock, or if its method, bucket, key or expiry differ from those that
+// were signed.
+//
+// The server is started when first needed. It is closed when the test
+// completes (with Go 1.14 and later); it may also be closed explicitly.
+func (c *Client) Server() *httptest.Server {
+	c.serverOnce.Do(func() {
+		c.server = httptest.NewServer(http.HandlerFunc(c.servePresigned))
+		if t, ok := interface{}(c.t).(interface{ Cleanup(func()) }); ok {
+			t.Cleanup(c.server.Close)
+		}
+	})
+	return c.server
+}
+
+// presignable allows req to be presigned even if the client failed it when
+// it was created, e.g., because the object did not exist: a presigned
+// request is evaluated only when its URL is used.
+func presignable(req *request.Request) {
+	req.Operation.BeforePresignFn = func(r *request.Request) error {
+		r.Error = nil
+		return nil
+	}
+}
+
+// presignSignature computes the signature of a presigned URL.
+func presignSignature(method, path, date, expires string) string {
+	mac := hmac.New(sha256.New, presignSecret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", method, path, date, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signPresigned is installed as a sign handler on all requests. If the
+// request is being presigned, it replaces the request's URL with a signed
+// URL served by c.Server.
+func (c *Client) signPresigned(r *request.Request) {
+	if !r.IsPresigned() {
+		return
+	}
+	var key *string
+	switch input := r.Params.(type) {
+	case *s3.GetObjectInput:
+		key = input.Key
+	case *s3.HeadObjectInput:
+		key = input.Key
+	case *s3.PutObjectInput:
+		key = input.Key
+	case *s3.DeleteObjectInput:
+		key = input.Key
+	default:
+		r.Error = awserr.New("NotImplemented",
+			fmt.Sprintf("s3test: %s requests cannot be presigned", r.Operation.Name), nil)
+		return
+	}
+	srv, err := url.Parse(c.Server().URL)
+	if err != nil {
+		r.Error = err
+		return
+	}
+	path := "/" + c.bucket + "/" + aws.StringValue(key)
+	date := c.now().UTC().Format(presignTimeFormat)
+	expires := strconv.FormatInt(int64(r.ExpireTime/time.Second), 10)
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", presignAlgorithm)
+	query.Set("X-Amz-Credential", presignCredential)
+	query.Set("X-Amz-Date", date)
+	query.Set("X-Amz-Expires", expires)
+	query.Set("X-Amz-SignedHeaders", "host")
+	query.Set("X-Amz-Signature", presignSignature(r.HTTPRequest.Method, path, date, expires))
+	r.HTTPRequest.URL = &url.URL{
+		Scheme:   srv.Scheme,
+		Host:     srv.Host,
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+}
+
+// checkPresigned verifies the signature and expiry of a presigned URL.
+func (c *Client) checkPresigned(req *http.Request) error {
+	query := req.URL.Query()
+	date, expires := query.Get("X-Amz-Date"), query.Get("X-Amz-Expires")
+	if query.Get("X-Amz-Algorithm") != presignAlgorithm || date == "" || expires == "" {
+		return awserr.NewRequestFailure(awserr.New("AccessDenied",
+			"Query-string authentication requires the X-Amz-Algorithm, X-Amz-Date and X-Amz-Expires parameters", nil),
+			http.StatusForbidden, "")
+	}
+	sig := presignSignature(req.Method, req.URL.Path, date, expires)
+	if req.Method == http.MethodHead {
+		// HEAD is allowed with URLs presigned for GetObject, as with S3.
+		if !hmac.Equal([]byte(query.Get("X-Amz-Signature")), []byte(sig)) {
+			sig = presignSignature(http.MethodGet, req.URL.Path, date, expires)
+		}
+	}
+	if !hmac.Equal([]byte(query.Get("X-Amz-Signature")), []byte(sig)) {
+		return awserr.NewRequestFailure(awserr.New("SignatureDoesNotMatch",
+			"The request signature we calculated does not match the signature you provided", nil),
+			http.StatusForbidden, "")
+	}
+	signed, err := time.Parse(presignTimeFormat, date)
+	if err != nil {
+		return awserr.NewRequestFailure(awserr.New("AuthorizationQueryParametersError",
+			fmt.Sprintf("invalid X-Amz-Date %q", date), nil), http.StatusBadRequest, "")
+	}
+	secs, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || secs <= 0 || time.Duration(secs)*time.Second > maxPresignExpiry {
+		return awserr.NewRequestFailure(awserr.New("AuthorizationQueryParametersError",
+			fmt.Sprintf("X-Amz-Expires must be between 1 and %d seconds", int64(maxPresignExpiry/time.Second)), nil),
+			http.StatusBadRequest, "")
+	}
+	if c.now().After(signed.Add(time.Duration(secs) * time.Second)) {
+		return awserr.NewRequestFailure(awserr.New("AccessDenied", "Request has expired", nil),
+			http.StatusForbidden, "")
+	}
+	return nil
+}
+
+// servePresigned serves the requests made with presigned URLs.
+func (c *Client) servePresigned(w http.ResponseWriter, req *http.Request) {
+	if err := c.checkPresigned(req); err != nil {
+		writeError(w, err)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)
+	if len(parts) != 2 {
+		writeError(w, awserr.New("InvalidRequest", "missing object key", nil))
+		return
+	}
+	bucket, key := aws.String(parts[0]), aws.String(parts[1])
+	h := req.Header
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		input := &s3.HeadObjectInput{
+			Bucket:      bucket,
+			Key:         key,
+			IfMatch:     headerOrNil(h, "If-Match"),
+			IfNoneMatch: headerOrNil(h, "If-None-Match"),
+		}
+		if t, err := http.ParseTime(h.Get("If-Modified-Since")); err == nil {
+			input.IfModifiedSince = aws.Time(t)
+		}
+		if t, err := http.ParseTime(h.Get("If-Unmodified-Since")); err == nil {
+			input.IfUnmodifiedSince = aws.Time(t)
+		}
+		if req.Method == http.MethodHead {
+			out, err := c.HeadObject(input)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			writeObjectHeaders(w, out.ContentLength, out.ETag, out.LastModified, out.ContentType, out.Metadata)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		out, err := c.GetObject(&s3.GetObjectInput{
+			Bucket:            bucket,
+			Key:               key,
+			Range:             headerOrNil(h, "Range"),
+			IfMatch:           input.IfMatch,
+			IfNoneMatch:       input.IfNoneMatch,
+			IfModifiedSince:   input.IfModifiedSince,
+			IfUnmodifiedSince: input.IfUnmodifiedSince,
+		})
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		defer out.Body.Close() // nolint: errcheck
+		writeObjectHeaders(w, out.ContentLength, out.ETag, out.LastModified, out.ContentType, out.Metadata)
+		status := http.StatusOK
+		if out.ContentRange != nil {
+			w.Header().Set("Content-Range", *out.ContentRange)
+			status = http.StatusPartialContent
+		}
+		w.WriteHeader(status)
+		io.Copy(w, out.Body) // nolint: errcheck
+	case http.MethodPut:
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			writeError(w, awserr.New(request.ErrCodeRead, "reading request body", err))
+			return
+		}
+		meta := make(map[string]*string)
+		for name, values := range h {
+			if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") && len(values) > 0 {
+				meta[name[len("x-amz-meta-"):]] = aws.String(values[0])
+			}
+		}
+		out, err := c.PutObjectWithContext(req.Context(), &s3.PutObjectInput{
+			Bucket:      bucket,
+			Key:         key,
+			Body:        bytes.NewReader(body),
+			ContentType: headerOrNil(h, "Content-Type"),
+			ContentMD5:  headerOrNil(h, "Content-Md5"),
+			Metadata:    meta,
+		})
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("ETag", aws.StringValue(out.ETag))
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		if _, err := c.DeleteObject(&s3.DeleteObjectInput{Bucket: bucket, Key: key}); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, awserr.NewRequestFailure(awserr.New("MethodNotAllowed",
+			fmt.Sprintf("method %s is not allowed", req.Method), nil), http.StatusMethodNotAllowed, ""))
+	}
+}
+
+func headerOrNil(h http.Header, name string) *string {
+	if v := h.Get(name); v != "" {
+		return aws.String(v)
+	}
+	return nil
+}
+
+func writeObjectHeaders(w http.ResponseWriter, size *int64, etag *string, modified *time.Time, contentType *string, meta map[string]*string) {
+	h := w.Header()
+	h.Set("Content-Length", strconv.FormatInt(aws.Int64Value(size), 10))
+	h.Set("ETag", aws.StringValue(etag))
+	if modified != nil {
+		h.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if contentType != nil {
+		h.Set("Content-Type", *contentType)
+	}
+	for k, v := range meta {
+		h.Set("X-Amz-Meta-"+k, aws.StringValue(v))
+	}
+}
+
+// s3Error is the body of an S3 error response.
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string
+	Message string
+}
+
+// writeError writes the S3 error response corresponding to err.
+func writeError(w http.ResponseWriter, err error) {
+	status, code := errorStatus(err)
+	if status == 0 {
+		status = http.StatusBadRequest
+	}
+	msg := err.Error()
+	if aerr, ok := err.(awserr.Error); ok {
+		msg = aerr.Message()
+	}
+	body, _ := xml.Marshal(s3Error{Code: code, Message: msg})
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header)) // nolint: errcheck
+	w.Write(body)               // nolint: errcheck
+}
@@ -0,0 +1,106 @@
+package s3test_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil/expect"
+	"github.com/grailbio/testutil/s3test"
+)
+
+func httpDo(t *testing.T, method, url string, body []byte, header http.Header) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(data)
+}
+
+func TestPresign(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	clock := s3test.NewFakeClock(epoch)
+	client.Clock = clock
+
+	// Objects need not exist when URLs are presigned.
+	putReq, _ := client.PutObjectRequest(&s3.PutObjectInput{Bucket: aws.String(testBucket), Key: aws.String("dir/a b")})
+	putURL, err := putReq.Presign(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getReq, _ := client.GetObjectRequest(&s3.GetObjectInput{Bucket: aws.String(testBucket), Key: aws.String("dir/a b")})
+	getURL, err := getReq.Presign(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect.True(t, strings.HasPrefix(getURL, client.Server().URL))
+
+	resp, body := httpDo(t, http.MethodGet, getURL, nil, nil)
+	expect.EQ(t, resp.StatusCode, http.StatusNotFound)
+	expect.True(t, strings.Contains(body, "<Code>NoSuchKey</Code>"))
+
+	resp, _ = httpDo(t, http.MethodPut, putURL, []byte("contents"), http.Header{
+		"Content-Type":   {"text/plain"},
+		"X-Amz-Meta-Foo": {"bar"},
+	})
+	expect.EQ(t, resp.StatusCode, http.StatusOK)
+	f := client.MustGetFile("dir/a b")
+	expect.EQ(t, f.ContentType, "text/plain")
+	expect.EQ(t, aws.StringValue(f.Metadata["Foo"]), "bar")
+	expect.EQ(t, resp.Header.Get("ETag"), f.ETag)
+
+	resp, body = httpDo(t, http.MethodGet, getURL, nil, nil)
+	expect.EQ(t, resp.StatusCode, http.StatusOK)
+	expect.EQ(t, body, "contents")
+	expect.EQ(t, resp.Header.Get("X-Amz-Meta-Foo"), "bar")
+	resp, body = httpDo(t, http.MethodGet, getURL, nil, http.Header{"Range": {"bytes=1-3"}})
+	expect.EQ(t, resp.StatusCode, http.StatusPartialContent)
+	expect.EQ(t, body, "ont")
+	resp, _ = httpDo(t, http.MethodHead, getURL, nil, nil)
+	expect.EQ(t, resp.StatusCode, http.StatusOK)
+	expect.EQ(t, resp.ContentLength, int64(8))
+
+	// URLs are signed for their method, key and expiry.
+	resp, body = httpDo(t, http.MethodPut, getURL, []byte("x"), nil)
+	expect.EQ(t, resp.StatusCode, http.StatusForbidden)
+	expect.True(t, strings.Contains(body, "SignatureDoesNotMatch"))
+	resp, _ = httpDo(t, http.MethodGet, strings.Replace(getURL, "X-Amz-Expires=3600", "X-Amz-Expires=7200", 1), nil, nil)
+	expect.EQ(t, resp.StatusCode, http.StatusForbidden)
+
+	clock.Advance(time.Hour + time.Second)
+	resp, body = httpDo(t, http.MethodGet, getURL, nil, nil)
+	expect.EQ(t, resp.StatusCode, http.StatusForbidden)
+	expect.True(t, strings.Contains(body, "Request has expired"))
+
+	delReq, _ := client.DeleteObjectRequest(&s3.DeleteObjectInput{Bucket: aws.String(testBucket), Key: aws.String("dir/a b")})
+	delURL, err := delReq.Presign(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, _ = httpDo(t, http.MethodDelete, delURL, nil, nil)
+	expect.EQ(t, resp.StatusCode, http.StatusNoContent)
+	_, ok := client.GetFile("dir/a b")
+	expect.False(t, ok)
+
+	// Other requests cannot be presigned.
+	listReq, _ := client.ListObjectsV2Request(&s3.ListObjectsV2Input{Bucket: aws.String(testBucket)})
+	_, err = listReq.Presign(time.Minute)
+	expect.EQ(t, awsErrCode(err), "NotImplemented")
+}
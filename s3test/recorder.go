@@ -0,0 +1,589 @@
+package s3test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil"
+)
+
+// Record describes a single request handled by a Client. Records are
+// returned by Client.Records, and can be written to and read from a file
+// with WriteRecords and ReadRecords, and replayed with Client.Replay.
+type Record struct {
+	// API is the name of the S3 operation, e.g., "GetObject". It does not
+	// depend on which variant of the method (GetObject, GetObjectRequest,
+	// GetObjectWithContext) was invoked. A DeleteObjects request is recorded
+	// as one DeleteObject record per key.
+	API string
+
+	// Key, Prefix, Range, CopySource, UploadID, PartNumber and VersionID
+	// hold the corresponding fields of the request, if any. UploadID is taken
+	// from the response for CreateMultipartUpload.
+	Key        string `json:",omitempty"`
+	Prefix     string `json:",omitempty"`
+	Range      string `json:",omitempty"`
+	CopySource string `json:",omitempty"`
+	UploadID   string `json:",omitempty"`
+	PartNumber int64  `json:",omitempty"`
+	VersionID  string `json:",omitempty"`
+
+	// Metadata is the user metadata sent with the request.
+	Metadata map[string]string `json:",omitempty"`
+
+	// Tags is the tag set sent with a PutObjectTagging request.
+	Tags map[string]string `json:",omitempty"`
+
+	// LifecycleRules are the rules sent with a
+	// PutBucketLifecycleConfiguration request, and Versioning the status sent
+	// with a PutBucketVersioning request.
+	LifecycleRules []*s3.LifecycleRule `json:",omitempty"`
+	Versioning     string              `json:",omitempty"`
+
+	// ACL holds the x-amz-acl and x-amz-grant-* headers of the request,
+	// keyed by name, and AccessControlPolicy the body of a PutObjectAcl
+	// request. Policy is the policy sent with a PutBucketPolicy request.
+	ACL                 map[string]string       `json:",omitempty"`
+	AccessControlPolicy *s3.AccessControlPolicy `json:",omitempty"`
+	Policy              string                  `json:",omitempty"`
+
+	// StorageClass is the storage class requested by a PutObject, CopyObject
+	// or CreateMultipartUpload request, and RestoreRequest the body of a
+	// RestoreObject request.
+	StorageClass   string             `json:",omitempty"`
+	RestoreRequest *s3.RestoreRequest `json:",omitempty"`
+
+	// Principal is the Client.Principal that made the request.
+	Principal string `json:",omitempty"`
+
+	// Status is the HTTP status code of the response and ErrCode the S3 error
+	// code, if the request failed.
+	Status  int
+	ErrCode string `json:",omitempty"`
+
+	// Bytes is the number of body bytes sent (PutObject, UploadPart) or
+	// received (GetObject).
+	Bytes int64 `json:",omitempty"`
+
+	// Start is the time, according to Client.Clock, at which the request
+	// started, and Duration how long it took.
+	Start    time.Time
+	Duration time.Duration
+}
+
+// recorder accumulates a Record while a request is handled.
+type recorder struct {
+	c   *Client
+	rec Record
+}
+
+// record starts a Record for a request. The caller must call done once the
+// outcome of the request is known; this is typically deferred:
+//
+//	rec := c.record("HeadObject", input)
+//	defer rec.done(&output, &err)
+func (c *Client) record(api string, input interface{}) *recorder {
+	rec := Record{
+		API:          api,
+		Key:          stringField(input, "Key"),
+		Prefix:       stringField(input, "Prefix"),
+		Range:        stringField(input, "Range"),
+		CopySource:   stringField(input, "CopySource"),
+		UploadID:     stringField(input, "UploadId"),
+		PartNumber:   int64Field(input, "PartNumber"),
+		VersionID:    stringField(input, "VersionId"),
+		ACL:          inputACL(input),
+		StorageClass: stringField(input, "StorageClass"),
+		Principal:    c.Principal,
+		Start:        c.now(),
+	}
+	if rng := stringField(input, "CopySourceRange"); rng != "" {
+		rec.Range = rng
+	}
+	if meta := fieldValue(input, "Metadata"); meta.IsValid() {
+		rec.Metadata = flattenMetadata(meta.Interface().(map[string]*string))
+	}
+	// The bodies of configuration requests are copied, as the caller may
+	// reuse the input.
+	switch input := input.(type) {
+	case *s3.PutObjectTaggingInput:
+		if input.Tagging != nil {
+			rec.Tags = make(map[string]string, len(input.Tagging.TagSet))
+			for _, tag := range input.Tagging.TagSet {
+				rec.Tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+		}
+	case *s3.PutBucketLifecycleConfigurationInput:
+		if input.LifecycleConfiguration != nil {
+			var config s3.BucketLifecycleConfiguration
+			awsutil.Copy(&config, input.LifecycleConfiguration)
+			rec.LifecycleRules = config.Rules
+		}
+	case *s3.PutObjectAclInput:
+		if input.AccessControlPolicy != nil {
+			rec.AccessControlPolicy = new(s3.AccessControlPolicy)
+			awsutil.Copy(rec.AccessControlPolicy, input.AccessControlPolicy)
+		}
+	case *s3.PutBucketPolicyInput:
+		rec.Policy = aws.StringValue(input.Policy)
+	case *s3.PutBucketVersioningInput:
+		if input.VersioningConfiguration != nil {
+			rec.Versioning = aws.StringValue(input.VersioningConfiguration.Status)
+		}
+	case *s3.RestoreObjectInput:
+		if input.RestoreRequest != nil {
+			rec.RestoreRequest = new(s3.RestoreRequest)
+			awsutil.Copy(rec.RestoreRequest, input.RestoreRequest)
+		}
+	}
+	return &recorder{c: c, rec: rec}
+}
+
+// setBytes sets the number of body bytes transferred by the request.
+func (r *recorder) setBytes(n int64) {
+	r.rec.Bytes = n
+}
+
+// done completes the record. Output is a pointer to the output of the
+// request, and err a pointer to its error.
+func (r *recorder) done(output interface{}, err *error) {
+	if v := reflect.ValueOf(output); v.Kind() == reflect.Ptr && !v.IsNil() {
+		output = v.Elem().Interface()
+	}
+	if id := stringField(output, "UploadId"); id != "" {
+		r.rec.UploadID = id
+	}
+	if r.rec.API == "GetObject" && (err == nil || *err == nil) {
+		r.rec.Bytes = int64Field(output, "ContentLength")
+	}
+	r.rec.Status, r.rec.ErrCode = http.StatusOK, ""
+	if err != nil && *err != nil {
+		r.rec.Status, r.rec.ErrCode = errorStatus(*err)
+	}
+	r.rec.Duration = r.c.now().Sub(r.rec.Start)
+	r.c.m.Lock()
+	r.c.records = append(r.c.records, r.rec)
+	r.c.m.Unlock()
+}
+
+// errorStatus returns the HTTP status and S3 error code corresponding to
+// err.
+func errorStatus(err error) (int, string) {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return http.StatusInternalServerError, "InternalError"
+	}
+	if rerr, ok := err.(awserr.RequestFailure); ok {
+		return rerr.StatusCode(), aerr.Code()
+	}
+	switch aerr.Code() {
+	case "NoSuchKey", "NoSuchUpload", "NoSuchBucket", "NotFound":
+		return http.StatusNotFound, aerr.Code()
+	case "AccessDenied":
+		return http.StatusForbidden, aerr.Code()
+	case "InvalidRange":
+		return http.StatusRequestedRangeNotSatisfiable, aerr.Code()
+	case "NotImplemented":
+		return http.StatusNotImplemented, aerr.Code()
+	case "SlowDown", "ServiceUnavailable":
+		return http.StatusServiceUnavailable, aerr.Code()
+	case "InternalError":
+		return http.StatusInternalServerError, aerr.Code()
+	case request.CanceledErrorCode:
+		return 0, aerr.Code()
+	}
+	return http.StatusBadRequest, aerr.Code()
+}
+
+// fieldValue returns the value of the named field of the struct pointed to
+// by v, or the zero Value if there is no such field or it is nil.
+func fieldValue(v interface{}, name string) reflect.Value {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	f := rv.FieldByName(name)
+	if !f.IsValid() {
+		return f
+	}
+	switch f.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Interface, reflect.Slice:
+		if f.IsNil() {
+			return reflect.Value{}
+		}
+	}
+	return f
+}
+
+func stringField(v interface{}, name string) string {
+	if f := fieldValue(v, name); f.IsValid() && f.Type() == reflect.TypeOf((*string)(nil)) {
+		return f.Elem().String()
+	}
+	return ""
+}
+
+func int64Field(v interface{}, name string) int64 {
+	if f := fieldValue(v, name); f.IsValid() && f.Type() == reflect.TypeOf((*int64)(nil)) {
+		return f.Elem().Int()
+	}
+	return 0
+}
+
+func flattenMetadata(meta map[string]*string) map[string]string {
+	if len(meta) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(meta))
+	for k, v := range meta {
+		m[k] = aws.StringValue(v)
+	}
+	return m
+}
+
+// Records returns the requests handled by the client so far, in the order in
+// which they completed. The result can be inspected directly or, via
+// RecordedKeys, with the matchers in package h.
+func (c *Client) Records() []Record {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return append([]Record(nil), c.records...)
+}
+
+// RecordedKeys returns the keys of the recorded requests for the given API,
+// e.g., "GetObject", in the order in which they completed. For example, to
+// check that no object under "tmp/" was read:
+//
+//	expect.That(t, client.RecordedKeys("GetObject"), h.Not(h.Contains(h.HasPrefix("tmp/"))))
+func (c *Client) RecordedKeys(api string) []string {
+	var keys []string
+	for _, r := range c.Records() {
+		if r.API == api {
+			keys = append(keys, r.Key)
+		}
+	}
+	return keys
+}
+
+// ResetRecords discards the requests recorded so far. It is typically called
+// after a test has populated the client.
+func (c *Client) ResetRecords() {
+	c.m.Lock()
+	c.records = nil
+	c.m.Unlock()
+}
+
+// WriteRecords writes the requests recorded so far to w as a sequence of
+// JSON objects, one per line, that can be read by ReadRecords.
+func (c *Client) WriteRecords(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, r := range c.Records() {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadRecords reads records written by WriteRecords. Blank lines are ignored.
+func ReadRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("s3test.ReadRecords: line %d: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// ReplayOption configures Client.Replay.
+type ReplayOption func(*replayConfig)
+
+type replayConfig struct {
+	skipUnreplayable bool
+}
+
+// SkipUnreplayable makes Replay skip records of APIs that it cannot replay,
+// rather than returning an error.
+func SkipUnreplayable() ReplayOption {
+	return func(c *replayConfig) { c.skipUnreplayable = true }
+}
+
+// ReplayMismatch describes a replayed request whose status differs from the
+// recorded one.
+type ReplayMismatch struct {
+	// Index is the index of the record in the records passed to Replay.
+	Index int
+	// Record is the recorded request.
+	Record Record
+	// Status and ErrCode are the HTTP status and S3 error code of the
+	// replayed request.
+	Status  int
+	ErrCode string
+}
+
+// ReplayError is returned by Replay if the statuses of some replayed requests
+// differ from the recorded ones.
+type ReplayError struct {
+	Mismatches []ReplayMismatch
+}
+
+// Error implements error.
+func (e *ReplayError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "s3test.Replay: %d requests differ from their records", len(e.Mismatches))
+	for _, m := range e.Mismatches {
+		fmt.Fprintf(&b, "; record %d: %s %s: got status %d %q, recorded %d %q",
+			m.Index, m.Record.API, m.Record.Key, m.Status, m.ErrCode, m.Record.Status, m.Record.ErrCode)
+	}
+	return b.String()
+}
+
+// Replay issues the given requests, typically read by ReadRecords, against
+// the client in order, each as the principal that made it. Request bodies are
+// not recorded, so objects and parts are written with generated contents of
+// the recorded size, and recorded Content-Sha256 metadata is dropped.
+// Multipart uploads are completed with all parts uploaded during the replay.
+// Version IDs are replayed as recorded, so deletes of specific versions
+// apply to the same versions if the client's bucket starts out as the
+// recorded one did.
+// SelectObjectContent requests, whose expressions are not recorded, are
+// skipped, as they do not modify the store. Replay returns an error if a
+// record names an API it cannot replay, unless SkipUnreplayable is given.
+// All other requests are replayed; if any of them returns a status other
+// than the recorded one, Replay returns a *ReplayError listing them. The
+// outcome of each replayed request is available from c.Records.
+func (c *Client) Replay(records []Record, opts ...ReplayOption) error {
+	var config replayConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	var (
+		ctx       = aws.BackgroundContext()
+		bucket    = aws.String(c.bucket)
+		uploadIDs = make(map[string]string)                      // recorded upload ID -> replayed upload ID
+		parts     = make(map[string]map[int64]*s3.CompletedPart) // replayed upload ID -> parts
+	)
+	defer func(principal string) { c.Principal = principal }(c.Principal)
+	optional := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return aws.String(s)
+	}
+	var mismatches []ReplayMismatch
+	for i, r := range records {
+		var meta map[string]*string
+		if r.Metadata != nil {
+			meta = aws.StringMap(r.Metadata)
+			// The replayed contents are generated, so a recorded checksum
+			// of the original contents would fail to match them.
+			delete(meta, awsContentSHA256Key)
+		}
+		uploadID := uploadIDs[r.UploadID]
+		c.Principal = r.Principal
+		var err error
+		switch r.API {
+		case "GetObject":
+			var out *s3.GetObjectOutput
+			out, err = c.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: bucket, Key: aws.String(r.Key), Range: optional(r.Range)})
+			if err == nil {
+				io.Copy(ioutil.Discard, out.Body) // nolint: errcheck
+				out.Body.Close()                  // nolint: errcheck
+			}
+		case "HeadObject":
+			_, err = c.HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: bucket, Key: aws.String(r.Key)})
+		case "ListObjectsV2":
+			_, err = c.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{Bucket: bucket, Prefix: optional(r.Prefix)})
+		case "PutObject":
+			input := &s3.PutObjectInput{
+				Bucket:       bucket,
+				Key:          aws.String(r.Key),
+				Metadata:     meta,
+				StorageClass: optional(r.StorageClass),
+				Body:         io.NewSectionReader(&testutil.FakeContentAt{SizeInBytes: r.Bytes}, 0, r.Bytes),
+			}
+			setInputACL(input, r.ACL)
+			_, err = c.PutObjectWithContext(ctx, input)
+		case "CopyObject":
+			input := &s3.CopyObjectInput{
+				Bucket:       bucket,
+				Key:          aws.String(r.Key),
+				CopySource:   aws.String(r.CopySource),
+				Metadata:     meta,
+				StorageClass: optional(r.StorageClass),
+			}
+			setInputACL(input, r.ACL)
+			_, err = c.CopyObjectWithContext(ctx, input)
+		case "DeleteObject":
+			_, err = c.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{Bucket: bucket, Key: aws.String(r.Key), VersionId: optional(r.VersionID)})
+		case "CreateMultipartUpload":
+			input := &s3.CreateMultipartUploadInput{
+				Bucket:       bucket,
+				Key:          aws.String(r.Key),
+				Metadata:     meta,
+				StorageClass: optional(r.StorageClass),
+			}
+			setInputACL(input, r.ACL)
+			var out *s3.CreateMultipartUploadOutput
+			out, err = c.CreateMultipartUploadWithContext(ctx, input)
+			if err == nil {
+				uploadIDs[r.UploadID] = aws.StringValue(out.UploadId)
+				parts[aws.StringValue(out.UploadId)] = make(map[int64]*s3.CompletedPart)
+			}
+		case "UploadPart":
+			var out *s3.UploadPartOutput
+			out, err = c.UploadPartWithContext(ctx, &s3.UploadPartInput{
+				Bucket:     bucket,
+				Key:        aws.String(r.Key),
+				UploadId:   aws.String(uploadID),
+				PartNumber: aws.Int64(r.PartNumber),
+				Body:       io.NewSectionReader(&testutil.FakeContentAt{SizeInBytes: r.Bytes}, 0, r.Bytes),
+			})
+			if err == nil && parts[uploadID] != nil {
+				parts[uploadID][r.PartNumber] = &s3.CompletedPart{PartNumber: aws.Int64(r.PartNumber), ETag: out.ETag}
+			}
+		case "UploadPartCopy":
+			var out *s3.UploadPartCopyOutput
+			out, err = c.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+				Bucket:          bucket,
+				Key:             aws.String(r.Key),
+				UploadId:        aws.String(uploadID),
+				PartNumber:      aws.Int64(r.PartNumber),
+				CopySource:      aws.String(r.CopySource),
+				CopySourceRange: optional(r.Range),
+			})
+			if err == nil && parts[uploadID] != nil {
+				parts[uploadID][r.PartNumber] = &s3.CompletedPart{PartNumber: aws.Int64(r.PartNumber), ETag: out.CopyPartResult.ETag}
+			}
+		case "CompleteMultipartUpload":
+			var completed []*s3.CompletedPart
+			for _, p := range parts[uploadID] {
+				completed = append(completed, p)
+			}
+			sort.Slice(completed, func(i, j int) bool {
+				return *completed[i].PartNumber < *completed[j].PartNumber
+			})
+			_, err = c.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+				Bucket:          bucket,
+				Key:             aws.String(r.Key),
+				UploadId:        aws.String(uploadID),
+				MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+			})
+		case "AbortMultipartUpload":
+			_, err = c.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   bucket,
+				Key:      aws.String(r.Key),
+				UploadId: aws.String(uploadID),
+			})
+		case "ListParts":
+			_, err = c.ListPartsWithContext(ctx, &s3.ListPartsInput{
+				Bucket:   bucket,
+				Key:      aws.String(r.Key),
+				UploadId: aws.String(uploadID),
+			})
+		case "ListMultipartUploads":
+			_, err = c.ListMultipartUploadsWithContext(ctx, &s3.ListMultipartUploadsInput{Bucket: bucket, Prefix: optional(r.Prefix)})
+		case "GetBucketLocation":
+			_, err = c.GetBucketLocationWithContext(ctx, &s3.GetBucketLocationInput{Bucket: bucket})
+		case "GetObjectTagging":
+			_, err = c.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{Bucket: bucket, Key: aws.String(r.Key)})
+		case "PutObjectTagging":
+			_, err = c.PutObjectTaggingWithContext(ctx, &s3.PutObjectTaggingInput{
+				Bucket:  bucket,
+				Key:     aws.String(r.Key),
+				Tagging: &s3.Tagging{TagSet: tagSet(r.Tags)},
+			})
+		case "DeleteObjectTagging":
+			_, err = c.DeleteObjectTaggingWithContext(ctx, &s3.DeleteObjectTaggingInput{Bucket: bucket, Key: aws.String(r.Key)})
+		case "GetObjectAcl":
+			_, err = c.GetObjectAclWithContext(ctx, &s3.GetObjectAclInput{Bucket: bucket, Key: aws.String(r.Key)})
+		case "PutObjectAcl":
+			input := &s3.PutObjectAclInput{
+				Bucket:              bucket,
+				Key:                 aws.String(r.Key),
+				AccessControlPolicy: r.AccessControlPolicy,
+			}
+			setInputACL(input, r.ACL)
+			_, err = c.PutObjectAclWithContext(ctx, input)
+		case "PutBucketPolicy":
+			_, err = c.PutBucketPolicyWithContext(ctx, &s3.PutBucketPolicyInput{Bucket: bucket, Policy: aws.String(r.Policy)})
+		case "GetBucketPolicy":
+			_, err = c.GetBucketPolicyWithContext(ctx, &s3.GetBucketPolicyInput{Bucket: bucket})
+		case "DeleteBucketPolicy":
+			_, err = c.DeleteBucketPolicyWithContext(ctx, &s3.DeleteBucketPolicyInput{Bucket: bucket})
+		case "ListObjects":
+			_, err = c.ListObjectsWithContext(ctx, &s3.ListObjectsInput{Bucket: bucket, Prefix: optional(r.Prefix)})
+		case "HeadBucket":
+			_, err = c.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: bucket})
+		case "RestoreObject":
+			_, err = c.RestoreObjectWithContext(ctx, &s3.RestoreObjectInput{
+				Bucket:         bucket,
+				Key:            aws.String(r.Key),
+				RestoreRequest: r.RestoreRequest,
+			})
+		case "SelectObjectContent":
+			continue
+		case "PutBucketLifecycleConfiguration":
+			_, err = c.PutBucketLifecycleConfigurationWithContext(ctx, &s3.PutBucketLifecycleConfigurationInput{
+				Bucket:                 bucket,
+				LifecycleConfiguration: &s3.BucketLifecycleConfiguration{Rules: r.LifecycleRules},
+			})
+		case "GetBucketLifecycleConfiguration":
+			_, err = c.GetBucketLifecycleConfigurationWithContext(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: bucket})
+		case "DeleteBucketLifecycle":
+			_, err = c.DeleteBucketLifecycleWithContext(ctx, &s3.DeleteBucketLifecycleInput{Bucket: bucket})
+		case "PutBucketVersioning":
+			_, err = c.PutBucketVersioningWithContext(ctx, &s3.PutBucketVersioningInput{
+				Bucket:                  bucket,
+				VersioningConfiguration: &s3.VersioningConfiguration{Status: aws.String(r.Versioning)},
+			})
+		case "GetBucketVersioning":
+			_, err = c.GetBucketVersioningWithContext(ctx, &s3.GetBucketVersioningInput{Bucket: bucket})
+		case "ListObjectVersions":
+			_, err = c.ListObjectVersionsWithContext(ctx, &s3.ListObjectVersionsInput{Bucket: bucket, Prefix: optional(r.Prefix)})
+		default:
+			if config.skipUnreplayable {
+				continue
+			}
+			return fmt.Errorf("s3test.Replay: record %d: cannot replay %s", i, r.API)
+		}
+		status, code := http.StatusOK, ""
+		if err != nil {
+			status, code = errorStatus(err)
+		}
+		if status != r.Status {
+			mismatches = append(mismatches, ReplayMismatch{Index: i, Record: r, Status: status, ErrCode: code})
+		}
+	}
+	if len(mismatches) > 0 {
+		return &ReplayError{Mismatches: mismatches}
+	}
+	return nil
+}
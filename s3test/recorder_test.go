@@ -0,0 +1,467 @@
+package s3test_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil/expect"
+	"github.com/grailbio/testutil/h"
+	"github.com/grailbio/testutil/s3test"
+)
+
+func TestRecords(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	client.SetFile("data/a", []byte("0123456789"), "")
+	client.SetFile("tmp/b", []byte("b"), "")
+
+	if _, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("data/a"),
+		Range:  aws.String("bytes=2-5"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("missing"),
+	}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, err := client.PutObject(&s3.PutObjectInput{
+		Bucket:   aws.String(testBucket),
+		Key:      aws.String("data/c"),
+		Body:     bytes.NewReader([]byte("contents")),
+		Metadata: map[string]*string{"Owner": aws.String("me")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	records := client.Records()
+	expect.EQ(t, len(records), 3)
+	expect.EQ(t, records[0].API, "GetObject")
+	expect.EQ(t, records[0].Range, "bytes=2-5")
+	expect.EQ(t, records[0].Bytes, int64(4))
+	expect.EQ(t, records[0].Status, http.StatusOK)
+	expect.EQ(t, records[1].API, "HeadObject")
+	expect.EQ(t, records[1].Status, http.StatusNotFound)
+	expect.EQ(t, records[1].ErrCode, "NoSuchKey")
+	expect.EQ(t, records[2].API, "PutObject")
+	expect.EQ(t, records[2].Bytes, int64(8))
+	expect.EQ(t, records[2].Metadata, map[string]string{"Owner": "me"})
+
+	expect.That(t, client.RecordedKeys("GetObject"), h.ElementsAre("data/a"))
+	expect.That(t, client.RecordedKeys("GetObject"), h.Not(h.Contains(h.HasPrefix("tmp/"))))
+
+	client.ResetRecords()
+	expect.EQ(t, len(client.Records()), 0)
+}
+
+func TestRecordFailures(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	client.SetFile("a", []byte("0123456789"), "")
+	get := func() error {
+		_, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: aws.String(testBucket), Key: aws.String("a")})
+		return err
+	}
+	copy := func() error {
+		_, err := client.CopyObject(&s3.CopyObjectInput{
+			Bucket:     aws.String(testBucket),
+			Key:        aws.String("b"),
+			CopySource: aws.String(testBucket + "/a"),
+		})
+		return err
+	}
+
+	client.Err = func(api string, input interface{}) error {
+		if api == "GetObjectWithContext" || api == "CopyObject" {
+			return awserr.New("InternalError", "injected error", nil)
+		}
+		return nil
+	}
+	expect.EQ(t, awsErrCode(get()), "InternalError")
+	expect.EQ(t, awsErrCode(copy()), "InternalError")
+	client.Err = nil
+
+	_, err := client.PutBucketPolicy(&s3.PutBucketPolicyInput{Bucket: aws.String(testBucket), Policy: aws.String(testPolicy)})
+	expect.NoError(t, err)
+	client.Principal = "stranger"
+	expect.EQ(t, awsErrCode(get()), "AccessDenied")
+	client.Principal = ""
+
+	client.Clock = s3test.NewFakeClock(epoch)
+	client.Network = &s3test.Network{RequestRate: 1}
+	_, err = client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(testBucket)})
+	expect.NoError(t, err)
+	expect.EQ(t, awsErrCode(get()), "SlowDown")
+	client.Network = nil
+
+	var got []string
+	for _, r := range client.Records() {
+		switch r.API {
+		case "GetObject", "CopyObject":
+			expect.EQ(t, r.Bytes, int64(0))
+			got = append(got, r.API+" "+r.ErrCode)
+		}
+	}
+	expect.EQ(t, got, []string{
+		"GetObject InternalError",
+		"CopyObject InternalError",
+		"GetObject AccessDenied",
+		"GetObject SlowDown",
+	})
+}
+
+func TestReplay(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	client.Clock = s3test.NewFakeClock(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	client.MinPartSize = 1
+	client.SetFile("src", []byte("source"), "")
+	if _, err := client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("a"),
+		Body:   bytes.NewReader([]byte("contents")),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	id := createUpload(t, client, "mp")
+	p1 := uploadPart(t, client, "mp", id, 1, []byte("part1"))
+	p2 := uploadPart(t, client, "mp", id, 2, []byte("part2!"))
+	if _, err := completeUpload(client, "mp", id, p1, p2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("copy"),
+		CopySource: aws.String(testBucket + "/src"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(testBucket), Key: aws.String("a")}); err != nil {
+		t.Fatal(err)
+	}
+	listKeys(t, client, "")
+	id = createUpload(t, client, "pending")
+	uploadPart(t, client, "pending", id, 1, []byte("part"))
+	if _, err := client.ListParts(&s3.ListPartsInput{
+		Bucket: aws.String(testBucket), Key: aws.String("pending"), UploadId: aws.String(id),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ListMultipartUploads(&s3.ListMultipartUploadsInput{Bucket: aws.String(testBucket)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetBucketLocationWithContext(ctx, &s3.GetBucketLocationInput{Bucket: aws.String(testBucket)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := client.WriteRecords(&buf); err != nil {
+		t.Fatal(err)
+	}
+	records, err := s3test.ReadRecords(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect.EQ(t, records, client.Records())
+
+	replayed := s3test.NewClient(t, testBucket)
+	replayed.MinPartSize = 1
+	replayed.SetFile("src", []byte("source"), "")
+	if err := replayed.Replay(records); err != nil {
+		t.Fatal(err)
+	}
+	apis := func(records []s3test.Record) []string {
+		var r []string
+		for _, rec := range records {
+			r = append(r, rec.API+" "+rec.Key+" "+http.StatusText(rec.Status))
+		}
+		return r
+	}
+	expect.EQ(t, apis(replayed.Records()), apis(records))
+	want, got := listKeys(t, client, ""), listKeys(t, replayed, "")
+	sort.Strings(want)
+	sort.Strings(got)
+	expect.EQ(t, got, want)
+	expect.EQ(t, replayed.MustGetFile("mp").Content.Size(), int64(11))
+
+	unknown := []s3test.Record{{API: "UnknownAPI"}, {API: "HeadObject", Key: "mp", Status: http.StatusOK}}
+	replayed.ResetRecords()
+	if err := replayed.Replay(unknown); err == nil {
+		t.Error("expected an error")
+	}
+	if err := replayed.Replay(unknown, s3test.SkipUnreplayable()); err != nil {
+		t.Error(err)
+	}
+	expect.EQ(t, apis(replayed.Records()), []string{"HeadObject mp OK"})
+}
+
+func TestReplayMismatches(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	body := []byte("contents")
+	if _, err := client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:   aws.String(testBucket),
+		Key:      aws.String("a"),
+		Body:     bytes.NewReader(body),
+		Metadata: map[string]*string{"Content-Sha256": aws.String(fmt.Sprintf("%x", sha256.Sum256(body)))},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b"} {
+		_, err := client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: aws.String(testBucket), Key: aws.String(key)})
+		expect.EQ(t, err == nil, key == "a")
+	}
+
+	// The recorded checksum does not apply to the replayed contents.
+	replayed := s3test.NewClient(t, testBucket)
+	expect.NoError(t, replayed.Replay(client.Records()))
+
+	replayed = s3test.NewClient(t, testBucket)
+	replayed.SetFile("b", []byte("b"), "")
+	err := replayed.Replay(client.Records())
+	rerr, ok := err.(*s3test.ReplayError)
+	if !ok {
+		t.Fatalf("got %v, want a *ReplayError", err)
+	}
+	expect.EQ(t, len(rerr.Mismatches), 1)
+	m := rerr.Mismatches[0]
+	expect.EQ(t, m.Index, 2)
+	expect.EQ(t, m.Record.Key, "b")
+	expect.EQ(t, m.Record.Status, http.StatusNotFound)
+	expect.EQ(t, m.Status, http.StatusOK)
+	expect.HasSubstr(t, err.Error(), `record 2: HeadObject b: got status 200 "", recorded 404 "NoSuchKey"`)
+}
+
+func TestReplayVersioning(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	expect.NoError(t, putVersioning(client, s3.BucketVersioningStatusEnabled))
+	v1 := putVersion(t, client, "a", "v1")
+	putVersion(t, client, "a", "v2")
+	_, err := client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(testBucket), Key: aws.String("a"), VersionId: aws.String(v1)})
+	expect.NoError(t, err)
+	_, err = client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(testBucket), Key: aws.String("a")})
+	expect.NoError(t, err)
+
+	replayed := s3test.NewClient(t, testBucket)
+	expect.NoError(t, replayed.Replay(client.Records()))
+	expect.EQ(t, listVersions(t, replayed), listVersions(t, client))
+}
+
+func TestReplayTagging(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	client.SetFile("a", []byte("a"), "")
+	client.SetFile("b", []byte("b"), "")
+	for _, key := range []string{"a", "b"} {
+		if _, err := client.PutObjectTaggingWithContext(ctx, &s3.PutObjectTaggingInput{
+			Bucket: aws.String(testBucket),
+			Key:    aws.String(key),
+			Tagging: &s3.Tagging{TagSet: []*s3.Tag{
+				{Key: aws.String("owner"), Value: aws.String("me")},
+				{Key: aws.String("key"), Value: aws.String(key)},
+			}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := client.DeleteObjectTaggingWithContext(ctx, &s3.DeleteObjectTaggingInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("b"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	tags(t, client, "a")
+
+	replayed := s3test.NewClient(t, testBucket)
+	replayed.SetFile("a", []byte("a"), "")
+	replayed.SetFile("b", []byte("b"), "")
+	if err := replayed.Replay(client.Records()); err != nil {
+		t.Fatal(err)
+	}
+	expect.EQ(t, len(replayed.Records()), len(client.Records()))
+	expect.EQ(t, tags(t, replayed, "a"), map[string]string{"owner": "me", "key": "a"})
+	expect.EQ(t, tags(t, replayed, "b"), map[string]string{})
+}
+
+func TestReplayLifecycle(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	rule := func(prefix string) *s3.LifecycleRule {
+		return &s3.LifecycleRule{
+			ID:         aws.String(prefix),
+			Status:     aws.String(s3.ExpirationStatusEnabled),
+			Filter:     &s3.LifecycleRuleFilter{Prefix: aws.String(prefix)},
+			Expiration: &s3.LifecycleExpiration{Days: aws.Int64(7)},
+		}
+	}
+	if err := putLifecycle(client, rule("tmp/")); err != nil {
+		t.Fatal(err)
+	}
+	expect.EQ(t, awsErrCode(putLifecycle(client)), "MalformedXML")
+	if _, err := client.DeleteBucketLifecycleWithContext(ctx, &s3.DeleteBucketLifecycleInput{Bucket: aws.String(testBucket)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := putLifecycle(client, rule("logs/"), rule("cache/")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetBucketLifecycleConfigurationWithContext(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(testBucket)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := client.WriteRecords(&buf); err != nil {
+		t.Fatal(err)
+	}
+	records, err := s3test.ReadRecords(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := s3test.NewClient(t, testBucket)
+	if err := replayed.Replay(records); err != nil {
+		t.Fatal(err)
+	}
+	statuses := func(records []s3test.Record) []string {
+		var r []string
+		for _, rec := range records {
+			r = append(r, rec.API+" "+rec.ErrCode)
+		}
+		return r
+	}
+	expect.EQ(t, statuses(replayed.Records()), statuses(client.Records()))
+	want, err := client.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(testBucket)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := replayed.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(testBucket)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect.EQ(t, got.Rules, want.Rules)
+}
+
+func TestReplayAccessControl(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	if _, err := client.PutBucketPolicyWithContext(ctx, &s3.PutBucketPolicyInput{
+		Bucket: aws.String(testBucket),
+		Policy: aws.String(testPolicy),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range []*s3.PutObjectInput{
+		{Key: aws.String("public"), ACL: aws.String(s3.ObjectCannedACLPublicRead)},
+		{Key: aws.String("private")},
+		{Key: aws.String("data/a")},
+	} {
+		input.Bucket, input.Body = aws.String(testBucket), bytes.NewReader([]byte("x"))
+		if _, err := client.PutObjectWithContext(ctx, input); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := client.PutObjectAclWithContext(ctx, &s3.PutObjectAclInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("private"),
+		AccessControlPolicy: &s3.AccessControlPolicy{Grants: []*s3.Grant{{
+			Grantee:    &s3.Grantee{Type: aws.String(s3.TypeCanonicalUser), ID: aws.String("reader")},
+			Permission: aws.String(s3.PermissionRead),
+		}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetObjectAclWithContext(ctx, &s3.GetObjectAclInput{Bucket: aws.String(testBucket), Key: aws.String("private")}); err != nil {
+		t.Fatal(err)
+	}
+	client.Principal = "reader"
+	for _, key := range []string{"public", "private", "data/a"} {
+		if _, err := getString(t, client, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client.Principal = "stranger"
+	_, err := getString(t, client, "data/a")
+	expect.EQ(t, awsErrCode(err), "AccessDenied")
+	client.Principal = ""
+	if _, err := client.GetBucketPolicyWithContext(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(testBucket)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.DeleteBucketPolicyWithContext(ctx, &s3.DeleteBucketPolicyInput{Bucket: aws.String(testBucket)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := client.WriteRecords(&buf); err != nil {
+		t.Fatal(err)
+	}
+	records, err := s3test.ReadRecords(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := s3test.NewClient(t, testBucket)
+	if err := replayed.Replay(records); err != nil {
+		t.Fatal(err)
+	}
+	outcomes := func(records []s3test.Record) []string {
+		var r []string
+		for _, rec := range records {
+			r = append(r, rec.API+" "+rec.Key+" "+rec.Principal+" "+rec.ErrCode)
+		}
+		return r
+	}
+	expect.EQ(t, outcomes(replayed.Records()), outcomes(client.Records()))
+	expect.EQ(t, replayed.Principal, "")
+}
+
+func TestReplayRestore(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	client.Clock = s3test.NewFakeClock(epoch)
+	if _, err := client.PutObject(&s3.PutObjectInput{
+		Bucket:       aws.String(testBucket),
+		Key:          aws.String("cold"),
+		Body:         bytes.NewReader([]byte("cold")),
+		StorageClass: aws.String(s3.StorageClassGlacier),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreObject(client, "cold", s3.TierExpedited, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ListObjectsWithContext(ctx, &s3.ListObjectsInput{Bucket: aws.String(testBucket)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(testBucket)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.SelectObjectContent(&s3.SelectObjectContentInput{Bucket: aws.String(testBucket), Key: aws.String("cold")}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	var buf bytes.Buffer
+	if err := client.WriteRecords(&buf); err != nil {
+		t.Fatal(err)
+	}
+	records, err := s3test.ReadRecords(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := s3test.NewClient(t, testBucket)
+	replayed.Clock = s3test.NewFakeClock(epoch)
+	if err := replayed.Replay(records); err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, rec := range records[:len(records)-1] {
+		want = append(want, rec.API+" "+rec.ErrCode)
+	}
+	var got []string
+	for _, rec := range replayed.Records() {
+		got = append(got, rec.API+" "+rec.ErrCode)
+	}
+	expect.EQ(t, got, want)
+	expect.EQ(t, replayed.MustGetFile("cold").StorageClass, s3.StorageClassGlacier)
+	expect.EQ(t, restoreHeader(t, replayed, "cold"), restoreHeader(t, client, "cold"))
+}
@@ -0,0 +1,164 @@
+package s3test
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// restoreDelays are the times taken to restore archived objects, by storage
+// class and retrieval tier. They are the upper bounds documented by S3.
+var restoreDelays = map[string]map[string]time.Duration{
+	s3.StorageClassGlacier: {
+		s3.TierExpedited: 5 * time.Minute,
+		s3.TierStandard:  5 * time.Hour,
+		s3.TierBulk:      12 * time.Hour,
+	},
+	s3.StorageClassDeepArchive: {
+		s3.TierStandard: 12 * time.Hour,
+		s3.TierBulk:     48 * time.Hour,
+	},
+}
+
+// archived reports whether f is in an archival storage class, whose objects
+// must be restored before they can be read.
+func archived(f FileContent) bool {
+	_, ok := restoreDelays[f.StorageClass]
+	return ok
+}
+
+// restored reports whether a restored copy of archived object f is
+// available at time now.
+func restored(f FileContent, now time.Time) bool {
+	return !f.RestoreReady.IsZero() && !now.Before(f.RestoreReady) && now.Before(f.RestoreExpiry)
+}
+
+// checkReadable returns InvalidObjectState if f is archived and not
+// restored.
+func (c *Client) checkReadable(api string, f FileContent) error {
+	if !archived(f) || restored(f, c.now()) {
+		return nil
+	}
+	return awserr.NewRequestFailure(awserr.New("InvalidObjectState",
+		fmt.Sprintf("%s: the operation is not valid for the object's storage class %s", api, f.StorageClass), nil),
+		http.StatusForbidden, "")
+}
+
+// restoreStatus returns the value of the x-amz-restore header for f, if
+// any.
+func (c *Client) restoreStatus(f FileContent) *string {
+	now := c.now()
+	switch {
+	case !archived(f) || f.RestoreReady.IsZero() || !now.Before(f.RestoreExpiry):
+		return nil
+	case now.Before(f.RestoreReady):
+		return aws.String(`ongoing-request="true"`)
+	}
+	return aws.String(fmt.Sprintf(`ongoing-request="false", expiry-date="%s"`,
+		f.RestoreExpiry.UTC().Format(http.TimeFormat)))
+}
+
+// RestoreObject restores a temporary copy of an object in the GLACIER or
+// DEEP_ARCHIVE storage class (set by PutObject or a lifecycle transition).
+// Until then, GetObject, CopyObject and SelectObjectContent fail with
+// InvalidObjectState. The restoration completes, according to the client's
+// Clock, after the longest time S3 documents for the requested retrieval
+// tier (e.g., 5 hours for a Standard retrieval from GLACIER); the copy then
+// expires after the requested number of days. HeadObject reports the
+// progress of the restoration. Select restore requests are not supported.
+func (c *Client) RestoreObject(input *s3.RestoreObjectInput) (output *s3.RestoreObjectOutput, err error) {
+	rec := c.record("RestoreObject", input)
+	defer rec.done(&output, &err)
+	return c.restoreObject(input)
+}
+
+// restoreObject implements RestoreObject and RestoreObjectRequest.
+func (c *Client) restoreObject(input *s3.RestoreObjectInput) (output *s3.RestoreObjectOutput, err error) {
+	if err := c.startRequest("RestoreObject", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("RestoreObject", input.Bucket); err != nil {
+		return nil, err
+	}
+	restore := input.RestoreRequest
+	if restore == nil {
+		restore = &s3.RestoreRequest{}
+	}
+	if aws.StringValue(restore.Type) == s3.RestoreRequestTypeSelect {
+		return nil, awserr.NewRequestFailure(awserr.New("NotImplemented",
+			"s3test: select restore requests are not supported", nil), http.StatusNotImplemented, "")
+	}
+	days := aws.Int64Value(restore.Days)
+	if days < 1 {
+		return nil, awserr.New("InvalidArgument", "RestoreObject: Days must be a positive integer", nil)
+	}
+	tier := aws.StringValue(restore.Tier)
+	if params := restore.GlacierJobParameters; params != nil && params.Tier != nil {
+		tier = *params.Tier
+	}
+	if tier == "" {
+		tier = s3.TierStandard
+	}
+
+	key := aws.StringValue(input.Key)
+	c.m.Lock()
+	defer c.m.Unlock()
+	f, ok := c.content[key]
+	if !ok {
+		return nil, awserr.New("NoSuchKey", "Object not found", nil)
+	}
+	if !archived(f) {
+		return nil, awserr.NewRequestFailure(awserr.New("InvalidObjectState",
+			fmt.Sprintf("RestoreObject: object in storage class %q cannot be restored", f.StorageClass), nil),
+			http.StatusForbidden, "")
+	}
+	delay, ok := restoreDelays[f.StorageClass][tier]
+	if !ok {
+		return nil, awserr.New("InvalidArgument",
+			fmt.Sprintf("RestoreObject: tier %q is not supported for storage class %s", tier, f.StorageClass), nil)
+	}
+	now := c.now()
+	switch {
+	case !f.RestoreReady.IsZero() && now.Before(f.RestoreReady):
+		return nil, awserr.NewRequestFailure(awserr.New("RestoreAlreadyInProgress",
+			"Object restore is already in progress", nil), http.StatusConflict, "")
+	case restored(f, now):
+		// Extend the restored copy's lifetime.
+		f.RestoreExpiry = lifecycleDeadline(now, days)
+	default:
+		f.RestoreReady = now.Add(delay)
+		f.RestoreExpiry = lifecycleDeadline(f.RestoreReady, days)
+	}
+	c.putLocked(key, f)
+	return &s3.RestoreObjectOutput{}, nil
+}
+
+// RestoreObjectRequest implements the request variant of RestoreObject.
+func (c *Client) RestoreObjectRequest(input *s3.RestoreObjectInput) (req *request.Request, output *s3.RestoreObjectOutput) {
+	req, output = c.svc.RestoreObjectRequest(input)
+	rec := c.record("RestoreObject", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("RestoreObjectRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.restoreObject(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// RestoreObjectWithContext implements the corresponding s3iface.API method.
+func (c *Client) RestoreObjectWithContext(ctx aws.Context, input *s3.RestoreObjectInput, opts ...request.Option) (*s3.RestoreObjectOutput, error) {
+	req, out := c.RestoreObjectRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
@@ -0,0 +1,117 @@
+package s3test_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil/expect"
+	"github.com/grailbio/testutil/s3test"
+)
+
+func restoreObject(client *s3test.Client, key, tier string, days int64) error {
+	_, err := client.RestoreObjectWithContext(ctx, &s3.RestoreObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String(key),
+		RestoreRequest: &s3.RestoreRequest{
+			Days:                 aws.Int64(days),
+			GlacierJobParameters: &s3.GlacierJobParameters{Tier: aws.String(tier)},
+		},
+	})
+	return err
+}
+
+func restoreHeader(t *testing.T, client *s3test.Client, key string) string {
+	out, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(testBucket), Key: aws.String(key)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aws.StringValue(out.Restore)
+}
+
+func TestRestoreObject(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	client.Clock = s3test.NewFakeClock(epoch)
+	_, err := client.PutObject(&s3.PutObjectInput{
+		Bucket:       aws.String(testBucket),
+		Key:          aws.String("cold"),
+		Body:         bytes.NewReader([]byte("cold")),
+		StorageClass: aws.String(s3.StorageClassGlacier),
+	})
+	expect.NoError(t, err)
+	client.SetFile("warm", []byte("warm"), "")
+
+	_, err = getString(t, client, "cold")
+	expect.EQ(t, awsErrCode(err), "InvalidObjectState")
+	expect.EQ(t, statusCode(err), http.StatusForbidden)
+	expect.EQ(t, awsErrCode(restoreObject(client, "warm", s3.TierStandard, 1)), "InvalidObjectState")
+	expect.EQ(t, awsErrCode(restoreObject(client, "cold", s3.TierStandard, 0)), "InvalidArgument")
+	expect.EQ(t, restoreHeader(t, client, "cold"), "")
+
+	expect.NoError(t, restoreObject(client, "cold", s3.TierExpedited, 1))
+	expect.EQ(t, restoreHeader(t, client, "cold"), `ongoing-request="true"`)
+	err = restoreObject(client, "cold", s3.TierExpedited, 1)
+	expect.EQ(t, awsErrCode(err), "RestoreAlreadyInProgress")
+	expect.EQ(t, statusCode(err), http.StatusConflict)
+
+	client.Advance(5 * time.Minute)
+	expect.EQ(t, restoreHeader(t, client, "cold"),
+		`ongoing-request="false", expiry-date="Fri, 03 Jan 2020 00:00:00 GMT"`)
+	data, err := getString(t, client, "cold")
+	expect.NoError(t, err)
+	expect.EQ(t, data, "cold")
+	// The restored copy can be copied to a readable object.
+	_, err = client.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("copy"),
+		CopySource: aws.String(testBucket + "/cold"),
+	})
+	expect.NoError(t, err)
+
+	// The copy expires one day after the restoration, rounded up to midnight.
+	client.Advance(2 * day)
+	_, err = getString(t, client, "cold")
+	expect.EQ(t, awsErrCode(err), "InvalidObjectState")
+	expect.EQ(t, restoreHeader(t, client, "cold"), "")
+	data, err = getString(t, client, "copy")
+	expect.NoError(t, err)
+	expect.EQ(t, data, "cold")
+}
+
+func TestLifecycleTransition(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	client.Clock = s3test.NewFakeClock(epoch)
+	expect.NoError(t, putLifecycle(client, &s3.LifecycleRule{
+		Status: aws.String("Enabled"),
+		Filter: &s3.LifecycleRuleFilter{Prefix: aws.String("logs/")},
+		Transitions: []*s3.Transition{
+			{Days: aws.Int64(30), StorageClass: aws.String(s3.StorageClassGlacier)},
+			{Days: aws.Int64(90), StorageClass: aws.String(s3.StorageClassDeepArchive)},
+		},
+	}))
+	client.SetFile("logs/1", []byte("log"), "")
+	client.SetFile("data", []byte("data"), "")
+	class := func(key string) string {
+		return client.MustGetFile(key).StorageClass
+	}
+
+	client.Advance(30 * day)
+	expect.EQ(t, class("logs/1"), s3.StorageClassGlacier)
+	expect.EQ(t, class("data"), "")
+	_, err := getString(t, client, "logs/1")
+	expect.EQ(t, awsErrCode(err), "InvalidObjectState")
+
+	client.Advance(60 * day)
+	expect.EQ(t, class("logs/1"), s3.StorageClassDeepArchive)
+	expect.EQ(t, awsErrCode(restoreObject(client, "logs/1", s3.TierExpedited, 1)), "InvalidArgument")
+	expect.NoError(t, restoreObject(client, "logs/1", s3.TierBulk, 1))
+	client.Advance(47 * time.Hour)
+	_, err = getString(t, client, "logs/1")
+	expect.EQ(t, awsErrCode(err), "InvalidObjectState")
+	client.Advance(time.Hour)
+	_, err = getString(t, client, "logs/1")
+	expect.NoError(t, err)
+}
@@ -0,0 +1,735 @@
+package s3test
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// selectChunkSize is the maximum payload of a RecordsEvent.
+const selectChunkSize = 64 << 10
+
+func selectError(code, format string, args ...interface{}) error {
+	return awserr.NewRequestFailure(awserr.New(code, fmt.Sprintf(format, args...), nil),
+		http.StatusBadRequest, "")
+}
+
+// selectColumn is a column reference in a select expression: either a
+// positional reference (_1, _2, ...) or a name. Quoted names match exactly;
+// unquoted names match regardless of case.
+type selectColumn struct {
+	qualifier string
+	name      string
+	index     int
+	quoted    bool
+}
+
+func (col selectColumn) String() string {
+	if col.quoted {
+		return col.name
+	}
+	if col.index > 0 {
+		return "_" + strconv.Itoa(col.index)
+	}
+	return col.name
+}
+
+// selectCondition is a comparison between a column and a literal.
+type selectCondition struct {
+	column  selectColumn
+	op      string
+	literal string
+	number  bool
+}
+
+// selectQuery is a parsed select expression.
+type selectQuery struct {
+	count   bool
+	columns []selectColumn // nil for *
+	where   []selectCondition
+	limit   int64 // negative if none
+}
+
+// selectOperators are the comparison operators of select expressions.
+var selectOperators = map[string]bool{"=": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true}
+
+// selectToken is a lexical token of a select expression. Kind is one of
+// 'i' (identifier or keyword), 'q' (quoted identifier), 's' (string
+// literal), 'n' (number) and 'o' (operator or punctuation).
+type selectToken struct {
+	kind byte
+	text string
+}
+
+func lexSelect(expr string) ([]selectToken, error) {
+	var tokens []selectToken
+	for i := 0; i < len(expr); {
+		r, size := utf8.DecodeRuneInString(expr[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '"' || r == '\'':
+			j := strings.IndexRune(expr[i+1:], r)
+			if j < 0 {
+				return nil, selectError("ParseUnexpectedToken", "unterminated quote at offset %d", i)
+			}
+			kind := byte('q')
+			if r == '\'' {
+				kind = 's'
+			}
+			tokens = append(tokens, selectToken{kind, expr[i+1 : i+1+j]})
+			i += j + 2
+		case r == '_' || unicode.IsLetter(r):
+			j := i + size
+			for j < len(expr) {
+				r, size := utf8.DecodeRuneInString(expr[j:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				j += size
+			}
+			tokens = append(tokens, selectToken{'i', expr[i:j]})
+			i = j
+		case r == '-' || unicode.IsDigit(r):
+			j := i + 1
+			for j < len(expr) && (expr[j] == '.' || unicode.IsDigit(rune(expr[j]))) {
+				j++
+			}
+			if _, err := strconv.ParseFloat(expr[i:j], 64); err != nil {
+				return nil, selectError("ParseInvalidTypeParam", "invalid number %q", expr[i:j])
+			}
+			tokens = append(tokens, selectToken{'n', expr[i:j]})
+			i = j
+		default:
+			op := string(r)
+			for _, two := range []string{"<=", ">=", "<>", "!="} {
+				if strings.HasPrefix(expr[i:], two) {
+					op = two
+				}
+			}
+			if !selectOperators[op] && !strings.Contains("*,.()", op) {
+				return nil, selectError("ParseUnexpectedToken", "unexpected character %q", r)
+			}
+			tokens = append(tokens, selectToken{'o', op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+// selectParser parses the subset of the S3 Select SQL dialect that s3test
+// supports:
+//
+//	SELECT * | COUNT(*) | column, ... FROM S3Object [[AS] alias]
+//	    [WHERE column op literal [AND ...]] [LIMIT n]
+//
+// where op is one of =, !=, <>, <, <=, > and >=.
+type selectParser struct {
+	tokens []selectToken
+	pos    int
+}
+
+func (p *selectParser) peek() selectToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return selectToken{}
+}
+
+// next consumes the next token if it is of one of the given kinds.
+func (p *selectParser) next(kinds string) (selectToken, bool) {
+	t := p.peek()
+	if t.kind == 0 || strings.IndexByte(kinds, t.kind) < 0 {
+		return t, false
+	}
+	p.pos++
+	return t, true
+}
+
+// keyword consumes the next token if it is the keyword kw.
+func (p *selectParser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == 'i' && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// punct consumes the next token if it is the operator or punctuation op.
+func (p *selectParser) punct(op string) bool {
+	if t := p.peek(); t.kind == 'o' && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *selectParser) unsupported() error {
+	if t := p.peek(); t.kind != 0 {
+		return selectError("ParseUnsupportedSyntax", "s3test: unsupported syntax at %q", t.text)
+	}
+	return selectError("ParseUnexpectedTerm", "unexpected end of expression")
+}
+
+func (p *selectParser) column() (selectColumn, error) {
+	var col selectColumn
+	t, ok := p.next("iq")
+	if !ok {
+		return col, p.unsupported()
+	}
+	if p.punct(".") {
+		col.qualifier = t.text
+		if t, ok = p.next("iq"); !ok {
+			return col, p.unsupported()
+		}
+	}
+	col.name, col.quoted = t.text, t.kind == 'q'
+	if !col.quoted && len(col.name) > 1 && col.name[0] == '_' {
+		if n, err := strconv.Atoi(col.name[1:]); err == nil && n > 0 {
+			col.index = n
+		}
+	}
+	return col, nil
+}
+
+func parseSelect(expr string) (*selectQuery, error) {
+	tokens, err := lexSelect(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &selectParser{tokens: tokens}
+	q := &selectQuery{limit: -1}
+	if !p.keyword("SELECT") {
+		return nil, p.unsupported()
+	}
+	switch {
+	case p.punct("*"):
+	case p.keyword("COUNT"):
+		if !p.punct("(") || !p.punct("*") || !p.punct(")") {
+			return nil, p.unsupported()
+		}
+		q.count = true
+	default:
+		for {
+			col, err := p.column()
+			if err != nil {
+				return nil, err
+			}
+			q.columns = append(q.columns, col)
+			if !p.punct(",") {
+				break
+			}
+		}
+	}
+	if !p.keyword("FROM") || !p.keyword("S3Object") {
+		return nil, p.unsupported()
+	}
+	alias := "S3Object"
+	p.keyword("AS")
+	if t := p.peek(); t.kind == 'i' && !strings.EqualFold(t.text, "WHERE") && !strings.EqualFold(t.text, "LIMIT") {
+		alias = t.text
+		p.pos++
+	}
+	if p.keyword("WHERE") {
+		for {
+			col, err := p.column()
+			if err != nil {
+				return nil, err
+			}
+			op, ok := p.next("o")
+			if !ok || !selectOperators[op.text] {
+				if ok {
+					p.pos--
+				}
+				return nil, p.unsupported()
+			}
+			lit, ok := p.next("sn")
+			if !ok {
+				return nil, p.unsupported()
+			}
+			q.where = append(q.where, selectCondition{col, op.text, lit.text, lit.kind == 'n'})
+			if !p.keyword("AND") {
+				break
+			}
+		}
+	}
+	if p.keyword("LIMIT") {
+		t := p.peek()
+		n, err := strconv.ParseInt(t.text, 10, 64)
+		if t.kind != 'n' || err != nil || n < 0 {
+			return nil, p.unsupported()
+		}
+		p.pos++
+		q.limit = n
+	}
+	if p.pos != len(p.tokens) {
+		return nil, p.unsupported()
+	}
+	cols := append([]selectColumn(nil), q.columns...)
+	for _, cond := range q.where {
+		cols = append(cols, cond.column)
+	}
+	for _, col := range cols {
+		if col.qualifier != "" && !strings.EqualFold(col.qualifier, alias) {
+			return nil, selectError("ParseInvalidPathComponent", "unknown table alias %q", col.qualifier)
+		}
+	}
+	return q, nil
+}
+
+// selectRecord is a record read from an object. Values holds raw JSON
+// values if the object is JSON, and strings otherwise; names is nil for CSV
+// objects without a header.
+type selectRecord struct {
+	names  []string
+	values []string
+	json   bool
+}
+
+// lookup returns the raw value of col in r.
+func (r selectRecord) lookup(col selectColumn) (string, bool) {
+	if col.index > 0 && !r.json {
+		if col.index > len(r.values) {
+			return "", false
+		}
+		return r.values[col.index-1], true
+	}
+	for i, name := range r.names {
+		if name == col.name || (!col.quoted && strings.EqualFold(name, col.name)) {
+			return r.values[i], true
+		}
+	}
+	return "", false
+}
+
+// text returns value as a string, decoding JSON strings.
+func (r selectRecord) text(value string) string {
+	var s string
+	if r.json && json.Unmarshal([]byte(value), &s) == nil {
+		return s
+	}
+	return value
+}
+
+// jsonValue returns value as JSON.
+func (r selectRecord) jsonValue(value string) string {
+	if r.json {
+		return value
+	}
+	b, _ := json.Marshal(value)
+	return string(b)
+}
+
+func (cond selectCondition) eval(r selectRecord) bool {
+	value, ok := r.lookup(cond.column)
+	if !ok {
+		return false
+	}
+	value = r.text(value)
+	var cmp int
+	if cond.number {
+		x, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		y, _ := strconv.ParseFloat(cond.literal, 64)
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(value, cond.literal)
+	}
+	switch cond.op {
+	case "=":
+		return cmp == 0
+	case "!=", "<>":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+// project returns the record that q selects from r.
+func (q *selectQuery) project(r selectRecord) selectRecord {
+	if q.columns == nil {
+		if r.names == nil {
+			r.names = make([]string, len(r.values))
+			for i := range r.values {
+				r.names[i] = "_" + strconv.Itoa(i+1)
+			}
+		}
+		return r
+	}
+	out := selectRecord{json: r.json}
+	for _, col := range q.columns {
+		value, ok := r.lookup(col)
+		if !ok {
+			if r.json {
+				// Missing JSON attributes are omitted.
+				continue
+			}
+			value = ""
+		}
+		out.names = append(out.names, col.String())
+		out.values = append(out.values, value)
+	}
+	return out
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// selectRune returns the single character in s, or def if s is empty.
+func selectRune(field, s string, def rune) (rune, error) {
+	if s == "" {
+		return def, nil
+	}
+	if utf8.RuneCountInString(s) != 1 {
+		return 0, selectError("InvalidArgument", "%s must be a single character: %q", field, s)
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return r, nil
+}
+
+// readCSVRecords reads the records of a CSV object.
+func readCSVRecords(r io.Reader, in *s3.CSVInput, fn func(selectRecord) bool) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return selectError("CSVParsingError", "%v", err)
+	}
+	if d := aws.StringValue(in.RecordDelimiter); d != "" && d != "\n" && d != "\r\n" {
+		data = bytes.Replace(data, []byte(d), []byte("\n"), -1)
+	}
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+	if cr.Comma, err = selectRune("FieldDelimiter", aws.StringValue(in.FieldDelimiter), ','); err != nil {
+		return err
+	}
+	if cr.Comment, err = selectRune("Comments", aws.StringValue(in.Comments), 0); err != nil {
+		return err
+	}
+	var (
+		names  []string
+		header = aws.StringValue(in.FileHeaderInfo)
+	)
+	for first := true; ; first = false {
+		values, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return selectError("CSVParsingError", "%v", err)
+		}
+		if first && header == s3.FileHeaderInfoUse {
+			names = values
+			continue
+		}
+		if first && header == s3.FileHeaderInfoIgnore {
+			continue
+		}
+		if !fn(selectRecord{names: names, values: values}) {
+			return nil
+		}
+	}
+}
+
+// readJSONRecords reads the records of a JSON object, which is a sequence
+// of JSON objects, one per line or otherwise. The order of the attributes
+// of each record is preserved.
+func readJSONRecords(r io.Reader, fn func(selectRecord) bool) error {
+	dec := json.NewDecoder(r)
+	for {
+		t, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return selectError("JSONParsingError", "%v", err)
+		}
+		if t != json.Delim('{') {
+			return selectError("JSONParsingError", "s3test: records must be JSON objects")
+		}
+		rec := selectRecord{json: true}
+		for dec.More() {
+			t, err := dec.Token()
+			if err != nil {
+				return selectError("JSONParsingError", "%v", err)
+			}
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return selectError("JSONParsingError", "%v", err)
+			}
+			rec.names = append(rec.names, t.(string))
+			rec.values = append(rec.values, string(value))
+		}
+		if _, err := dec.Token(); err != nil {
+			return selectError("JSONParsingError", "%v", err)
+		}
+		if !fn(rec) {
+			return nil
+		}
+	}
+}
+
+// writeSelectRecord appends r to buf in the output serialization out.
+func writeSelectRecord(buf *bytes.Buffer, r selectRecord, out *s3.OutputSerialization) {
+	if out.JSON != nil {
+		buf.WriteByte('{')
+		for i, name := range r.names {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			b, _ := json.Marshal(name)
+			buf.Write(b)
+			buf.WriteByte(':')
+			buf.WriteString(r.jsonValue(r.values[i]))
+		}
+		buf.WriteByte('}')
+		if d := aws.StringValue(out.JSON.RecordDelimiter); d != "" {
+			buf.WriteString(d)
+		} else {
+			buf.WriteByte('\n')
+		}
+		return
+	}
+	var (
+		delim  = aws.StringValue(out.CSV.FieldDelimiter)
+		record = aws.StringValue(out.CSV.RecordDelimiter)
+		quote  = aws.StringValue(out.CSV.QuoteCharacter)
+	)
+	if delim == "" {
+		delim = ","
+	}
+	if record == "" {
+		record = "\n"
+	}
+	if quote == "" {
+		quote = `"`
+	}
+	always := aws.StringValue(out.CSV.QuoteFields) == s3.QuoteFieldsAlways
+	for i, value := range r.values {
+		if i > 0 {
+			buf.WriteString(delim)
+		}
+		value = r.text(value)
+		if always || strings.Contains(value, delim) || strings.Contains(value, quote) ||
+			strings.Contains(value, record) || strings.ContainsAny(value, "\r\n") {
+			value = quote + strings.Replace(value, quote, quote+quote, -1) + quote
+		}
+		buf.WriteString(value)
+	}
+	buf.WriteString(record)
+}
+
+// selectEventStream is a SelectObjectContentEventStreamReader (and the
+// stream's closer) that delivers precomputed events.
+type selectEventStream struct {
+	events chan s3.SelectObjectContentEventStreamEvent
+}
+
+func newSelectEventStream(events []s3.SelectObjectContentEventStreamEvent) *s3.SelectObjectContentEventStream {
+	s := &selectEventStream{make(chan s3.SelectObjectContentEventStreamEvent, len(events))}
+	for _, e := range events {
+		s.events <- e
+	}
+	close(s.events)
+	return &s3.SelectObjectContentEventStream{Reader: s, StreamCloser: s}
+}
+
+// Events implements s3.SelectObjectContentEventStreamReader.
+func (s *selectEventStream) Events() <-chan s3.SelectObjectContentEventStreamEvent {
+	return s.events
+}
+
+// Close implements s3.SelectObjectContentEventStreamReader and io.Closer.
+func (s *selectEventStream) Close() error { return nil }
+
+// Err implements s3.SelectObjectContentEventStreamReader.
+func (s *selectEventStream) Err() error { return nil }
+
+// SelectObjectContent evaluates a simple SQL expression over a CSV or JSON
+// object, optionally compressed with GZIP or BZIP2, and returns the results
+// as RecordsEvents, followed by a StatsEvent and an EndEvent. See
+// selectParser for the supported subset of SQL. Parquet objects, and
+// quoting characters other than '"', are not supported.
+func (c *Client) SelectObjectContent(input *s3.SelectObjectContentInput) (output *s3.SelectObjectContentOutput, err error) {
+	rec := c.record("SelectObjectContent", input)
+	defer rec.done(&output, &err)
+	return c.selectObjectContent(input)
+}
+
+// selectObjectContent implements SelectObjectContent and SelectObjectContentRequest.
+func (c *Client) selectObjectContent(input *s3.SelectObjectContentInput) (output *s3.SelectObjectContentOutput, err error) {
+	if err := c.startRequest("SelectObjectContent", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("SelectObjectContent", input.Bucket); err != nil {
+		return nil, err
+	}
+	in, out := input.InputSerialization, input.OutputSerialization
+	if input.Expression == nil || in == nil || out == nil {
+		return nil, selectError("MissingRequiredParameter",
+			"SelectObjectContent: Expression, InputSerialization and OutputSerialization are required")
+	}
+	if typ := aws.StringValue(input.ExpressionType); typ != s3.ExpressionTypeSql {
+		return nil, selectError("InvalidExpressionType", "SelectObjectContent: invalid expression type %q", typ)
+	}
+	if in.Parquet != nil {
+		return nil, awserr.NewRequestFailure(awserr.New("NotImplemented",
+			"s3test: Parquet input is not supported", nil), http.StatusNotImplemented, "")
+	}
+	if (in.CSV == nil) == (in.JSON == nil) {
+		return nil, selectError("InvalidRequest", "SelectObjectContent: exactly one input format must be specified")
+	}
+	if (out.CSV == nil) == (out.JSON == nil) {
+		return nil, selectError("InvalidRequest", "SelectObjectContent: exactly one output format must be specified")
+	}
+	q, err := parseSelect(*input.Expression)
+	if err != nil {
+		return nil, err
+	}
+
+	key := aws.StringValue(input.Key)
+	f, ok := c.readFile(key)
+	if !ok {
+		return nil, awserr.New("NoSuchKey", fmt.Sprintf("key %s not found", key), nil)
+	}
+	if err := readSSECustomer("SelectObjectContent", f,
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5); err != nil {
+		return nil, err
+	}
+	if err := c.checkReadable("SelectObjectContent", f); err != nil {
+		return nil, err
+	}
+	var body io.Reader = io.NewSectionReader(f.Content, 0, f.Content.Size())
+	switch compression := aws.StringValue(in.CompressionType); compression {
+	case "", s3.CompressionTypeNone:
+	case s3.CompressionTypeGzip:
+		if body, err = gzip.NewReader(body); err != nil {
+			return nil, selectError("InvalidCompressionFormat", "SelectObjectContent: %v", err)
+		}
+	case s3.CompressionTypeBzip2:
+		body = bzip2.NewReader(body)
+	default:
+		return nil, selectError("InvalidCompressionFormat", "SelectObjectContent: invalid compression type %q", compression)
+	}
+	processed := &countingReader{r: body}
+
+	var (
+		buf     bytes.Buffer
+		matches int64
+	)
+	fn := func(r selectRecord) bool {
+		if q.limit >= 0 && matches == q.limit {
+			return false
+		}
+		for _, cond := range q.where {
+			if !cond.eval(r) {
+				return true
+			}
+		}
+		matches++
+		if !q.count {
+			writeSelectRecord(&buf, q.project(r), out)
+		}
+		return true
+	}
+	if in.CSV != nil {
+		err = readCSVRecords(processed, in.CSV, fn)
+	} else {
+		err = readJSONRecords(processed, fn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if q.count {
+		writeSelectRecord(&buf, selectRecord{
+			names:  []string{"_1"},
+			values: []string{strconv.FormatInt(matches, 10)},
+			json:   true,
+		}, out)
+	}
+
+	var events []s3.SelectObjectContentEventStreamEvent
+	returned := int64(buf.Len())
+	for buf.Len() > 0 {
+		events = append(events, &s3.RecordsEvent{Payload: append([]byte(nil), buf.Next(selectChunkSize)...)})
+	}
+	scanned := f.Content.Size()
+	if progress := input.RequestProgress; progress != nil && aws.BoolValue(progress.Enabled) {
+		events = append(events, &s3.ProgressEvent{Details: &s3.Progress{
+			BytesScanned:   aws.Int64(scanned),
+			BytesProcessed: aws.Int64(processed.n),
+			BytesReturned:  aws.Int64(returned),
+		}})
+	}
+	events = append(events,
+		&s3.StatsEvent{Details: &s3.Stats{
+			BytesScanned:   aws.Int64(scanned),
+			BytesProcessed: aws.Int64(processed.n),
+			BytesReturned:  aws.Int64(returned),
+		}},
+		&s3.EndEvent{})
+	return &s3.SelectObjectContentOutput{EventStream: newSelectEventStream(events)}, nil
+}
+
+// SelectObjectContentRequest implements the request variant of
+// SelectObjectContent.
+func (c *Client) SelectObjectContentRequest(input *s3.SelectObjectContentInput) (req *request.Request, output *s3.SelectObjectContentOutput) {
+	req, output = c.svc.SelectObjectContentRequest(input)
+	rec := c.record("SelectObjectContent", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("SelectObjectContentRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	// The SDK's handler would read the event stream from the HTTP response.
+	req.Handlers.Unmarshal.Clear()
+	out, err := c.selectObjectContent(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// SelectObjectContentWithContext implements the corresponding s3iface.API
+// method.
+func (c *Client) SelectObjectContentWithContext(ctx aws.Context, input *s3.SelectObjectContentInput, opts ...request.Option) (*s3.SelectObjectContentOutput, error) {
+	req, out := c.SelectObjectContentRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
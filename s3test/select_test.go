@@ -0,0 +1,120 @@
+package s3test_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil/expect"
+	"github.com/grailbio/testutil/s3test"
+)
+
+const selectCSV = `name,age,city
+alice,30,"New York, NY"
+bob,25,Boston
+# a comment
+carol,41,Chicago
+`
+
+// selectString runs a select request and returns the records it yields.
+func selectString(t *testing.T, client *s3test.Client, key, expr string,
+	in *s3.InputSerialization, out *s3.OutputSerialization) (string, error) {
+	resp, err := client.SelectObjectContentWithContext(ctx, &s3.SelectObjectContentInput{
+		Bucket:              aws.String(testBucket),
+		Key:                 aws.String(key),
+		Expression:          aws.String(expr),
+		ExpressionType:      aws.String(s3.ExpressionTypeSql),
+		InputSerialization:  in,
+		OutputSerialization: out,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.EventStream.Close()
+	var (
+		records bytes.Buffer
+		stats   *s3.Stats
+		end     bool
+	)
+	for event := range resp.EventStream.Events() {
+		switch e := event.(type) {
+		case *s3.RecordsEvent:
+			records.Write(e.Payload)
+		case *s3.StatsEvent:
+			stats = e.Details
+		case *s3.EndEvent:
+			end = true
+		}
+	}
+	expect.NoError(t, resp.EventStream.Err())
+	expect.True(t, end)
+	if stats == nil {
+		t.Fatal("no stats event")
+	}
+	expect.EQ(t, aws.Int64Value(stats.BytesReturned), int64(records.Len()))
+	return records.String(), nil
+}
+
+func TestSelectCSV(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	client.SetFile("people.csv", []byte(selectCSV), "")
+	in := &s3.InputSerialization{CSV: &s3.CSVInput{
+		FileHeaderInfo: aws.String(s3.FileHeaderInfoUse),
+		Comments:       aws.String("#"),
+	}}
+	csvOut := &s3.OutputSerialization{CSV: &s3.CSVOutput{}}
+	for _, test := range []struct {
+		expr string
+		want string
+	}{
+		{"SELECT * FROM S3Object", "alice,30,\"New York, NY\"\nbob,25,Boston\ncarol,41,Chicago\n"},
+		{"select s.name FROM S3Object s WHERE s.age > 28", "alice\ncarol\n"},
+		{`SELECT "name", _2 FROM S3Object WHERE city = 'Boston'`, "bob,25\n"},
+		{"SELECT name FROM S3Object WHERE age >= 25 AND age < 41 LIMIT 1", "alice\n"},
+		{"SELECT COUNT(*) FROM S3Object WHERE age <> 25", "2\n"},
+	} {
+		got, err := selectString(t, client, "people.csv", test.expr, in, csvOut)
+		expect.NoError(t, err, test.expr)
+		expect.EQ(t, got, test.want, test.expr)
+	}
+
+	got, err := selectString(t, client, "people.csv", "SELECT name, age FROM S3Object LIMIT 2", in,
+		&s3.OutputSerialization{JSON: &s3.JSONOutput{}})
+	expect.NoError(t, err)
+	expect.EQ(t, got, "{\"name\":\"alice\",\"age\":\"30\"}\n{\"name\":\"bob\",\"age\":\"25\"}\n")
+
+	_, err = selectString(t, client, "people.csv", "SELECT name FROM S3Object ORDER BY name", in, csvOut)
+	expect.EQ(t, awsErrCode(err), "ParseUnsupportedSyntax")
+	_, err = selectString(t, client, "people.csv", "SELECT * FROM S3Object",
+		&s3.InputSerialization{Parquet: &s3.ParquetInput{}}, csvOut)
+	expect.EQ(t, awsErrCode(err), "NotImplemented")
+}
+
+func TestSelectJSON(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(`{"id": 1, "tags": ["a"], "name": "x"}
+{"id": 2, "name": "y"}
+{"id": 3, "name": "z, w"}
+`))
+	expect.NoError(t, err)
+	expect.NoError(t, w.Close())
+	client.SetFile("records.json.gz", buf.Bytes(), "")
+	in := &s3.InputSerialization{
+		JSON:            &s3.JSONInput{Type: aws.String(s3.JSONTypeLines)},
+		CompressionType: aws.String(s3.CompressionTypeGzip),
+	}
+
+	got, err := selectString(t, client, "records.json.gz", "SELECT * FROM S3Object s WHERE s.id < 3", in,
+		&s3.OutputSerialization{JSON: &s3.JSONOutput{RecordDelimiter: aws.String(",")}})
+	expect.NoError(t, err)
+	expect.EQ(t, got, `{"id":1,"tags":["a"],"name":"x"},{"id":2,"name":"y"},`)
+
+	got, err = selectString(t, client, "records.json.gz", "SELECT s.name, s.id FROM S3Object s WHERE s.name != 'x'", in,
+		&s3.OutputSerialization{CSV: &s3.CSVOutput{}})
+	expect.NoError(t, err)
+	expect.EQ(t, got, "y,2\n\"z, w\",3\n")
+}
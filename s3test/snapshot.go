@@ -0,0 +1,192 @@
+package s3test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil"
+)
+
+const (
+	snapshotManifest   = "manifest.json"
+	snapshotObjectsDir = "objects"
+)
+
+// snapshotObject is the manifest entry of a single object in a snapshot.
+type snapshotObject struct {
+	Key          string
+	File         string // path of the contents, relative to the snapshot directory
+	Metadata     map[string]*string
+	LastModified time.Time
+	ETag         string
+
+	ContentType          string            `json:",omitempty"`
+	ContentEncoding      string            `json:",omitempty"`
+	CacheControl         string            `json:",omitempty"`
+	StorageClass         string            `json:",omitempty"`
+	ServerSideEncryption string            `json:",omitempty"`
+	Tags                 map[string]string `json:",omitempty"`
+	ChecksumAlgorithm    string            `json:",omitempty"`
+	Checksum             string            `json:",omitempty"`
+	SSECustomerKeyMD5    string            `json:",omitempty"`
+	Grants               []*s3.Grant       `json:",omitempty"`
+	RestoreReady         *time.Time        `json:",omitempty"`
+	RestoreExpiry        *time.Time        `json:",omitempty"`
+	VersionID            string            `json:",omitempty"`
+}
+
+// optionalTime returns nil for the zero time, so that it is omitted from
+// the manifest.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// Snapshot saves the objects stored in the client, including their
+// metadata, ETags, modification times, ACLs and restorations, to dir, which is created if
+// necessary. The snapshot can be loaded into a client with Restore. Pending
+// multipart uploads, noncurrent versions and delete markers are not saved.
+//
+// Snapshot is typically used to save an expensive fixture once so that it
+// can be shared by many tests, or to inspect the state of the store after a
+// failing test.
+func (c *Client) Snapshot(dir string) error {
+	c.m.Lock()
+	keys := make([]string, 0, len(c.content))
+	files := make(map[string]FileContent, len(c.content))
+	for key, f := range c.content {
+		keys = append(keys, key)
+		files[key] = f
+	}
+	c.m.Unlock()
+	sort.Strings(keys)
+
+	if err := os.MkdirAll(filepath.Join(dir, snapshotObjectsDir), 0777); err != nil {
+		return err
+	}
+	manifest := make([]snapshotObject, len(keys))
+	for i, key := range keys {
+		f := files[key]
+		name := filepath.Join(snapshotObjectsDir, fmt.Sprintf("%08d", i))
+		if err := writeContent(filepath.Join(dir, name), f.Content); err != nil {
+			return fmt.Errorf("s3test.Snapshot %s: %v", key, err)
+		}
+		manifest[i] = snapshotObject{
+			Key:          key,
+			File:         name,
+			Metadata:     f.Metadata,
+			LastModified: f.LastModified,
+			ETag:         f.etag(),
+
+			ContentType:          f.ContentType,
+			ContentEncoding:      f.ContentEncoding,
+			CacheControl:         f.CacheControl,
+			StorageClass:         f.StorageClass,
+			ServerSideEncryption: f.ServerSideEncryption,
+			Tags:                 f.Tags,
+			ChecksumAlgorithm:    f.ChecksumAlgorithm,
+			Checksum:             f.Checksum,
+			SSECustomerKeyMD5:    f.SSECustomerKeyMD5,
+			Grants:               f.Grants,
+			RestoreReady:         optionalTime(f.RestoreReady),
+			RestoreExpiry:        optionalTime(f.RestoreExpiry),
+			VersionID:            f.VersionID,
+		}
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, snapshotManifest), data, 0666)
+}
+
+func writeContent(path string, content testutil.ContentAt) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, io.NewSectionReader(content, 0, content.Size())); err != nil {
+		f.Close() // nolint: errcheck
+		return err
+	}
+	return f.Close()
+}
+
+// Restore replaces the objects stored in the client with those saved in dir
+// by Snapshot, and discards noncurrent versions and delete markers.
+// Restored objects are immediately visible regardless of Consistency.
+func (c *Client) Restore(dir string) error {
+	data, err := ioutil.ReadFile(filepath.Join(dir, snapshotManifest))
+	if err != nil {
+		return err
+	}
+	var manifest []snapshotObject
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("s3test.Restore %s: %v", dir, err)
+	}
+	content := make(map[string]FileContent, len(manifest))
+	for _, obj := range manifest {
+		data, err := ioutil.ReadFile(filepath.Join(dir, obj.File))
+		if err != nil {
+			return fmt.Errorf("s3test.Restore %s: %v", obj.Key, err)
+		}
+		content[obj.Key] = FileContent{
+			Content:      &testutil.ByteContent{Data: data},
+			Metadata:     obj.Metadata,
+			LastModified: obj.LastModified,
+			ETag:         obj.ETag,
+
+			ContentType:          obj.ContentType,
+			ContentEncoding:      obj.ContentEncoding,
+			CacheControl:         obj.CacheControl,
+			StorageClass:         obj.StorageClass,
+			ServerSideEncryption: obj.ServerSideEncryption,
+			Tags:                 obj.Tags,
+			ChecksumAlgorithm:    obj.ChecksumAlgorithm,
+			Checksum:             obj.Checksum,
+			SSECustomerKeyMD5:    obj.SSECustomerKeyMD5,
+			Grants:               obj.Grants,
+			RestoreReady:         aws.TimeValue(obj.RestoreReady),
+			RestoreExpiry:        aws.TimeValue(obj.RestoreExpiry),
+			VersionID:            obj.VersionID,
+		}
+	}
+	c.m.Lock()
+	c.content = content
+	c.pending = make(map[string]*pendingWrite)
+	c.versions = make(map[string][]objectVersion)
+	c.m.Unlock()
+	return nil
+}
+
+// LoadDir seeds the client with the files in the local directory tree rooted
+// at dir, typically a testdata directory. Each regular file is stored under
+// the key formed by prefix followed by the file's slash-separated path
+// relative to dir. Existing objects with other keys are kept.
+func (c *Client) LoadDir(dir, prefix string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		c.setFileContentAt(prefix+filepath.ToSlash(rel), &testutil.ByteContent{Data: data}, make(map[string]*string))
+		return nil
+	})
+}
@@ -0,0 +1,127 @@
+package s3test_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil"
+	"github.com/grailbio/testutil/expect"
+	"github.com/grailbio/testutil/s3test"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	dir, cleanup := testutil.TempDir(t, "", "s3test-snapshot-")
+	defer cleanup()
+
+	client := s3test.NewClient(t, testBucket)
+	client.Clock = s3test.NewFakeClock(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	manifest := []string{"a", "dir/b", "dir/c/", "fake"}
+	for _, key := range manifest[:3] {
+		data := []byte("contents of " + key)
+		client.SetFile(key, data, fmt.Sprintf("%x", sha256.Sum256(data)))
+		client.Clock.(*s3test.FakeClock).Advance(time.Minute)
+	}
+	client.SetFileContentAt("fake", &testutil.FakeContentAt{SizeInBytes: 1000}, "")
+	if _, err := client.PutObjectTagging(&s3.PutObjectTaggingInput{
+		Bucket:  aws.String(testBucket),
+		Key:     aws.String("a"),
+		Tagging: &s3.Tagging{TagSet: []*s3.Tag{{Key: aws.String("k"), Value: aws.String("v")}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.PutObjectAcl(&s3.PutObjectAclInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("dir/b"),
+		ACL:    aws.String(s3.ObjectCannedACLPublicRead),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.PutObject(&s3.PutObjectInput{
+		Bucket:       aws.String(testBucket),
+		Key:          aws.String("cold"),
+		Body:         bytes.NewReader([]byte("cold")),
+		StorageClass: aws.String(s3.StorageClassGlacier),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreObject(client, "cold", s3.TierExpedited, 1); err != nil {
+		t.Fatal(err)
+	}
+	manifest = append(manifest, "cold")
+	if err := client.Snapshot(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := s3test.NewClient(t, testBucket)
+	restored.Clock = client.Clock
+	restored.SetFile("removed", []byte("x"), "")
+	if err := restored.Restore(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := restored.GetFile("removed"); ok {
+		t.Error("Restore should replace existing objects")
+	}
+	if len(restored.MustGetFile("dir/b").Grants) == 0 {
+		t.Error("the ACL of dir/b was not restored")
+	}
+	restored.Principal = "reader"
+	if _, err := restored.GetObject(&s3.GetObjectInput{Bucket: aws.String(testBucket), Key: aws.String("dir/b")}); err != nil {
+		t.Errorf("public-read object: %v", err)
+	}
+	restored.Principal = ""
+	expect.EQ(t, restoreHeader(t, restored, "cold"), restoreHeader(t, client, "cold"))
+	for _, key := range manifest {
+		want, got := client.MustGetFile(key), restored.MustGetFile(key)
+		if got.ETag != want.ETag || !got.LastModified.Equal(want.LastModified) ||
+			aws.StringValue(got.Metadata["Content-Sha256"]) != aws.StringValue(want.Metadata["Content-Sha256"]) {
+			t.Errorf("%s: got %+v, want %+v", key, got, want)
+		}
+		expect.EQ(t, got.Tags, want.Tags)
+		expect.EQ(t, got.Grants, want.Grants)
+		if !got.RestoreReady.Equal(want.RestoreReady) || !got.RestoreExpiry.Equal(want.RestoreExpiry) {
+			t.Errorf("%s: got restoration %v-%v, want %v-%v", key,
+				got.RestoreReady, got.RestoreExpiry, want.RestoreReady, want.RestoreExpiry)
+		}
+		if got, want := string(restored.GetFileContentBytes(key)), string(client.GetFileContentBytes(key)); got != want {
+			t.Errorf("%s: got %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir, cleanup := testutil.TempDir(t, "", "s3test-loaddir-")
+	defer cleanup()
+	testutil.CreateDirectoryTree(t, dir, 2, 2, 1)
+	if err := ioutil.WriteFile(filepath.Join(dir, "d1", "extra"), []byte("extra"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("f0", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	client := s3test.NewClient(t, testBucket)
+	if err := client.LoadDir(dir, "fixture/"); err != nil {
+		t.Fatal(err)
+	}
+	keys := listKeys(t, client, "")
+	if got, want := len(keys), 8; got != want {
+		t.Errorf("got %v, want %d keys", keys, want)
+	}
+	for key, want := range map[string]string{
+		"fixture/f0":       "f0",
+		"fixture/d1/d0/f0": "f0",
+		"fixture/d1/extra": "extra",
+	} {
+		if got := string(client.GetFileContentBytes(key)); got != want {
+			t.Errorf("%s: got %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package s3test
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// sseCustomerAlgorithm is the only algorithm supported by S3 for
+// server-side encryption with customer-provided keys (SSE-C).
+const sseCustomerAlgorithm = "AES256"
+
+// sseCustomerKeyLen is the length, in bytes, of SSE-C keys.
+const sseCustomerKeyLen = 32
+
+// SSECustomerKeyMD5 returns the base64-encoded MD5 of an SSE-C key, as
+// returned by S3 in the SSECustomerKeyMD5 field of responses.
+func SSECustomerKeyMD5(key string) string {
+	sum := md5.Sum([]byte(key))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func invalidSSERequest(msg string) error {
+	return awserr.NewRequestFailure(awserr.New("InvalidRequest", msg, nil), http.StatusBadRequest, "")
+}
+
+// parseSSECustomer validates the SSE-C parameters of a request and returns
+// the MD5 of the key, or "" if the request does not use SSE-C. As with the
+// AWS SDK's request input fields, key is the raw (not base64-encoded) key.
+func parseSSECustomer(api string, alg, key, keyMD5 *string) (string, error) {
+	if alg == nil && key == nil && keyMD5 == nil {
+		return "", nil
+	}
+	if got := aws.StringValue(alg); got != sseCustomerAlgorithm {
+		return "", awserr.NewRequestFailure(awserr.New("InvalidEncryptionAlgorithmError",
+			fmt.Sprintf("%s: the encryption algorithm %q is not supported", api, got), nil),
+			http.StatusBadRequest, "")
+	}
+	if key == nil {
+		return "", invalidSSERequest(fmt.Sprintf("%s: the SSE-C request must provide a key", api))
+	}
+	if n := len(*key); n != sseCustomerKeyLen {
+		return "", awserr.NewRequestFailure(awserr.New("InvalidArgument",
+			fmt.Sprintf("%s: the SSE-C key must be %d bytes, got %d", api, sseCustomerKeyLen, n), nil),
+			http.StatusBadRequest, "")
+	}
+	sum := SSECustomerKeyMD5(*key)
+	if keyMD5 != nil && *keyMD5 != sum {
+		return "", awserr.NewRequestFailure(awserr.New("InvalidArgument",
+			fmt.Sprintf("%s: the calculated MD5 hash of the key did not match the hash that was provided", api), nil),
+			http.StatusBadRequest, "")
+	}
+	return sum, nil
+}
+
+// checkSSECustomer checks that a request reading f presents the SSE-C key,
+// identified by its MD5, that f was written with.
+func checkSSECustomer(api string, f FileContent, keyMD5 string) error {
+	switch {
+	case f.SSECustomerKeyMD5 == "" && keyMD5 == "":
+		return nil
+	case f.SSECustomerKeyMD5 == "":
+		return invalidSSERequest(fmt.Sprintf("%s: the encryption parameters are not applicable to this object", api))
+	case keyMD5 == "":
+		return invalidSSERequest(fmt.Sprintf("%s: the object was stored using a form of server side encryption; "+
+			"the correct parameters must be provided to retrieve the object", api))
+	case f.SSECustomerKeyMD5 != keyMD5:
+		return awserr.NewRequestFailure(awserr.New("AccessDenied",
+			fmt.Sprintf("%s: the SSE-C key does not match the key the object was written with", api), nil),
+			http.StatusForbidden, "")
+	}
+	return nil
+}
+
+// readSSECustomer is checkSSECustomer for requests that carry SSE-C
+// parameters.
+func readSSECustomer(api string, f FileContent, alg, key, keyMD5 *string) error {
+	sum, err := parseSSECustomer(api, alg, key, keyMD5)
+	if err != nil {
+		return err
+	}
+	return checkSSECustomer(api, f, sum)
+}
+
+// sseCustomerAlgorithmOrNil returns the SSE-C algorithm to echo in responses
+// for f.
+func sseCustomerAlgorithmOrNil(f FileContent) *string {
+	if f.SSECustomerKeyMD5 == "" {
+		return nil
+	}
+	return aws.String(sseCustomerAlgorithm)
+}
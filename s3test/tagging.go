@@ -0,0 +1,250 @@
+package s3test
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// maxTags is the maximum number of tags on an object.
+	maxTags = 10
+	// maxTagKeyLen and maxTagValueLen are the maximum lengths, in
+	// characters, of a tag's key and value.
+	maxTagKeyLen   = 128
+	maxTagValueLen = 256
+)
+
+func invalidTag(format string, args ...interface{}) error {
+	return awserr.New("InvalidTag", fmt.Sprintf(format, args...), nil)
+}
+
+// checkTags returns InvalidTag if tags violates S3's limits on object tags.
+func checkTags(tags map[string]string) error {
+	if len(tags) > maxTags {
+		return invalidTag("object tags cannot be greater than %d", maxTags)
+	}
+	for k, v := range tags {
+		if n := len([]rune(k)); n == 0 || n > maxTagKeyLen {
+			return invalidTag("the tag key %q must be between 1 and %d characters", k, maxTagKeyLen)
+		}
+		if len([]rune(v)) > maxTagValueLen {
+			return invalidTag("the tag value of %q exceeds %d characters", k, maxTagValueLen)
+		}
+	}
+	return nil
+}
+
+// parseTagging parses the URL-encoded tag set sent in the x-amz-tagging
+// header of PutObject, CreateMultipartUpload and CopyObject requests.
+func parseTagging(tagging *string) (map[string]string, error) {
+	if tagging == nil || *tagging == "" {
+		return nil, nil
+	}
+	values, err := url.ParseQuery(*tagging)
+	if err != nil {
+		return nil, invalidTag("malformed tagging %q: %v", *tagging, err)
+	}
+	tags := make(map[string]string, len(values))
+	for k, v := range values {
+		if len(v) != 1 {
+			return nil, invalidTag("cannot provide multiple tags with the same key %q", k)
+		}
+		tags[k] = v[0]
+	}
+	return tags, checkTags(tags)
+}
+
+// tagSet converts tags into the form returned by GetObjectTagging, sorted
+// by key.
+func tagSet(tags map[string]string) []*s3.Tag {
+	set := make([]*s3.Tag, 0, len(tags))
+	for k, v := range tags {
+		set = append(set, &s3.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	sort.Slice(set, func(i, j int) bool { return *set[i].Key < *set[j].Key })
+	return set
+}
+
+// stringOrNil returns nil for empty strings, so that unset system metadata
+// is omitted from responses.
+func stringOrNil(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+// updateTags replaces the tags of the object stored under key.
+func (c *Client) updateTags(api string, key string, tags map[string]string) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	f, ok := c.content[key]
+	if !ok {
+		return awserr.New("NoSuchKey", fmt.Sprintf("%s: key %s not found", api, key), nil)
+	}
+	f.Tags = tags
+	c.putLocked(key, f)
+	return nil
+}
+
+// GetObjectTagging returns the tag set of an object.
+func (c *Client) GetObjectTagging(input *s3.GetObjectTaggingInput) (output *s3.GetObjectTaggingOutput, err error) {
+	rec := c.record("GetObjectTagging", input)
+	defer rec.done(&output, &err)
+	return c.getObjectTagging(input)
+}
+
+// getObjectTagging implements GetObjectTagging and GetObjectTaggingRequest.
+func (c *Client) getObjectTagging(input *s3.GetObjectTaggingInput) (output *s3.GetObjectTaggingOutput, err error) {
+	if err := c.startRequest("GetObjectTagging", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("GetObjectTagging", input.Bucket); err != nil {
+		return nil, err
+	}
+	key := aws.StringValue(input.Key)
+	f, ok := c.readFile(key)
+	if !ok {
+		return nil, awserr.New("NoSuchKey", fmt.Sprintf("key %s not found", key), nil)
+	}
+	return &s3.GetObjectTaggingOutput{TagSet: tagSet(f.Tags)}, nil
+}
+
+// GetObjectTaggingRequest implements the request variant of GetObjectTagging.
+func (c *Client) GetObjectTaggingRequest(input *s3.GetObjectTaggingInput) (req *request.Request, output *s3.GetObjectTaggingOutput) {
+	req, output = c.svc.GetObjectTaggingRequest(input)
+	rec := c.record("GetObjectTagging", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("GetObjectTaggingRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.getObjectTagging(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// GetObjectTaggingWithContext implements the corresponding s3iface.API method.
+func (c *Client) GetObjectTaggingWithContext(ctx aws.Context, input *s3.GetObjectTaggingInput, opts ...request.Option) (*s3.GetObjectTaggingOutput, error) {
+	req, out := c.GetObjectTaggingRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
+
+// PutObjectTagging replaces the tag set of an object.
+func (c *Client) PutObjectTagging(input *s3.PutObjectTaggingInput) (output *s3.PutObjectTaggingOutput, err error) {
+	rec := c.record("PutObjectTagging", input)
+	defer rec.done(&output, &err)
+	return c.putObjectTagging(input)
+}
+
+// putObjectTagging implements PutObjectTagging and PutObjectTaggingRequest.
+func (c *Client) putObjectTagging(input *s3.PutObjectTaggingInput) (output *s3.PutObjectTaggingOutput, err error) {
+	if err := c.startRequest("PutObjectTagging", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("PutObjectTagging", input.Bucket); err != nil {
+		return nil, err
+	}
+	if input.Tagging == nil {
+		return nil, awserr.New("MalformedXML", "PutObjectTagging: missing Tagging", nil)
+	}
+	tags := make(map[string]string, len(input.Tagging.TagSet))
+	for _, tag := range input.Tagging.TagSet {
+		k := aws.StringValue(tag.Key)
+		if _, ok := tags[k]; ok {
+			return nil, invalidTag("cannot provide multiple tags with the same key %q", k)
+		}
+		tags[k] = aws.StringValue(tag.Value)
+	}
+	if err := checkTags(tags); err != nil {
+		return nil, err
+	}
+	if err := c.updateTags("PutObjectTagging", aws.StringValue(input.Key), tags); err != nil {
+		return nil, err
+	}
+	return &s3.PutObjectTaggingOutput{}, nil
+}
+
+// PutObjectTaggingRequest implements the request variant of PutObjectTagging.
+func (c *Client) PutObjectTaggingRequest(input *s3.PutObjectTaggingInput) (req *request.Request, output *s3.PutObjectTaggingOutput) {
+	req, output = c.svc.PutObjectTaggingRequest(input)
+	rec := c.record("PutObjectTagging", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("PutObjectTaggingRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.putObjectTagging(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// PutObjectTaggingWithContext implements the corresponding s3iface.API method.
+func (c *Client) PutObjectTaggingWithContext(ctx aws.Context, input *s3.PutObjectTaggingInput, opts ...request.Option) (*s3.PutObjectTaggingOutput, error) {
+	req, out := c.PutObjectTaggingRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
+
+// DeleteObjectTagging removes all tags from an object.
+func (c *Client) DeleteObjectTagging(input *s3.DeleteObjectTaggingInput) (output *s3.DeleteObjectTaggingOutput, err error) {
+	rec := c.record("DeleteObjectTagging", input)
+	defer rec.done(&output, &err)
+	return c.deleteObjectTagging(input)
+}
+
+// deleteObjectTagging implements DeleteObjectTagging and DeleteObjectTaggingRequest.
+func (c *Client) deleteObjectTagging(input *s3.DeleteObjectTaggingInput) (output *s3.DeleteObjectTaggingOutput, err error) {
+	if err := c.startRequest("DeleteObjectTagging", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("DeleteObjectTagging", input.Bucket); err != nil {
+		return nil, err
+	}
+	if err := c.updateTags("DeleteObjectTagging", aws.StringValue(input.Key), nil); err != nil {
+		return nil, err
+	}
+	return &s3.DeleteObjectTaggingOutput{}, nil
+}
+
+// DeleteObjectTaggingRequest implements the request variant of
+// DeleteObjectTagging.
+func (c *Client) DeleteObjectTaggingRequest(input *s3.DeleteObjectTaggingInput) (req *request.Request, output *s3.DeleteObjectTaggingOutput) {
+	req, output = c.svc.DeleteObjectTaggingRequest(input)
+	rec := c.record("DeleteObjectTagging", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("DeleteObjectTaggingRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.deleteObjectTagging(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// DeleteObjectTaggingWithContext implements the corresponding s3iface.API
+// method.
+func (c *Client) DeleteObjectTaggingWithContext(ctx aws.Context, input *s3.DeleteObjectTaggingInput, opts ...request.Option) (*s3.DeleteObjectTaggingOutput, error) {
+	req, out := c.DeleteObjectTaggingRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
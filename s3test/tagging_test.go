@@ -0,0 +1,184 @@
+package s3test_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil/expect"
+	"github.com/grailbio/testutil/s3test"
+)
+
+func tags(t *testing.T, client *s3test.Client, key string) map[string]string {
+	out, err := client.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := map[string]string{}
+	for _, tag := range out.TagSet {
+		m[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return m
+}
+
+func TestSystemMetadata(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	if _, err := client.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String(testBucket),
+		Key:                  aws.String("a"),
+		Body:                 bytes.NewReader([]byte("contents")),
+		ContentType:          aws.String("text/plain"),
+		ContentEncoding:      aws.String("gzip"),
+		CacheControl:         aws.String("no-cache"),
+		StorageClass:         aws.String(s3.StorageClassStandardIa),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAes256),
+		Tagging:              aws.String("project=x&owner=me"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	head, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(testBucket), Key: aws.String("a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect.EQ(t, aws.StringValue(head.ContentType), "text/plain")
+	expect.EQ(t, aws.StringValue(head.ContentEncoding), "gzip")
+	expect.EQ(t, aws.StringValue(head.CacheControl), "no-cache")
+	expect.EQ(t, aws.StringValue(head.StorageClass), s3.StorageClassStandardIa)
+	expect.EQ(t, aws.StringValue(head.ServerSideEncryption), s3.ServerSideEncryptionAes256)
+	get, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: aws.String(testBucket), Key: aws.String("a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect.EQ(t, aws.StringValue(get.ContentType), "text/plain")
+	expect.EQ(t, aws.Int64Value(get.TagCount), int64(2))
+	expect.EQ(t, tags(t, client, "a"), map[string]string{"project": "x", "owner": "me"})
+
+	client.MinPartSize = 1
+	out, err := client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(testBucket),
+		Key:         aws.String("mp"),
+		ContentType: aws.String("application/json"),
+		Tagging:     aws.String("k=v"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p1 := uploadPart(t, client, "mp", *out.UploadId, 1, []byte("{}"))
+	if _, err := completeUpload(client, "mp", *out.UploadId, p1); err != nil {
+		t.Fatal(err)
+	}
+	expect.EQ(t, client.MustGetFile("mp").ContentType, "application/json")
+	expect.EQ(t, tags(t, client, "mp"), map[string]string{"k": "v"})
+
+	_, err = client.PutObject(&s3.PutObjectInput{
+		Bucket:  aws.String(testBucket),
+		Key:     aws.String("b"),
+		Body:    bytes.NewReader(nil),
+		Tagging: aws.String("a=1&a=2"),
+	})
+	expect.EQ(t, awsErrCode(err), "InvalidTag")
+}
+
+func TestObjectTagging(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	client.SetFile("a", []byte("a"), "")
+	expect.EQ(t, tags(t, client, "a"), map[string]string{})
+
+	if _, err := client.PutObjectTaggingWithContext(ctx, &s3.PutObjectTaggingInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("a"),
+		Tagging: &s3.Tagging{TagSet: []*s3.Tag{
+			{Key: aws.String("b"), Value: aws.String("2")},
+			{Key: aws.String("a"), Value: aws.String("1")},
+		}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := client.GetObjectTagging(&s3.GetObjectTaggingInput{Bucket: aws.String(testBucket), Key: aws.String("a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect.EQ(t, aws.StringValue(out.TagSet[0].Key), "a")
+	expect.EQ(t, aws.StringValue(out.TagSet[1].Key), "b")
+
+	if _, err := client.DeleteObjectTaggingWithContext(ctx, &s3.DeleteObjectTaggingInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("a"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expect.EQ(t, tags(t, client, "a"), map[string]string{})
+
+	var many []*s3.Tag
+	for _, k := range "abcdefghijk" {
+		many = append(many, &s3.Tag{Key: aws.String(string(k)), Value: aws.String("")})
+	}
+	_, err = client.PutObjectTagging(&s3.PutObjectTaggingInput{
+		Bucket:  aws.String(testBucket),
+		Key:     aws.String("a"),
+		Tagging: &s3.Tagging{TagSet: many},
+	})
+	expect.EQ(t, awsErrCode(err), "InvalidTag")
+	_, err = client.GetObjectTagging(&s3.GetObjectTaggingInput{Bucket: aws.String(testBucket), Key: aws.String("missing")})
+	expect.True(t, isNoSuchKey(err))
+}
+
+func TestCopyDirectives(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	if _, err := client.PutObject(&s3.PutObjectInput{
+		Bucket:       aws.String(testBucket),
+		Key:          aws.String("src"),
+		Body:         bytes.NewReader([]byte("contents")),
+		Metadata:     map[string]*string{"Owner": aws.String("me")},
+		ContentType:  aws.String("text/plain"),
+		StorageClass: aws.String(s3.StorageClassOnezoneIa),
+		Tagging:      aws.String("k=v"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	copyObject := func(input *s3.CopyObjectInput) s3test.FileContent {
+		input.Bucket = aws.String(testBucket)
+		input.Key = aws.String("dst")
+		input.CopySource = aws.String(testBucket + "/src")
+		if _, err := client.CopyObject(input); err != nil {
+			t.Fatal(err)
+		}
+		return client.MustGetFile("dst")
+	}
+
+	dst := copyObject(&s3.CopyObjectInput{
+		MetadataDirective: aws.String(s3.MetadataDirectiveCopy),
+		Metadata:          map[string]*string{"Ignored": aws.String("x")},
+		ContentType:       aws.String("ignored"),
+	})
+	expect.EQ(t, aws.StringValue(dst.Metadata["Owner"]), "me")
+	expect.EQ(t, len(dst.Metadata), 1)
+	expect.EQ(t, dst.ContentType, "text/plain")
+	expect.EQ(t, dst.StorageClass, "")
+	expect.EQ(t, dst.Tags, map[string]string{"k": "v"})
+
+	dst = copyObject(&s3.CopyObjectInput{
+		MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+		Metadata:          map[string]*string{"Other": aws.String("x")},
+		ContentType:       aws.String("application/octet-stream"),
+		StorageClass:      aws.String(s3.StorageClassStandardIa),
+		TaggingDirective:  aws.String(s3.TaggingDirectiveReplace),
+		Tagging:           aws.String("n=1"),
+	})
+	expect.EQ(t, dst.Metadata, map[string]*string{"Other": aws.String("x")})
+	expect.EQ(t, dst.ContentType, "application/octet-stream")
+	expect.EQ(t, dst.StorageClass, s3.StorageClassStandardIa)
+	expect.EQ(t, dst.Tags, map[string]string{"n": "1"})
+
+	_, err := client.CopyObject(&s3.CopyObjectInput{
+		Bucket:            aws.String(testBucket),
+		Key:               aws.String("dst"),
+		CopySource:        aws.String(testBucket + "/src"),
+		MetadataDirective: aws.String("MERGE"),
+	})
+	expect.EQ(t, awsErrCode(err), "InvalidArgument")
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"strings"
 	"sync"
@@ -55,19 +56,29 @@ const (
 )
 
 type multipartUpload struct {
-	status  multipartUploadStatus
-	id      string             // uploadID
-	key     string             // s3 path
-	meta    map[string]*string // metadata sent in CreateMultiPartUpload request
-	partial map[int64][]byte
+	status    multipartUploadStatus
+	id        string             // uploadID
+	seq       int                // creation order, used for listing
+	key       string             // s3 path
+	meta      map[string]*string // metadata sent in CreateMultiPartUpload request
+	object    FileContent        // system metadata and tags of the completed object
+	initiated time.Time
+	partial   map[int64]*uploadedPart
 }
 
 // Client implements s3iface.S3API by using an AWS SDK client and
-// overriding methods under test: HeadObject, ListObjectsV2,
-// PutObjectRequest, CreateMultipartUploadRequest, UploadPartRequest,
-// AbortMultipartUploadRequest, CompleteMultipartUploadRequest,
-// GetObjectRequest, CopyObject, and DeleteObject. (These methods are
-// sufficient to use with the S3 upload and download managers.)
+// overriding methods under test: object reads, writes, copies and deletes,
+// multipart uploads, listings, tagging, ACLs, bucket policies, lifecycle
+// configuration, versioning, RestoreObject and SelectObjectContent. (These
+// methods are sufficient to use with the S3 upload and download managers, as
+// checked by RunManagerConformance.) Other APIs fail with a NotImplemented
+// error. Each method documents how it models S3.
+//
+// Requests that real S3 would reject fail with the error S3 would return
+// (see Strict). Requests may be subject to access control (Principal), a
+// simulated network (Network), eventual consistency (Consistency) and
+// injected errors (Err). They are recorded (Records), and writes emit
+// event notifications (Subscribe).
 //
 // File contents (and their checksums) are provided by the user.
 type Client struct {
@@ -85,15 +96,62 @@ type Client struct {
 	// handler will return that error.
 	Err func(api string, input interface{}) error
 
+	// Clock, if non-nil, is the source of time for LastModified timestamps
+	// and write visibility. It defaults to the wall clock.
+	Clock Clock
+
+	// Consistency, if non-nil, delays the visibility of writes to read
+	// requests. See Consistency for details.
+	Consistency *Consistency
+
+	// MinPartSize is the minimum size of every part but the last of a
+	// multipart upload. If zero, DefaultMinPartSize is used.
+	MinPartSize int64
+
+	// Network, if non-nil, models the latency, bandwidth and request rate
+	// limits of the network. See Network for details.
+	Network *Network
+
+	// Strict, if set, fails the test (in addition to returning an S3 error)
+	// when the client is misused in a way that real S3 would reject. Such
+	// requests, e.g., naming the wrong bucket or an unknown upload ID, or
+	// sending a malformed Range or a body that does not match its checksum,
+	// fail with the error S3 would return (NoSuchBucket, NoSuchUpload,
+	// InvalidRange, BadDigest, etc.) regardless, so that tests can exercise
+	// error handling.
+	Strict bool
+
+	// Principal is the identity of the principal that makes the client's
+	// requests. Requests by principals other than BucketOwner (the default)
+	// must be allowed by the bucket policy or, for reads, the object's ACL;
+	// others fail with AccessDenied. See PutBucketPolicy and PutObjectAcl.
+	Principal string
+
 	s3iface.S3API
 	svc      s3iface.S3API
 	bucket   string
 	m        sync.Mutex
 	content  map[string]FileContent      // maps s3 key
+	pending  map[string]*pendingWrite    // writes not yet visible to readers
 	uploads  map[string]*multipartUpload // active multipart upload requests
 	apiCount map[string]int              // maps the s3 api methods to occurrence counts
+	records  []Record                    // requests handled so far
 	t        *testing.T
 
+	lifecycle     []*s3.LifecycleRule // see ApplyLifecycle
+	subscriptions []*subscription     // see Subscribe
+	eventSeq      int64               // sequencer of the last event
+
+	versioning string                     // see PutBucketVersioning
+	versions   map[string][]objectVersion // noncurrent versions and delete markers, oldest first
+	versionSeq int                        // sequence number of the last version ID
+
+	serverOnce sync.Once
+	server     *httptest.Server // see Server
+
+	policy     []policyStatement // see PutBucketPolicy
+	policyText string
+
 	seqMu sync.Mutex // For generating unique IDs.
 	seq   int
 }
@@ -120,6 +178,9 @@ func parseByteRange(s string, contentLen int64) (int64, int64, error) {
 		return contentLen - len, contentLen - 1, nil
 	}
 	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return 0, contentLen - 1, fmt.Errorf("parseByteRange %v: expected a single range", s)
+	}
 	start, err := strconv.ParseInt(parts[0], 10, 64)
 	if err != nil {
 		return 0, contentLen - 1, fmt.Errorf("parseByteRange %v: could not parse start", s)
@@ -137,6 +198,82 @@ type FileContent struct {
 	Metadata     map[string]*string
 	LastModified time.Time
 	ETag         string
+	// checksum computes the ETag, if it is empty, the first time it is
+	// needed (see SetFileContentAt).
+	checksum *lazyChecksum
+
+	// System metadata sent with PutObject, CreateMultipartUpload or
+	// CopyObject, and returned by HeadObject and GetObject. Empty values are
+	// omitted from responses.
+	ContentType          string
+	ContentEncoding      string
+	CacheControl         string
+	StorageClass         string
+	ServerSideEncryption string
+
+	// Tags is the object's tag set, see GetObjectTagging.
+	Tags map[string]string
+
+	// ChecksumAlgorithm and Checksum are the algorithm and base64-encoded
+	// value of the object's x-amz-checksum, if any. The checksum of an
+	// object created by a multipart upload is S3's composite checksum,
+	// suffixed by "-<number of parts>".
+	ChecksumAlgorithm string
+	Checksum          string
+
+	// SSECustomerKeyMD5 is the MD5 of the customer-provided key the object
+	// was encrypted with (SSE-C), if any; see SSECustomerKeyMD5.
+	SSECustomerKeyMD5 string
+
+	// Grants is the object's ACL, besides the bucket owner's full control;
+	// see PutObjectAcl.
+	Grants []*s3.Grant
+
+	// RestoreReady and RestoreExpiry are the times at which the restored
+	// copy of an archived object becomes available and expires; see
+	// RestoreObject. They are zero if the object has not been restored.
+	RestoreReady, RestoreExpiry time.Time
+
+	// VersionID is the ID of the object's version if it was written while
+	// the bucket's versioning was enabled, and empty for the null version;
+	// see PutBucketVersioning.
+	VersionID string
+}
+
+// lazyChecksum computes the checksum of a ContentAt once, on first use.
+type lazyChecksum struct {
+	once    sync.Once
+	content testutil.ContentAt
+	sum     string
+}
+
+func (l *lazyChecksum) get() string {
+	l.once.Do(func() { l.sum = l.content.Checksum() })
+	return l.sum
+}
+
+// etag returns the object's ETag.
+func (f FileContent) etag() string {
+	if f.ETag == "" && f.checksum != nil {
+		return f.checksum.get()
+	}
+	return f.ETag
+}
+
+// snapshot returns the object's content and ETag as of now. The bytes of a
+// *testutil.ByteContent, which a test may write while the object is read,
+// e.g., after storing it with SetFileContentAt, are snapshotted, so that a
+// response is not torn by concurrent writes and its ETag matches its body.
+func (f FileContent) snapshot() (testutil.ContentAt, string) {
+	bc, ok := f.Content.(*testutil.ByteContent)
+	if !ok {
+		return f.Content, f.etag()
+	}
+	snap := &testutil.ByteContent{Data: bc.Bytes()}
+	if f.ETag != "" {
+		return snap, f.ETag
+	}
+	return snap, snap.Checksum()
 }
 
 func (f FileContent) SHA256() string {
@@ -146,12 +283,12 @@ func (f FileContent) SHA256() string {
 	return ""
 }
 
-func (c *Client) newUploadID() string {
+func (c *Client) newUploadID() (string, int) {
 	c.seqMu.Lock()
-	s := fmt.Sprintf("testuploadid%d", c.seq)
+	seq := c.seq
 	c.seq++
 	c.seqMu.Unlock()
-	return s
+	return fmt.Sprintf("testuploadid%d", seq), seq
 }
 
 // NewClient constructs a new S3 client under test. The client
@@ -173,14 +310,38 @@ func NewClient(t *testing.T, bucket string) *Client {
 	}
 	svc := s3.New(sess, nil)
 	svc.Handlers.Clear()
-	return &Client{
+	c := &Client{
 		svc:      svc,
 		bucket:   bucket,
 		content:  make(map[string]FileContent),
+		pending:  make(map[string]*pendingWrite),
 		uploads:  make(map[string]*multipartUpload),
+		versions: make(map[string][]objectVersion),
 		apiCount: make(map[string]int),
 		t:        t,
 	}
+	// The Send handler models the network (see Network); it is a no-op
+	// unless c.Network is set. Send handlers added by request methods, e.g.,
+	// to store objects, are skipped once a request fails.
+	svc.Handlers.Send.AfterEachFn = request.HandlerListStopOnError
+	svc.Handlers.Send.PushBackNamed(request.NamedHandler{Name: "s3test.Network", Fn: c.sendNetwork})
+	// The Sign handler, which only runs for real when a request is
+	// presigned, points the request at c.Server.
+	svc.Handlers.Sign.PushBackNamed(request.NamedHandler{Name: "s3test.Presign", Fn: c.signPresigned})
+	// APIs that the client does not implement are served by a client whose
+	// requests always fail with NotImplemented, rather than by a nil
+	// S3API.
+	unimplemented := s3.New(sess, nil)
+	unimplemented.Handlers.Clear()
+	unimplemented.Handlers.Validate.PushBackNamed(request.NamedHandler{
+		Name: "s3test.NotImplemented",
+		Fn: func(r *request.Request) {
+			r.Error = awserr.NewRequestFailure(awserr.New("NotImplemented",
+				"not implemented by s3test: "+r.Operation.Name, nil), http.StatusNotImplemented, "")
+		},
+	})
+	c.S3API = unimplemented
+	return c
 }
 
 // MaxRetries returns the maximum number of retries permitted for operations
@@ -189,12 +350,16 @@ func (c *Client) MaxRetries() int {
 	return c.NumMaxRetries
 }
 
-// GetFile returns the file contents and its metadata. Returns false if the file
+// GetFile returns the file contents and its metadata, computing its ETag if it
+// has not been computed yet (see SetFileContentAt). Returns false if the file
 // is not found.
 func (c *Client) GetFile(key string) (FileContent, bool) {
 	c.m.Lock()
-	defer c.m.Unlock()
 	f, ok := c.content[key]
+	c.m.Unlock()
+	if ok {
+		f.ETag = f.etag()
+	}
 	return f, ok
 }
 
@@ -215,6 +380,8 @@ func (c *Client) SetFile(key string, content []byte, sha256 string) {
 }
 
 // SetFileContentAt sets the file with the given content and adds sha256 to its metadata if non-empty.
+// The object's ETag, the content's checksum, is computed the first time a
+// response includes it, as that may require reading all the content.
 // TODO(swami): Replace with setFileContentAt and change all callers.
 func (c *Client) SetFileContentAt(key string, content testutil.ContentAt, SHA256 string) {
 	meta := make(map[string]*string)
@@ -224,19 +391,16 @@ func (c *Client) SetFileContentAt(key string, content testutil.ContentAt, SHA256
 	c.setFileContentAt(key, content, meta)
 }
 
-func (c *Client) setFile(key string, content []byte, metadata map[string]*string) {
-	c.setFileContentAt(key, &testutil.ByteContent{Data: content}, metadata)
-}
-
 func (c *Client) setFileContentAt(key string, content testutil.ContentAt, metadata map[string]*string) {
 	c.m.Lock()
 	defer c.m.Unlock()
-	c.content[key] = FileContent{
+	c.putLocked(key, FileContent{
 		Content:      content,
 		Metadata:     metadata,
-		LastModified: time.Now(),
-		ETag:         content.Checksum(),
-	}
+		LastModified: c.now(),
+		checksum:     &lazyChecksum{content: content},
+		VersionID:    c.newVersionLocked(key),
+	})
 }
 
 // GetFileContentBytes returns the byte slice representation of the contents for key.
@@ -251,94 +415,199 @@ func (c *Client) GetFileContentBytes(key string) []byte {
 }
 
 // setFileFromPartialContent collects the content from partial and sets key in content with the result.
-func (c *Client) setFileFromPartialContent(key string, uploadID string, parts []*s3.CompletedPart) {
+func (c *Client) setFileFromPartialContent(key string, uploadID string, parts []*s3.CompletedPart) (etag string, err error) {
 	c.m.Lock()
 	defer c.m.Unlock()
 
 	r := c.uploads[uploadID]
-	if r == nil {
-		c.t.Errorf("setFileFromPartialContent: unknown upload ID %s", uploadID)
-		return
+	if r == nil || r.status == multipartUploadAborted {
+		return "", c.violation(noSuchUpload(uploadID))
 	}
 	if r.key != key {
-		c.t.Errorf("Key mismatch: %v %v", r.key, key)
-		return
+		return "", c.violation(awserr.New("NoSuchUpload",
+			fmt.Sprintf("upload %s is for key %s, not %s", uploadID, r.key, key), nil))
 	}
 	if r.status == multipartUploadCompleted {
-		return
-	}
-	if r.status == multipartUploadAborted {
-		c.t.Errorf("CompleteMultiPartUpload: upload %s aborted", uploadID)
-		return
-	}
-	if len(parts) != len(r.partial) {
-		c.t.Errorf("Parts mismatch: %v %v", parts, r.partial)
-		return
-	}
-	size := 0
-	for _, b := range r.partial {
-		size += len(b)
-	}
-	buf := make([]byte, size)
-	pos := 0
-	lastPartNum := int64(-1)
-	for _, part := range parts {
-		if *part.PartNumber <= lastPartNum {
-			c.t.Errorf("Unsorted part number %d %d", *part.PartNumber, lastPartNum)
-			return
+		return c.content[key].etag(), nil
+	}
+	if len(parts) == 0 {
+		return "", c.violation(awserr.New("MalformedXML", "You must specify at least one part", nil))
+	}
+	var (
+		buf          []byte
+		lastPartNum  = int64(-1)
+		minPartSize  = c.minPartSize()
+		partsToWrite = make([]*uploadedPart, len(parts))
+	)
+	for i, part := range parts {
+		num := aws.Int64Value(part.PartNumber)
+		if num <= lastPartNum {
+			return "", c.violation(awserr.New("InvalidPartOrder",
+				fmt.Sprintf("part number %d follows part number %d", num, lastPartNum), nil))
+		}
+		lastPartNum = num
+		p, ok := r.partial[num]
+		if !ok || p.etag != trimETag(aws.StringValue(part.ETag)) {
+			return "", c.violation(awserr.New("InvalidPart",
+				fmt.Sprintf("part %d with ETag %s not found", num, aws.StringValue(part.ETag)), nil))
 		}
-		lastPartNum = *part.PartNumber
-		bb, ok := r.partial[*part.PartNumber]
-		if !ok {
-			c.t.Errorf("Missing part %d", *part.PartNumber)
-		} else {
-			copy(buf[pos:], bb)
-			pos += len(bb)
-			delete(r.partial, *part.PartNumber)
+		partsToWrite[i] = p
+	}
+	for i, p := range partsToWrite {
+		if i < len(parts)-1 && int64(len(p.data)) < minPartSize {
+			return "", c.violation(awserr.New("EntityTooSmall",
+				fmt.Sprintf("part %d is %d bytes, smaller than the minimum allowed size %d",
+					aws.Int64Value(parts[i].PartNumber), len(p.data), minPartSize), nil))
 		}
+		buf = append(buf, p.data...)
 	}
 
 	if err := checkBodySHA256(buf, r.meta); err != nil {
-		panic(err)
+		return "", c.badDigest("CompleteMultipartUpload", err)
 	}
 	content := &testutil.ByteContent{Data: buf}
-	c.content[key] = FileContent{
-		Content:      content,
-		Metadata:     r.meta,
-		LastModified: time.Now(),
-		ETag:         content.Checksum(),
+	etag = multipartETag(partsToWrite)
+	fc := r.object
+	if fc.ChecksumAlgorithm != "" {
+		if fc.Checksum, err = compositeChecksum(fc.ChecksumAlgorithm, partsToWrite); err != nil {
+			return "", err
+		}
 	}
+	fc.Content = content
+	fc.Metadata = r.meta
+	fc.LastModified = c.now()
+	fc.ETag = etag
+	fc.VersionID = c.newVersionLocked(key)
+	c.putLocked(key, fc)
+	c.notifyLocked(EventObjectCreatedCompleteMultipartUpload, key, &fc)
 	r.status = multipartUploadCompleted
+	r.partial = nil
+	return etag, nil
 }
 
 // copyFile exhibits the same behavior as we expect from S3.
-// That is, by default all metadata is copied from src to dst unless
-// metadata is specified in the request in which case dst will only
-// reflect the one from the request.
+// That is, by default all metadata is copied from src to dst. With
+// MetadataDirective REPLACE, the user metadata, content type, encoding and
+// cache control of dst are taken from the request instead; with
+// TaggingDirective REPLACE, so are its tags. The storage class and
+// server-side encryption of dst are always taken from the request.
+// For compatibility, user metadata specified without a MetadataDirective
+// also replaces the metadata of src.
 // See: https://docs.aws.amazon.com/AmazonS3/latest/dev/CopyingObjectsExamples.html
-func (c *Client) copyFile(src, dst string, meta map[string]*string) error {
+func (c *Client) copyFile(src, dst string, input *s3.CopyObjectInput) error {
+	directive := aws.StringValue(input.MetadataDirective)
+	switch directive {
+	case "", s3.MetadataDirectiveCopy, s3.MetadataDirectiveReplace:
+	default:
+		return awserr.New("InvalidArgument", fmt.Sprintf("unknown metadata directive %s", directive), nil)
+	}
+	var (
+		tags       map[string]string
+		replaceTag bool
+	)
+	switch tagDirective := aws.StringValue(input.TaggingDirective); tagDirective {
+	case "", s3.TaggingDirectiveCopy:
+	case s3.TaggingDirectiveReplace:
+		var err error
+		if tags, err = parseTagging(input.Tagging); err != nil {
+			return err
+		}
+		replaceTag = true
+	default:
+		return awserr.New("InvalidArgument", fmt.Sprintf("unknown tagging directive %s", tagDirective), nil)
+	}
+
+	keyMD5, err := parseSSECustomer("CopyObject",
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5)
+	if err != nil {
+		return err
+	}
+	// As with S3, the ACL of the source is not copied.
+	grants, err := aclHeaders{input.ACL, input.GrantFullControl, input.GrantRead,
+		input.GrantReadACP, nil, input.GrantWriteACP}.grants()
+	if err != nil {
+		return err
+	}
+
 	c.m.Lock()
 	defer c.m.Unlock()
-	c.content[dst] = c.content[src]
-	if meta != nil {
-		fc := c.content[dst]
-		buf := make([]byte, fc.Content.Size())
-		if n, err := fc.Content.ReadAt(buf, 0); err != nil || int64(n) != fc.Content.Size() {
-			c.t.Fatalf("testclient.copyFile: contents of size %d read error: %d %v", fc.Content.Size(), n, err)
-		}
-		if err := checkBodySHA256(buf, meta); err != nil {
-			return err
+	fc, ok := c.content[src]
+	if !ok {
+		return c.violation(awserr.New("NoSuchKey", fmt.Sprintf("copy source %s not found", src), nil))
+	}
+	if err := readSSECustomer("CopyObject", fc, input.CopySourceSSECustomerAlgorithm,
+		input.CopySourceSSECustomerKey, input.CopySourceSSECustomerKeyMD5); err != nil {
+		return err
+	}
+	if err := c.checkReadable("CopyObject", fc); err != nil {
+		return err
+	}
+	meta := input.Metadata
+	if directive == s3.MetadataDirectiveReplace || (directive == "" && meta != nil) {
+		if meta != nil {
+			buf := make([]byte, fc.Content.Size())
+			if n, err := fc.Content.ReadAt(buf, 0); err != nil || int64(n) != fc.Content.Size() {
+				c.t.Fatalf("testclient.copyFile: contents of size %d read error: %d %v", fc.Content.Size(), n, err)
+			}
+			if err := checkBodySHA256(buf, meta); err != nil {
+				return c.badDigest("CopyObject", err)
+			}
 		}
 		fc.Metadata = meta
-		c.content[dst] = fc
 	}
+	if directive == s3.MetadataDirectiveReplace {
+		fc.ContentType = aws.StringValue(input.ContentType)
+		fc.ContentEncoding = aws.StringValue(input.ContentEncoding)
+		fc.CacheControl = aws.StringValue(input.CacheControl)
+	}
+	fc.StorageClass = aws.StringValue(input.StorageClass)
+	fc.ServerSideEncryption = aws.StringValue(input.ServerSideEncryption)
+	if replaceTag {
+		fc.Tags = tags
+	}
+	fc.SSECustomerKeyMD5 = keyMD5
+	fc.Grants = grants
+	fc.RestoreReady, fc.RestoreExpiry = time.Time{}, time.Time{}
+	fc.VersionID = c.newVersionLocked(dst)
+	c.putLocked(dst, fc)
+	c.notifyLocked(EventObjectCreatedCopy, dst, &fc)
 	return nil
 }
 
-func (c *Client) deleteFile(key string) {
+// checkCopySource evaluates the copy source preconditions of a CopyObject
+// request against src.
+func (c *Client) checkCopySource(src string, input *s3.CopyObjectInput) error {
+	f, ok := c.GetFile(src)
+	if !ok {
+		return nil
+	}
+	cond := conditions{input.CopySourceIfMatch, input.CopySourceIfNoneMatch,
+		input.CopySourceIfModifiedSince, input.CopySourceIfUnmodifiedSince}
+	return cond.checkCopySource(f)
+}
+
+// deleteFile deletes the current version of key or, if id is non-empty,
+// the version with that ID; see PutBucketVersioning.
+func (c *Client) deleteFile(key, id string) *s3.DeleteObjectOutput {
 	c.m.Lock()
 	defer c.m.Unlock()
-	delete(c.content, key)
+	var output s3.DeleteObjectOutput
+	if id != "" {
+		if c.deleteVersionLocked(key, id) {
+			output.DeleteMarker = aws.Bool(true)
+		}
+		output.VersionId = aws.String(id)
+		c.notifyLocked(EventObjectRemovedDelete, key, nil)
+		return &output
+	}
+	if markerID, marker := c.deleteCurrentLocked(key); marker {
+		output.DeleteMarker = aws.Bool(true)
+		output.VersionId = aws.String(versionID(markerID))
+		c.notifyLocked(EventObjectRemovedDeleteMarkerCreated, key, nil)
+		return &output
+	}
+	c.notifyLocked(EventObjectRemovedDelete, key, nil)
+	return &output
 }
 
 // GetApiCount returns the number of invocations for the given API
@@ -355,32 +624,60 @@ func (c *Client) startRequest(api string, input interface{}) error {
 	c.apiCount[api]++
 	c.m.Unlock()
 	if c.Err != nil {
-		return c.Err(api, input)
+		if err := c.Err(api, input); err != nil {
+			return err
+		}
 	}
-	return nil
+	return c.authorize(api, input)
 }
 
 // HeadObject is used in s3-loader to determine if an object in S3 and
 // the local matching object are identical.
 func (c *Client) HeadObject(
 	input *s3.HeadObjectInput) (output *s3.HeadObjectOutput, err error) {
+	rec := c.record("HeadObject", input)
+	defer rec.done(&output, &err)
 	if err := c.startRequest("HeadObject", input); err != nil {
 		return nil, err
 	}
-	if got, want := aws.StringValue(input.Bucket), c.bucket; got != want {
-		c.t.Errorf("HeadObject received unexpected bucket got: %s want %s", got, want)
+	return c.headObject(input)
+}
+
+// headObject implements HeadObject and HeadObjectRequest.
+func (c *Client) headObject(
+	input *s3.HeadObjectInput) (output *s3.HeadObjectOutput, err error) {
+	if err := c.checkBucket("HeadObject", input.Bucket); err != nil {
+		return nil, err
 	}
 
 	key := aws.StringValue(input.Key)
-	f, ok := c.GetFile(key)
+	f, ok := c.readFile(key)
 	if !ok {
 		return nil, awserr.New("NoSuchKey", "Object not found", nil)
 	}
+	f.Content, f.ETag = f.snapshot()
+	if err := readSSECustomer("HeadObject", f,
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5); err != nil {
+		return nil, err
+	}
+	cond := conditions{input.IfMatch, input.IfNoneMatch, input.IfModifiedSince, input.IfUnmodifiedSince}
+	if err := cond.check(f); err != nil {
+		return nil, err
+	}
 	output = &s3.HeadObjectOutput{
-		ContentLength: aws.Int64(f.Content.Size()),
-		LastModified:  aws.Time(f.LastModified),
-		ETag:          aws.String(f.ETag),
-		Metadata:      f.Metadata,
+		ContentLength:        aws.Int64(f.Content.Size()),
+		LastModified:         aws.Time(f.LastModified),
+		ETag:                 aws.String(f.etag()),
+		Metadata:             f.Metadata,
+		ContentType:          stringOrNil(f.ContentType),
+		ContentEncoding:      stringOrNil(f.ContentEncoding),
+		CacheControl:         stringOrNil(f.CacheControl),
+		StorageClass:         stringOrNil(f.StorageClass),
+		VersionId:            stringOrNil(f.VersionID),
+		ServerSideEncryption: stringOrNil(f.ServerSideEncryption),
+		SSECustomerAlgorithm: sseCustomerAlgorithmOrNil(f),
+		SSECustomerKeyMD5:    stringOrNil(f.SSECustomerKeyMD5),
+		Restore:              c.restoreStatus(f),
 	}
 	return output, nil
 }
@@ -401,17 +698,19 @@ func (c *Client) HeadObjectWithContext(
 func (c *Client) HeadObjectRequest(input *s3.HeadObjectInput) (req *request.Request, out *s3.HeadObjectOutput) {
 	var err error
 	req, out = c.svc.HeadObjectRequest(input)
+	presignable(req)
+	rec := c.record("HeadObject", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&out, &r.Error) })
 	if err := c.startRequest("HeadObjectRequest", input); err != nil {
 		req.Error = err
+		return
 	}
-	out1, err := c.HeadObject(input)
+	out1, err := c.headObject(input)
 	if err != nil {
 		req.Error = err
 	} else {
 		*out = *out1
 	}
-	req.Handlers.Send.Clear()
-	req.Handlers.Clear()
 	return
 }
 
@@ -429,69 +728,41 @@ func (c *Client) ListObjectsV2WithContext(
 
 // ListObjectsV2 is used by DownloadDirTree to detemine all the files
 // to download.
-func (c *Client) ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+func (c *Client) ListObjectsV2(input *s3.ListObjectsV2Input) (output *s3.ListObjectsV2Output, err error) {
+	rec := c.record("ListObjectsV2", input)
+	defer rec.done(&output, &err)
+	return c.listObjectsV2(input)
+}
+
+// listObjectsV2 implements ListObjectsV2 and ListObjectsV2Request.
+func (c *Client) listObjectsV2(input *s3.ListObjectsV2Input) (output *s3.ListObjectsV2Output, err error) {
 	if err := c.startRequest("ListObjectV2", input); err != nil {
 		return nil, err
 	}
-	if got, want := aws.StringValue(input.Bucket), c.bucket; got != want {
-		c.t.Errorf("ListObjectsV2 received unexpected bucket got: %s want %s", got, want)
+	if err := c.checkBucket("ListObjectsV2", input.Bucket); err != nil {
+		return nil, err
 	}
-	prefix := aws.StringValue(input.Prefix)
-	prefixLen := len(prefix)
-	prefixGroupMap := make(map[string]*s3.CommonPrefix)
-
-	delimiter := aws.StringValue(input.Delimiter)
-	hasDelimiter := len(delimiter) > 0
-	output := &s3.ListObjectsV2Output{
+	output = &s3.ListObjectsV2Output{
 		IsTruncated: aws.Bool(false),
 	}
-
 	c.m.Lock()
 	defer c.m.Unlock()
-
-	for key, content := range c.content {
-		if strings.HasPrefix(key, prefix) {
-
-			nextDelimOffset := strings.Index(key[prefixLen:], delimiter)
-
-			// handle common prefixes code
-			if hasDelimiter && nextDelimOffset >= 0 {
-
-				groupKey := key[:prefixLen+nextDelimOffset+1]
-				if _, present := prefixGroupMap[groupKey]; !present {
-					prefixGroupMap[groupKey] = &s3.CommonPrefix{
-						Prefix: aws.String(groupKey),
-					}
-				}
-			} else {
-				object := &s3.Object{
-					Key:          aws.String(key),
-					Size:         aws.Int64(content.Content.Size()),
-					LastModified: aws.Time(content.LastModified),
-					ETag:         aws.String(content.ETag),
-				}
-				output.Contents = append(output.Contents, object)
-			}
-		}
-
-	}
-	for _, cprefix := range prefixGroupMap {
-		output.CommonPrefixes = append(output.CommonPrefixes, cprefix)
-	}
+	output.Contents, output.CommonPrefixes, _, _ = c.listLocked(
+		aws.StringValue(input.Prefix), aws.StringValue(input.Delimiter), "", 0)
 	return output, nil
 }
 
 // ListObjectsV2Request implements the request variant of ListObjectsV2.
 func (c *Client) ListObjectsV2Request(
 	input *s3.ListObjectsV2Input) (req *request.Request, output *s3.ListObjectsV2Output) {
-	if got, want := aws.StringValue(input.Bucket), c.bucket; got != want {
-		c.t.Errorf("ListObjectsV2 received unexpected bucket got: %s want %s", got, want)
-	}
 	req, output = c.svc.ListObjectsV2Request(input)
+	rec := c.record("ListObjectsV2", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
 	if err := c.startRequest("ListObjectsV2Request", input); err != nil {
 		req.Error = err
+		return
 	}
-	outputp, err := c.ListObjectsV2(input)
+	outputp, err := c.listObjectsV2(input)
 	if err != nil {
 		req.Error = err
 	} else {
@@ -501,24 +772,106 @@ func (c *Client) ListObjectsV2Request(
 }
 
 // PutObjectRequest is used within s3manager to upload single part files.
+// As with UploadPart, it verifies ContentMD5 and the
+// x-amz-checksum-<algorithm> request headers (see ChecksumHeader), and it
+// stores S3's checksum of the object (a composite one for multipart
+// uploads). An "If-None-Match: *" header makes the write create-only. An
+// object written with a customer-provided key (SSE-C) can only be read, or
+// copied, by requests that present the same key.
 func (c *Client) PutObjectRequest(
 	input *s3.PutObjectInput) (req *request.Request, output *s3.PutObjectOutput) {
-	if got, want := aws.StringValue(input.Bucket), c.bucket; got != want {
-		c.t.Errorf("PutObjectRequest received unexpected bucket got: %s want %s", got, want)
-	}
 	req, output = c.svc.PutObjectRequest(input)
+	presignable(req)
+	rec := c.record("PutObject", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
 	if err := c.startRequest("PutObjectRequest", input); err != nil {
 		req.Error = err
 	}
+	if err := c.checkBucket("PutObjectRequest", input.Bucket); err != nil {
+		req.Error = err
+		return
+	}
 	key := aws.StringValue(input.Key)
-	body, err := ioutil.ReadAll(input.Body)
-	if err != nil {
-		c.t.Errorf("PutObjectRequest when reading input.Body: %s", err)
+	var body []byte
+	if input.Body != nil { // e.g., when the request is to be presigned
+		var err error
+		if body, err = ioutil.ReadAll(input.Body); err != nil {
+			req.Error = awserr.New(request.ErrCodeRead, "PutObjectRequest when reading input.Body", err)
+			return
+		}
 	}
+	rec.setBytes(int64(len(body)))
 	if err := checkBodySHA256(body, input.Metadata); err != nil {
-		c.t.Errorf("PutObjectRequest: checksum: %s", err)
+		req.Error = c.badDigest("PutObjectRequest", err)
+		return
+	}
+	if err := c.checkContentMD5("PutObjectRequest", input.ContentMD5, body); err != nil {
+		req.Error = err
+		return
+	}
+	tags, err := parseTagging(input.Tagging)
+	if err != nil {
+		req.Error = err
+		return
+	}
+	keyMD5, err := parseSSECustomer("PutObjectRequest",
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5)
+	if err != nil {
+		req.Error = err
+		return
 	}
-	c.setFile(key, body, input.Metadata)
+	grants, err := aclHeaders{input.ACL, input.GrantFullControl, input.GrantRead,
+		input.GrantReadACP, nil, input.GrantWriteACP}.grants()
+	if err != nil {
+		req.Error = err
+		return
+	}
+	content := &testutil.ByteContent{Data: body}
+	output.ETag = aws.String(content.Checksum())
+	output.ServerSideEncryption = input.ServerSideEncryption
+	if keyMD5 != "" {
+		output.SSECustomerAlgorithm = aws.String(sseCustomerAlgorithm)
+		output.SSECustomerKeyMD5 = aws.String(keyMD5)
+	}
+	// The object is stored when the request is sent, so that headers set on
+	// the request by the caller (e.g., "If-None-Match: *") are honored.
+	req.Handlers.Send.PushBack(func(r *request.Request) {
+		if err := c.uploadBody(r.Context(), len(body)); err != nil {
+			r.Error = err
+			return
+		}
+		alg, sum, err := c.checkChecksumHeaders("PutObject", r.HTTPRequest.Header, body)
+		if err != nil {
+			r.Error = err
+			return
+		}
+		c.m.Lock()
+		defer c.m.Unlock()
+		if err := c.checkCreateOnlyLocked(r.HTTPRequest.Header, key); err != nil {
+			r.Error = err
+			return
+		}
+		fc := FileContent{
+			Content:              content,
+			Metadata:             input.Metadata,
+			LastModified:         c.now(),
+			ETag:                 *output.ETag,
+			ContentType:          aws.StringValue(input.ContentType),
+			ContentEncoding:      aws.StringValue(input.ContentEncoding),
+			CacheControl:         aws.StringValue(input.CacheControl),
+			StorageClass:         aws.StringValue(input.StorageClass),
+			ServerSideEncryption: aws.StringValue(input.ServerSideEncryption),
+			Tags:                 tags,
+			ChecksumAlgorithm:    alg,
+			Checksum:             sum,
+			SSECustomerKeyMD5:    keyMD5,
+			Grants:               grants,
+			VersionID:            c.newVersionLocked(key),
+		}
+		c.putLocked(key, fc)
+		c.notifyLocked(EventObjectCreatedPut, key, &fc)
+		output.VersionId = stringOrNil(fc.VersionID)
+	})
 	return
 }
 
@@ -590,21 +943,74 @@ func (c *Client) CompleteMultipartUploadWithContext(
 func (c *Client) CreateMultipartUploadRequest(
 	input *s3.CreateMultipartUploadInput) (req *request.Request, output *s3.CreateMultipartUploadOutput) {
 	req, output = c.svc.CreateMultipartUploadRequest(input)
+	rec := c.record("CreateMultipartUpload", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
 	if err := c.startRequest("CreateMultipartUploadRequest", input); err != nil {
 		req.Error = err
+		return
+	}
+	if err := c.checkBucket("CreateMultipartUploadRequest", input.Bucket); err != nil {
+		req.Error = err
+		return
+	}
+	tags, err := parseTagging(input.Tagging)
+	if err != nil {
+		req.Error = err
+		return
+	}
+	keyMD5, err := parseSSECustomer("CreateMultipartUploadRequest",
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5)
+	if err != nil {
+		req.Error = err
+		return
 	}
-	uploadID := c.newUploadID()
+	grants, err := aclHeaders{input.ACL, input.GrantFullControl, input.GrantRead,
+		input.GrantReadACP, nil, input.GrantWriteACP}.grants()
+	if err != nil {
+		req.Error = err
+		return
+	}
+	uploadID, seq := c.newUploadID()
 	r := &multipartUpload{
-		status:  multipartUploadActive,
-		id:      uploadID,
-		key:     aws.StringValue(input.Key),
-		meta:    input.Metadata,
-		partial: map[int64][]byte{},
+		status: multipartUploadActive,
+		id:     uploadID,
+		seq:    seq,
+		key:    aws.StringValue(input.Key),
+		meta:   input.Metadata,
+		object: FileContent{
+			ContentType:          aws.StringValue(input.ContentType),
+			ContentEncoding:      aws.StringValue(input.ContentEncoding),
+			CacheControl:         aws.StringValue(input.CacheControl),
+			StorageClass:         aws.StringValue(input.StorageClass),
+			ServerSideEncryption: aws.StringValue(input.ServerSideEncryption),
+			Tags:                 tags,
+			SSECustomerKeyMD5:    keyMD5,
+			Grants:               grants,
+		},
+		initiated: c.now(),
+		partial:   map[int64]*uploadedPart{},
 	}
 	output.SetUploadId(r.id)
-	c.m.Lock()
-	defer c.m.Unlock()
-	c.uploads[r.id] = r
+	output.ServerSideEncryption = input.ServerSideEncryption
+	if keyMD5 != "" {
+		output.SSECustomerAlgorithm = aws.String(sseCustomerAlgorithm)
+		output.SSECustomerKeyMD5 = aws.String(keyMD5)
+	}
+	// The upload is created when the request is sent: its checksum
+	// algorithm is selected by a request header, which the caller may set
+	// before then.
+	req.Handlers.Send.PushBack(func(hr *request.Request) {
+		if alg := checksumAlgorithm(hr.HTTPRequest.Header); alg != "" {
+			if _, err := newChecksumHash(alg); err != nil {
+				hr.Error = err
+				return
+			}
+			r.object.ChecksumAlgorithm = alg
+		}
+		c.m.Lock()
+		defer c.m.Unlock()
+		c.uploads[r.id] = r
+	})
 	return req, output
 }
 
@@ -612,29 +1018,71 @@ func (c *Client) CreateMultipartUploadRequest(
 func (c *Client) UploadPartRequest(
 	input *s3.UploadPartInput) (req *request.Request, output *s3.UploadPartOutput) {
 	req, output = c.svc.UploadPartRequest(input)
+	rec := c.record("UploadPart", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
 	if err := c.startRequest("UploadPartRequest", input); err != nil {
 		req.Error = err
 	}
+	if err := c.checkBucket("UploadPartRequest", input.Bucket); err != nil {
+		req.Error = err
+		return
+	}
 	uploadID := aws.StringValue(input.UploadId)
+	partNumber := aws.Int64Value(input.PartNumber)
+	if err := checkPartNumber(partNumber); err != nil {
+		req.Error = err
+		return
+	}
 	body, err := ioutil.ReadAll(input.Body)
 	if err != nil {
-		c.t.Errorf("UploadPartRequest when reading input.Body: %s", err)
+		req.Error = awserr.New(request.ErrCodeRead, "UploadPartRequest when reading input.Body", err)
 		return
 	}
-	c.m.Lock()
-	defer c.m.Unlock()
-	r := c.uploads[uploadID]
-	if r == nil {
-		c.t.Errorf("UploadPartRequest: unknown upload ID %s", uploadID)
+	rec.setBytes(int64(len(body)))
+	if err := c.checkContentMD5("UploadPartRequest", input.ContentMD5, body); err != nil {
+		req.Error = err
 		return
 	}
-	if r.status != multipartUploadActive {
-		c.t.Errorf("UploadPartRequest: upload %s finished with status %v", uploadID, r.status)
+	keyMD5, err := parseSSECustomer("UploadPartRequest",
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5)
+	if err != nil {
+		req.Error = err
+		return
 	}
-	r.partial[aws.Int64Value(input.PartNumber)] = body
-
-	content := testutil.ByteContent{Data: body}
-	output.SetETag(content.Checksum())
+	part := c.newPart(body)
+	output.SetETag(part.etag)
+	// As with PutObjectRequest, the part is stored when the request is sent
+	// so that checksum headers set by the caller are honored.
+	req.Handlers.Send.PushBack(func(hr *request.Request) {
+		if err := c.uploadBody(hr.Context(), len(body)); err != nil {
+			hr.Error = err
+			return
+		}
+		alg, sum, err := c.checkChecksumHeaders("UploadPart", hr.HTTPRequest.Header, body)
+		if err != nil {
+			hr.Error = err
+			return
+		}
+		c.m.Lock()
+		defer c.m.Unlock()
+		r := c.uploads[uploadID]
+		if r == nil || r.status != multipartUploadActive {
+			hr.Error = c.violation(noSuchUpload(uploadID))
+			return
+		}
+		if r.object.SSECustomerKeyMD5 != keyMD5 {
+			hr.Error = invalidSSERequest("UploadPart: the SSE-C parameters do not match those of the upload")
+			return
+		}
+		if hr.Error = c.setPartChecksum(r, part, alg, sum); hr.Error != nil {
+			return
+		}
+		r.partial[partNumber] = part
+		if keyMD5 != "" {
+			output.SSECustomerAlgorithm = aws.String(sseCustomerAlgorithm)
+			output.SSECustomerKeyMD5 = aws.String(keyMD5)
+		}
+	})
 	return req, output
 }
 
@@ -642,27 +1090,61 @@ func (c *Client) UploadPartRequest(
 func (c *Client) UploadPartCopyRequest(
 	input *s3.UploadPartCopyInput) (req *request.Request, output *s3.UploadPartCopyOutput) {
 	req, output = c.svc.UploadPartCopyRequest(input)
+	rec := c.record("UploadPartCopy", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
 	if err := c.startRequest("UploadPartCopyRequest", input); err != nil {
 		req.Error = err
+		return
+	}
+	if err := c.checkBucket("UploadPartCopyRequest", input.Bucket); err != nil {
+		req.Error = err
+		return
 	}
 	uploadID := aws.StringValue(input.UploadId)
-	source := aws.StringValue(input.CopySource)
-	if !strings.HasPrefix(source, c.bucket+"/") {
-		c.t.Errorf("UploadPartCopyRequest expected copy source from the same bucket, got: %v", source)
+	partNumber := aws.Int64Value(input.PartNumber)
+	if err := checkPartNumber(partNumber); err != nil {
+		req.Error = err
+		return
+	}
+	src, err := c.copySourceKey("UploadPartCopyRequest", aws.StringValue(input.CopySource))
+	if err != nil {
+		req.Error = err
+		return
+	}
+	if err := c.authorizeAction("s3:GetObject", src, false); err != nil {
+		req.Error = err
+		return
 	}
-	src := strings.TrimPrefix(source, c.bucket+"/")
 	b, ok := c.GetFile(src)
 	if !ok {
-		c.t.Errorf("UploadPartCopyRequest source %s does not exist", src)
+		req.Error = c.violation(awserr.New("NoSuchKey", fmt.Sprintf("copy source %s not found", src), nil))
+		return
 	}
-	start := int64(0)
-	last := b.Content.Size() - 1
-	if input.CopySourceRange != nil {
-		var err error
-		start, last, err = parseByteRange(aws.StringValue(input.CopySourceRange), b.Content.Size())
-		if err != nil {
-			c.t.Errorf("UploadPartCopyRequest: %v", err)
-		}
+	if err := readSSECustomer("UploadPartCopyRequest", b, input.CopySourceSSECustomerAlgorithm,
+		input.CopySourceSSECustomerKey, input.CopySourceSSECustomerKeyMD5); err != nil {
+		req.Error = err
+		return
+	}
+	if err := c.checkReadable("UploadPartCopyRequest", b); err != nil {
+		req.Error = err
+		return
+	}
+	keyMD5, err := parseSSECustomer("UploadPartCopyRequest",
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5)
+	if err != nil {
+		req.Error = err
+		return
+	}
+	cond := conditions{input.CopySourceIfMatch, input.CopySourceIfNoneMatch,
+		input.CopySourceIfModifiedSince, input.CopySourceIfUnmodifiedSince}
+	if err := cond.checkCopySource(b); err != nil {
+		req.Error = err
+		return
+	}
+	start, last, err := c.resolveRange("UploadPartCopyRequest", input.CopySourceRange, b.Content.Size())
+	if err != nil {
+		req.Error = err
+		return
 	}
 
 	data := make([]byte, last-start+1)
@@ -670,17 +1152,33 @@ func (c *Client) UploadPartCopyRequest(
 		c.t.Fatal(err)
 	}
 
-	c.m.Lock()
-	defer c.m.Unlock()
-	r := c.uploads[uploadID]
-	if r == nil {
-		c.t.Errorf("UploadPartRequest: unknown upload ID %s", uploadID)
-		return
-	}
-	r.partial[aws.Int64Value(input.PartNumber)] = data
-	content := testutil.ByteContent{Data: data}
-	output.SetCopyPartResult(&s3.CopyPartResult{
-		ETag: aws.String(content.Checksum()),
+	// As with UploadPartRequest, the part is stored when the request is
+	// sent.
+	req.Handlers.Send.PushBack(func(hr *request.Request) {
+		c.m.Lock()
+		defer c.m.Unlock()
+		r := c.uploads[uploadID]
+		if r == nil || r.status != multipartUploadActive {
+			hr.Error = c.violation(noSuchUpload(uploadID))
+			return
+		}
+		if r.object.SSECustomerKeyMD5 != keyMD5 {
+			hr.Error = invalidSSERequest("UploadPartCopy: the SSE-C parameters do not match those of the upload")
+			return
+		}
+		part := c.newPart(data)
+		if hr.Error = c.setPartChecksum(r, part, "", ""); hr.Error != nil {
+			return
+		}
+		r.partial[partNumber] = part
+		if keyMD5 != "" {
+			output.SSECustomerAlgorithm = aws.String(sseCustomerAlgorithm)
+			output.SSECustomerKeyMD5 = aws.String(keyMD5)
+		}
+		output.SetCopyPartResult(&s3.CopyPartResult{
+			ETag:         aws.String(part.etag),
+			LastModified: aws.Time(part.lastModified),
+		})
 	})
 	return req, output
 }
@@ -689,20 +1187,25 @@ func (c *Client) UploadPartCopyRequest(
 func (c *Client) AbortMultipartUploadRequest(
 	input *s3.AbortMultipartUploadInput) (req *request.Request, output *s3.AbortMultipartUploadOutput) {
 	req, output = c.svc.AbortMultipartUploadRequest(input)
+	rec := c.record("AbortMultipartUpload", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
 	if err := c.startRequest("AbortMultipartUploadRequest", input); err != nil {
 		req.Error = err
+		return
 	}
 	uploadID := aws.StringValue(input.UploadId)
-	c.m.Lock()
-	r := c.uploads[uploadID]
-	if r == nil {
-		c.t.Errorf("AbortMultipartUploadRequest: unknown upload ID %s", uploadID)
-	} else if r.status != multipartUploadCompleted {
+	// The upload is aborted when the request is sent.
+	req.Handlers.Send.PushBack(func(hr *request.Request) {
+		c.m.Lock()
+		defer c.m.Unlock()
+		r := c.uploads[uploadID]
+		if r == nil || r.status == multipartUploadCompleted {
+			hr.Error = c.violation(noSuchUpload(uploadID))
+			return
+		}
 		r.status = multipartUploadAborted
-	} else {
-		c.t.Errorf("AbortMultipartUploadRequest: upload %s in wrong state %v", uploadID, r.status)
-	}
-	c.m.Unlock()
+		r.partial = nil
+	})
 	return req, output
 }
 
@@ -716,15 +1219,36 @@ func (c *Client) AbortMultipartUploadWithContext(
 }
 
 // CompleteMultipartUploadRequest stubs the corresponding s3iface.API method.
+// The upload is validated as S3 does: every part but the last must be at
+// least MinPartSize bytes, part numbers must be in [1, MaxPartNumber], and
+// the parts must be sorted and match the ETags of uploaded parts. The ETag of
+// the object has S3's "<md5>-<number of parts>" form.
 func (c *Client) CompleteMultipartUploadRequest(
 	input *s3.CompleteMultipartUploadInput) (req *request.Request, output *s3.CompleteMultipartUploadOutput) {
 	req, output = c.svc.CompleteMultipartUploadRequest(input)
+	rec := c.record("CompleteMultipartUpload", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
 	if err := c.startRequest("CompleteMultipartUploadRequest", input); err != nil {
 		req.Error = err
+		return
 	}
 	uploadID := aws.StringValue(input.UploadId)
 	key := aws.StringValue(input.Key)
-	c.setFileFromPartialContent(key, uploadID, input.MultipartUpload.Parts)
+	var parts []*s3.CompletedPart
+	if input.MultipartUpload != nil {
+		parts = input.MultipartUpload.Parts
+	}
+	// The object is assembled when the request is sent.
+	req.Handlers.Send.PushBack(func(hr *request.Request) {
+		etag, err := c.setFileFromPartialContent(key, uploadID, parts)
+		if err != nil {
+			hr.Error = err
+			return
+		}
+		output.Bucket = input.Bucket
+		output.Key = input.Key
+		output.ETag = aws.String(etag)
+	})
 	return req, output
 }
 
@@ -732,91 +1256,76 @@ func (c *Client) CompleteMultipartUploadRequest(
 // GetObjectRequest is used by GetObjectWithContext by s3manager (aws-sdk >= 1.8.0) to downoad files.
 func (c *Client) GetObjectRequest(
 	input *s3.GetObjectInput) (req *request.Request, output *s3.GetObjectOutput) {
-	if got, want := aws.StringValue(input.Bucket), c.bucket; got != want {
-		c.t.Errorf("GetObjectRequest received unexpected bucket got: %s want %s", got, want)
-	}
 	req, output = c.svc.GetObjectRequest(input)
+	presignable(req)
+	rec := c.record("GetObject", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
 	if err := c.startRequest("GetObjectRequest", input); err != nil {
 		req.Error = err
-	}
-	key := aws.StringValue(input.Key)
-	b, ok := c.GetFile(key)
-	if !ok {
-		c.t.Logf("GetObjectRequest no file content for: %s", key)
-		req.Error = awserr.New("NoSuchKey", fmt.Sprintf("key %s not found", key), nil)
-		return
-	}
-	if input.IfMatch != nil && b.Content.Checksum() != *input.IfMatch {
-		req.Error = awserr.New("PreconditionFailed", "mismatched etag", nil)
 		return
 	}
-	start := int64(0)
-	last := b.Content.Size() - 1
-	if input.Range != nil {
-		var err error
-		start, last, err = parseByteRange(aws.StringValue(input.Range), b.Content.Size())
-		if err != nil {
-			c.t.Errorf("GetObjectRequest: %v", err)
-		}
-	}
-	if (last + 1) >= b.Content.Size() {
-		output.Body = ioutil.NopCloser(io.NewSectionReader(b.Content, start, b.Content.Size()-start))
-		if start > 0 {
-			last = b.Content.Size() - 1
-			output.ContentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", start, last, b.Content.Size()))
-		}
-		output.ContentLength = aws.Int64(b.Content.Size() - start)
+	outputp, err := c.getObject("GetObjectRequest", input)
+	if err != nil {
+		req.Error = err
 	} else {
-		output.Body = ioutil.NopCloser(io.NewSectionReader(b.Content, start, last-start+1))
-		output.ContentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", start, last, b.Content.Size()))
-		output.ContentLength = aws.Int64(last - start + 1)
+		*output = *outputp
 	}
-	output.LastModified = aws.Time(b.LastModified)
-	output.ETag = aws.String(b.ETag)
-	output.Metadata = b.Metadata
 	return
 }
 
 // CopyObjectRequest implements the Request model of server side object copying.
 func (c *Client) CopyObjectRequest(
 	input *s3.CopyObjectInput) (req *request.Request, output *s3.CopyObjectOutput) {
-	if got, want := aws.StringValue(input.Bucket), c.bucket; got != want {
-		c.t.Errorf("CopyObject received unexpected bucket got: %s want %s", got, want)
-	}
 	req, output = c.svc.CopyObjectRequest(input)
+	rec := c.record("CopyObject", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
 	if err := c.startRequest("CopyObjectRequest", input); err != nil {
 		req.Error = err
+		return
 	}
 	req.Handlers.Unmarshal.Clear()
-
-	// c.t.Logf("CopyObjectRequest input: %v", *input)
-	source := aws.StringValue(input.CopySource)
-	if !strings.HasPrefix(source, c.bucket+"/") {
-		c.t.Errorf("CopyObject expected copy source from the same bucket, got: %v", source)
-	}
-	src, dst := strings.TrimPrefix(source, c.bucket+"/"), aws.StringValue(input.Key)
-	if err := c.copyFile(src, dst, input.Metadata); err != nil {
-		c.t.Errorf("CopyObjectRequest: %v", err)
-	}
+	// The object is copied when the request is sent, so that a request
+	// throttled or canceled by the Network has no effect.
+	req.Handlers.Send.PushBack(func(r *request.Request) {
+		outputp, err := c.copyObject("CopyObjectRequest", input)
+		if err != nil {
+			r.Error = err
+			return
+		}
+		*output = *outputp
+	})
 	return
 }
 
-// CopyObject implements S3-side object copying.
-func (c *Client) CopyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+// CopyObject implements S3-side object copying. It honors
+// MetadataDirective and TaggingDirective, and the CopySourceIf*
+// preconditions.
+func (c *Client) CopyObject(input *s3.CopyObjectInput) (output *s3.CopyObjectOutput, err error) {
+	rec := c.record("CopyObject", input)
+	defer rec.done(&output, &err)
 	if err := c.startRequest("CopyObject", input); err != nil {
 		return nil, err
 	}
-	if got, want := aws.StringValue(input.Bucket), c.bucket; got != want {
-		c.t.Errorf("CopyObject received unexpected bucket got: %s want %s", got, want)
+	return c.copyObject("CopyObject", input)
+}
+
+// copyObject implements CopyObject and CopyObjectRequest.
+func (c *Client) copyObject(api string, input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	if err := c.checkBucket(api, input.Bucket); err != nil {
+		return nil, err
+	}
+	src, err := c.copySourceKey(api, aws.StringValue(input.CopySource))
+	if err != nil {
+		return nil, err
+	}
+	if err := c.authorizeAction("s3:GetObject", src, false); err != nil {
+		return nil, err
 	}
-	// c.t.Logf("CopyObject input: %v", *input)
-	source := aws.StringValue(input.CopySource)
-	if !strings.HasPrefix(source, c.bucket+"/") {
-		c.t.Errorf("CopyObject expected copy source from the same bucket, got: %v", source)
+	if err := c.checkCopySource(src, input); err != nil {
+		return nil, err
 	}
-	src, dst := strings.TrimPrefix(source, c.bucket+"/"), aws.StringValue(input.Key)
-	if err := c.copyFile(src, dst, input.Metadata); err != nil {
-		c.t.Errorf("CopyObjectRequest: %v", err)
+	if err := c.copyFile(src, aws.StringValue(input.Key), input); err != nil {
+		return nil, err
 	}
 	return &s3.CopyObjectOutput{}, nil
 }
@@ -830,35 +1339,29 @@ func (c *Client) CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInpu
 	return out, req.Send()
 }
 
-// DeleteObjects removes a set of objects from the bucket
+// DeleteObjects removes a set of objects from the bucket. As with S3, a key
+// that cannot be deleted is reported in the output's Errors rather than
+// failing the request.
 func (c *Client) DeleteObjects(input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
-	if err := c.startRequest("DeleteObjects", input); err != nil {
-		return nil, err
-	}
-	if got, want := aws.StringValue(input.Bucket), c.bucket; got != want {
-		c.t.Errorf("DeleteObjects received unexpected bucket got: %s want %s", got, want)
-	}
-
-	for _, object := range input.Delete.Objects {
-		_, err := c.DeleteObject(&s3.DeleteObjectInput{Bucket: input.Bucket, Key: object.Key})
-		if err != nil {
-			return &s3.DeleteObjectsOutput{}, err
-		}
-	}
-	return &s3.DeleteObjectsOutput{}, nil
+	return c.deleteObjects(aws.BackgroundContext(), "DeleteObjects", input)
 }
 
 // DeleteObject removes an object from the bucket.
-func (c *Client) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+func (c *Client) DeleteObject(input *s3.DeleteObjectInput) (output *s3.DeleteObjectOutput, err error) {
+	rec := c.record("DeleteObject", input)
+	defer rec.done(&output, &err)
 	if err := c.startRequest("DeleteObject", input); err != nil {
 		return nil, err
 	}
-	if got, want := aws.StringValue(input.Bucket), c.bucket; got != want {
-		c.t.Errorf("DeleteObject received unexpected bucket got: %s want %s", got, want)
+	return c.deleteObject("DeleteObject", input)
+}
+
+// deleteObject implements DeleteObject and DeleteObjectRequest.
+func (c *Client) deleteObject(api string, input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	if err := c.checkBucket(api, input.Bucket); err != nil {
+		return nil, err
 	}
-	key := aws.StringValue(input.Key)
-	c.deleteFile(key)
-	return &s3.DeleteObjectOutput{}, nil
+	return c.deleteFile(aws.StringValue(input.Key), aws.StringValue(input.VersionId)), nil
 }
 
 // DeleteObjectWithContext is the same as DeleteObject, but allows passing a
@@ -874,33 +1377,51 @@ func (c *Client) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObject
 
 // DeleteObjectRequest creates an RPC request for DeleteObject.
 func (c *Client) DeleteObjectRequest(input *s3.DeleteObjectInput) (req *request.Request, out *s3.DeleteObjectOutput) {
-	var err error
 	req, out = c.svc.DeleteObjectRequest(input)
+	presignable(req)
+	rec := c.record("DeleteObject", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&out, &r.Error) })
 	if err := c.startRequest("DeleteObjectRequest", input); err != nil {
 		req.Error = err
 	}
-	out1, err := c.DeleteObject(input)
-	if err != nil {
-		req.Error = err
-	} else {
+	// The object is deleted when the request is sent, so that a request
+	// throttled or canceled by the Network has no effect. The request is
+	// also subject to c.Err as a DeleteObject call.
+	req.Handlers.Send.PushBack(func(r *request.Request) {
+		if err := c.startRequest("DeleteObject", input); err != nil {
+			r.Error = err
+			return
+		}
+		out1, err := c.deleteObject("DeleteObjectRequest", input)
+		if err != nil {
+			r.Error = err
+			return
+		}
 		*out = *out1
-	}
-	req.Handlers.Send.Clear()
-	req.Handlers.Clear()
+	})
 	return
 }
 
-// DeleteObjectWithContext is the same as DeleteObject, but allows passing a
-// context and options.
+// DeleteObjectsWithContext is the same as DeleteObjects, but allows passing
+// a context and options.
 func (c *Client) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	return c.deleteObjects(ctx, "DeleteObjectsWithContext", input, opts...)
+}
+
+// deleteObjects implements DeleteObjects and DeleteObjectsWithContext.
+func (c *Client) deleteObjects(ctx aws.Context, api string, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	if err := c.startRequest(api, input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket(api, input.Bucket); err != nil {
+		return nil, err
+	}
 	n := len(input.Delete.Objects)
 	if n > s3DeleteKeyLimit {
 		return nil, fmt.Errorf("too many objects %d", n)
 	}
 	var out s3.DeleteObjectsOutput
-	out.Deleted = make([]*s3.DeletedObject, n)
-	out.Errors = make([]*s3.Error, n)
-	for i, o := range input.Delete.Objects {
+	for _, o := range input.Delete.Objects {
 		r, err := c.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
 			Bucket:                    input.Bucket,
 			BypassGovernanceRetention: input.BypassGovernanceRetention,
@@ -910,42 +1431,87 @@ func (c *Client) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjec
 			VersionId:                 o.VersionId,
 		}, opts...)
 		if err != nil {
-			out.Errors[i] = &s3.Error{Message: aws.String(err.Error())}
+			e := &s3.Error{Key: o.Key, Message: aws.String(err.Error())}
+			if aerr, ok := err.(awserr.Error); ok {
+				e.Code = aws.String(aerr.Code())
+				e.Message = aws.String(aerr.Message())
+			}
+			out.Errors = append(out.Errors, e)
 			continue
 		}
-		out.Deleted[i] = &s3.DeletedObject{
+		out.Deleted = append(out.Deleted, &s3.DeletedObject{
 			DeleteMarker: r.DeleteMarker,
 			Key:          o.Key,
-		}
+			VersionId:    r.VersionId,
+		})
 	}
 	return &out, nil
 }
 
-// GetObject retrieves an object from the bucket.
-func (c *Client) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+// GetObject retrieves an object from the bucket. GetObject and HeadObject
+// honor the If-Match, If-None-Match, If-Modified-Since and
+// If-Unmodified-Since preconditions, and return the system metadata and tag
+// count stored in the object's FileContent.
+func (c *Client) GetObject(input *s3.GetObjectInput) (output *s3.GetObjectOutput, err error) {
+	rec := c.record("GetObject", input)
+	defer rec.done(&output, &err)
 	if err := c.startRequest("GetObject", input); err != nil {
 		return nil, err
 	}
-	if got, want := aws.StringValue(input.Bucket), c.bucket; got != want {
-		c.t.Errorf("GetObject received unexpected bucket got: %s want %s", got, want)
-	}
+	return c.getObject("GetObject", input)
+}
 
-	output := s3.GetObjectOutput{}
+// getObject implements GetObject and GetObjectRequest.
+func (c *Client) getObject(api string, input *s3.GetObjectInput) (output *s3.GetObjectOutput, err error) {
+	if err := c.checkBucket(api, input.Bucket); err != nil {
+		return nil, err
+	}
 	key := aws.StringValue(input.Key)
-	b, ok := c.GetFile(key)
+	b, ok := c.readFile(key)
 	if !ok {
-		c.t.Logf("GetObject no file content for: %s", key)
+		c.t.Logf("%s no file content for: %s", api, key)
 		return nil, awserr.New("NoSuchKey", fmt.Sprintf("key %s not found", key), nil)
 	}
-	if input.IfMatch != nil && b.Content.Checksum() != *input.IfMatch {
-		return nil, awserr.New("PreconditionFailed", "mismatched etag", nil)
+	b.Content, b.ETag = b.snapshot()
+	if err := readSSECustomer(api, b,
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5); err != nil {
+		return nil, err
+	}
+	cond := conditions{input.IfMatch, input.IfNoneMatch, input.IfModifiedSince, input.IfUnmodifiedSince}
+	if err := cond.check(b); err != nil {
+		return nil, err
+	}
+	if err := c.checkReadable(api, b); err != nil {
+		return nil, err
 	}
-	output.Body = ioutil.NopCloser(io.NewSectionReader(b.Content, 0, b.Content.Size()))
-	output.ContentLength = aws.Int64(b.Content.Size())
-	output.LastModified = aws.Time(b.LastModified)
-	output.ETag = aws.String(b.ETag)
-	output.Metadata = b.Metadata
-	return &output, nil
+	size := b.Content.Size()
+	start, last, err := c.resolveRange(api, input.Range, size)
+	if err != nil {
+		return nil, err
+	}
+	output = &s3.GetObjectOutput{
+		Body:                 ioutil.NopCloser(io.NewSectionReader(b.Content, start, last-start+1)),
+		ContentLength:        aws.Int64(last - start + 1),
+		LastModified:         aws.Time(b.LastModified),
+		ETag:                 aws.String(b.etag()),
+		Metadata:             b.Metadata,
+		ContentType:          stringOrNil(b.ContentType),
+		ContentEncoding:      stringOrNil(b.ContentEncoding),
+		CacheControl:         stringOrNil(b.CacheControl),
+		StorageClass:         stringOrNil(b.StorageClass),
+		VersionId:            stringOrNil(b.VersionID),
+		Restore:              c.restoreStatus(b),
+		ServerSideEncryption: stringOrNil(b.ServerSideEncryption),
+		SSECustomerAlgorithm: sseCustomerAlgorithmOrNil(b),
+		SSECustomerKeyMD5:    stringOrNil(b.SSECustomerKeyMD5),
+	}
+	if len(b.Tags) > 0 {
+		output.TagCount = aws.Int64(int64(len(b.Tags)))
+	}
+	if start > 0 || last < size-1 {
+		output.ContentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", start, last, size))
+	}
+	return output, nil
 }
 
 // GetObjectWithContext is used within s3manager (aws-sdk >= 1.8.0) to downoad files,
@@ -964,16 +1530,20 @@ func (c *Client) GetObjectWithContext(
 // GetBucketLocationRequest implements the bucket location (Client.Region)
 // request.
 func (c *Client) GetBucketLocationRequest(input *s3.GetBucketLocationInput) (req *request.Request, output *s3.GetBucketLocationOutput) {
-	if got, want := aws.StringValue(input.Bucket), c.bucket; got != want {
-		c.t.Errorf("GetBucketLocationRequest received unexpected bucket got: %s want %s", got, want)
-	}
 	req, output = c.svc.GetBucketLocationRequest(input)
+	rec := c.record("GetBucketLocation", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	// The location is set here rather than unmarshaled from a response.
+	req.Handlers.Unmarshal.Clear()
 	if err := c.startRequest("GetBucketLocationRequest", input); err != nil {
 		req.Error = err
+		return
+	}
+	if err := c.checkBucket("GetBucketLocationRequest", input.Bucket); err != nil {
+		req.Error = err
+		return
 	}
 	output.SetLocationConstraint(c.Region)
-	req.Handlers.Send.Clear()
-	req.Handlers.Clear()
 	return
 }
 
@@ -982,12 +1552,3 @@ func (c *Client) GetBucketLocationWithContext(ctx aws.Context, input *s3.GetBuck
 	setFakeResponse(ctx, req, opts...)
 	return out, req.Send()
 }
-
-// PutObjectAcl sets the ACL of an object already in the bucket.
-func (c *Client) PutObjectAcl(input *s3.PutObjectAclInput) (*s3.PutObjectAclOutput, error) {
-	if err := c.startRequest("PutObjectAcl", input); err != nil {
-		return nil, err
-	}
-	output := s3.PutObjectAclOutput{}
-	return &output, nil
-}
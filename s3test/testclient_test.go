@@ -1,12 +1,17 @@
 package s3test_test
 
 import (
+	"bytes"
+	"crypto/md5"
 	"crypto/sha256"
 	"fmt"
+	"io/ioutil"
+	"sync/atomic"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil"
 	"github.com/grailbio/testutil/s3test"
 )
 
@@ -144,3 +149,119 @@ func TestClientListObjectsV2(t *testing.T) {
 	})
 
 }
+
+// countingContent counts the calls to Checksum.
+type countingContent struct {
+	testutil.ContentAt
+	checksums int32
+}
+
+func (c *countingContent) Checksum() string {
+	atomic.AddInt32(&c.checksums, 1)
+	return c.ContentAt.Checksum()
+}
+
+func TestSetFileContentAtLazyETag(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	content := &countingContent{ContentAt: &testutil.FakeContentAt{SizeInBytes: 1 << 40}}
+	client.SetFileContentAt("huge", content, "")
+	if n := atomic.LoadInt32(&content.checksums); n != 0 {
+		t.Fatalf("SetFileContentAt computed the checksum %d times, want 0", n)
+	}
+	small := &countingContent{ContentAt: &testutil.ByteContent{Data: []byte("abc")}}
+	client.SetFileContentAt("small", small, "")
+	for i := 0; i < 2; i++ {
+		out, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(testBucket), Key: aws.String("small")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := aws.StringValue(out.ETag), fmt.Sprintf("%x", md5.Sum([]byte("abc"))); got != want {
+			t.Errorf("got ETag %v, want %v", got, want)
+		}
+	}
+	if n := atomic.LoadInt32(&content.checksums); n != 0 {
+		t.Errorf("HeadObject of another key computed the checksum %d times, want 0", n)
+	}
+	if n := atomic.LoadInt32(&small.checksums); n != 1 {
+		t.Errorf("two HeadObjects computed the checksum %d times, want 1", n)
+	}
+}
+
+func TestHugeObject(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	for _, content := range []testutil.ContentAt{
+		&testutil.FakeContentAt{SizeInBytes: 1 << 40},
+		&testutil.RandomContent{Seed: 1, SizeInBytes: 1 << 40},
+		&testutil.SparseContent{SizeInBytes: 1 << 40, Extents: []testutil.Extent{{Offset: 1 << 39, Data: []byte("data")}}},
+	} {
+		client.SetFileContentAt("huge", content, "")
+		head, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(testBucket), Key: aws.String("huge")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := aws.Int64Value(head.ContentLength), int64(1<<40); got != want {
+			t.Errorf("%T: got length %v, want %v", content, got, want)
+		}
+		out, err := client.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String(testBucket),
+			Key:    aws.String("huge"),
+			Range:  aws.String(fmt.Sprintf("bytes=%d-%d", 1<<39, 1<<39+3)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(out.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := make([]byte, 4)
+		if _, err := content.ReadAt(want, 1<<39); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%T: got %q, want %q", content, got, want)
+		}
+		if etag := aws.StringValue(out.ETag); etag == "" || etag != aws.StringValue(head.ETag) {
+			t.Errorf("%T: got ETags %v and %v", content, etag, aws.StringValue(head.ETag))
+		}
+	}
+}
+
+func TestDeleteObjectsErrors(t *testing.T) {
+	for _, withContext := range []bool{false, true} {
+		client := s3test.NewClient(t, testBucket)
+		for _, key := range []string{"a", "b", "c"} {
+			client.SetFile(key, []byte(key), "")
+		}
+		client.Err = func(api string, input interface{}) error {
+			if in, ok := input.(*s3.DeleteObjectInput); ok && api == "DeleteObject" && aws.StringValue(in.Key) == "b" {
+				return fmt.Errorf("injected error")
+			}
+			return nil
+		}
+		input := &s3.DeleteObjectsInput{
+			Bucket: aws.String(testBucket),
+			Delete: &s3.Delete{Objects: []*s3.ObjectIdentifier{
+				{Key: aws.String("a")}, {Key: aws.String("b")}, {Key: aws.String("c")},
+			}},
+		}
+		var (
+			out *s3.DeleteObjectsOutput
+			err error
+		)
+		if withContext {
+			out, err = client.DeleteObjectsWithContext(ctx, input)
+		} else {
+			out, err = client.DeleteObjects(input)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out.Deleted) != 2 || len(out.Errors) != 1 || aws.StringValue(out.Errors[0].Key) != "b" {
+			t.Errorf("withContext=%v: got %v", withContext, out)
+		}
+		if _, ok := client.GetFile("c"); ok {
+			t.Errorf("withContext=%v: c was not deleted", withContext)
+		}
+	}
+}
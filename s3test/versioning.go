@@ -0,0 +1,364 @@
+package s3test
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// nullVersionID is the version ID of an object written while the bucket's
+// versioning was not enabled.
+const nullVersionID = "null"
+
+// objectVersion is a version of an object other than its current version,
+// or a delete marker. The FileContent of a delete marker holds only its
+// LastModified time and VersionID.
+type objectVersion struct {
+	FileContent
+	deleteMarker bool
+	// noncurrent is the time at which the version was superseded. It is zero
+	// for a delete marker that is the current version of its key.
+	noncurrent time.Time
+}
+
+// versionID returns the version ID reported for id.
+func versionID(id string) string {
+	if id == "" {
+		return nullVersionID
+	}
+	return id
+}
+
+// setVersionsLocked sets the noncurrent versions and delete markers of key.
+// REQUIRES: c.m is locked.
+func (c *Client) setVersionsLocked(key string, versions []objectVersion) {
+	if len(versions) == 0 {
+		delete(c.versions, key)
+		return
+	}
+	c.versions[key] = versions
+}
+
+// newVersionLocked prepares for a new current version of key to be stored:
+// if versioning is enabled or suspended, the current version, if any,
+// becomes noncurrent. It returns the version ID of the new version, which is
+// empty (the null version) unless versioning is enabled. REQUIRES: c.m is
+// locked.
+func (c *Client) newVersionLocked(key string) string {
+	if c.versioning == "" {
+		return ""
+	}
+	now := c.now()
+	versions := c.versions[key]
+	if n := len(versions); n > 0 && versions[n-1].noncurrent.IsZero() {
+		versions[n-1].noncurrent = now
+	}
+	if f, ok := c.content[key]; ok {
+		versions = append(versions, objectVersion{FileContent: f, noncurrent: now})
+	}
+	var id string
+	if c.versioning == s3.BucketVersioningStatusEnabled {
+		c.versionSeq++
+		id = fmt.Sprintf("testversionid%d", c.versionSeq)
+	} else {
+		// The new null version replaces the previous one.
+		kept := versions[:0]
+		for _, v := range versions {
+			if v.VersionID != "" {
+				kept = append(kept, v)
+			}
+		}
+		versions = kept
+	}
+	c.setVersionsLocked(key, versions)
+	return id
+}
+
+// deleteCurrentLocked removes the current version of key, as DeleteObject
+// does without a version ID. If versioning is enabled or suspended, the
+// version becomes noncurrent and a delete marker becomes current; the
+// marker's version ID is returned. REQUIRES: c.m is locked.
+func (c *Client) deleteCurrentLocked(key string) (id string, marker bool) {
+	if c.versioning == "" {
+		c.deleteLocked(key)
+		return "", false
+	}
+	id = c.newVersionLocked(key)
+	c.deleteLocked(key)
+	c.versions[key] = append(c.versions[key], objectVersion{
+		FileContent:  FileContent{LastModified: c.now(), VersionID: id},
+		deleteMarker: true,
+	})
+	return id, true
+}
+
+// deleteVersionLocked permanently removes the given version of key, as
+// DeleteObject does with a version ID, and reports whether it was a delete
+// marker. If the current version is removed, the latest remaining version
+// becomes current. REQUIRES: c.m is locked.
+func (c *Client) deleteVersionLocked(key, id string) (marker bool) {
+	if id == nullVersionID {
+		id = ""
+	}
+	if f, ok := c.content[key]; ok && f.VersionID == id {
+		c.deleteLocked(key)
+		c.promoteLocked(key)
+		return false
+	}
+	versions := c.versions[key]
+	for i, v := range versions {
+		if v.VersionID != id {
+			continue
+		}
+		c.setVersionsLocked(key, append(versions[:i:i], versions[i+1:]...))
+		if v.noncurrent.IsZero() {
+			c.promoteLocked(key)
+		}
+		return v.deleteMarker
+	}
+	return false
+}
+
+// promoteLocked makes the latest noncurrent version of key, if any, its
+// current version. REQUIRES: c.m is locked and key has no current version.
+func (c *Client) promoteLocked(key string) {
+	versions := c.versions[key]
+	n := len(versions)
+	if n == 0 {
+		return
+	}
+	if versions[n-1].deleteMarker {
+		versions[n-1].noncurrent = time.Time{}
+		return
+	}
+	c.setVersionsLocked(key, versions[:n-1])
+	c.putLocked(key, versions[n-1].FileContent)
+}
+
+// PutBucketVersioning sets the versioning state of the bucket, Enabled or
+// Suspended; as with S3, a bucket cannot return to the unversioned state.
+// While versioning is enabled, each object written is a new version with a
+// unique version ID, and the version it supersedes is kept as a noncurrent
+// version; deleting an object without a version ID makes its current
+// version noncurrent and adds a delete marker. While versioning is
+// suspended, new versions are null versions, which replace the previous
+// null version. DeleteObject with a version ID permanently removes that
+// version. The versions of the bucket are listed by ListObjectVersions, and
+// noncurrent versions are expired by lifecycle rules (see ApplyLifecycle).
+// Reading a specific version, e.g., GetObject with a VersionId, is not
+// supported: reads return the current version.
+func (c *Client) PutBucketVersioning(input *s3.PutBucketVersioningInput) (output *s3.PutBucketVersioningOutput, err error) {
+	rec := c.record("PutBucketVersioning", input)
+	defer rec.done(&output, &err)
+	return c.putBucketVersioning(input)
+}
+
+// putBucketVersioning implements PutBucketVersioning and PutBucketVersioningRequest.
+func (c *Client) putBucketVersioning(input *s3.PutBucketVersioningInput) (output *s3.PutBucketVersioningOutput, err error) {
+	if err := c.startRequest("PutBucketVersioning", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("PutBucketVersioning", input.Bucket); err != nil {
+		return nil, err
+	}
+	var config s3.VersioningConfiguration
+	if input.VersioningConfiguration != nil {
+		config = *input.VersioningConfiguration
+	}
+	switch status := aws.StringValue(config.Status); status {
+	case s3.BucketVersioningStatusEnabled, s3.BucketVersioningStatusSuspended:
+	default:
+		return nil, awserr.New("MalformedXML", fmt.Sprintf("invalid versioning status %q", status), nil)
+	}
+	if aws.StringValue(config.MFADelete) == s3.MFADeleteEnabled {
+		return nil, awserr.NewRequestFailure(awserr.New("NotImplemented",
+			"s3test: MFA delete is not supported", nil), http.StatusNotImplemented, "")
+	}
+	c.m.Lock()
+	c.versioning = aws.StringValue(config.Status)
+	c.m.Unlock()
+	return &s3.PutBucketVersioningOutput{}, nil
+}
+
+// PutBucketVersioningRequest implements the request variant of
+// PutBucketVersioning.
+func (c *Client) PutBucketVersioningRequest(input *s3.PutBucketVersioningInput) (req *request.Request, output *s3.PutBucketVersioningOutput) {
+	req, output = c.svc.PutBucketVersioningRequest(input)
+	rec := c.record("PutBucketVersioning", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("PutBucketVersioningRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.putBucketVersioning(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// PutBucketVersioningWithContext implements the corresponding s3iface.API
+// method.
+func (c *Client) PutBucketVersioningWithContext(ctx aws.Context, input *s3.PutBucketVersioningInput, opts ...request.Option) (*s3.PutBucketVersioningOutput, error) {
+	req, out := c.PutBucketVersioningRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
+
+// GetBucketVersioning returns the versioning state of the bucket. As with
+// S3, the status is absent if versioning has never been enabled.
+func (c *Client) GetBucketVersioning(input *s3.GetBucketVersioningInput) (output *s3.GetBucketVersioningOutput, err error) {
+	rec := c.record("GetBucketVersioning", input)
+	defer rec.done(&output, &err)
+	return c.getBucketVersioning(input)
+}
+
+// getBucketVersioning implements GetBucketVersioning and GetBucketVersioningRequest.
+func (c *Client) getBucketVersioning(input *s3.GetBucketVersioningInput) (output *s3.GetBucketVersioningOutput, err error) {
+	if err := c.startRequest("GetBucketVersioning", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("GetBucketVersioning", input.Bucket); err != nil {
+		return nil, err
+	}
+	c.m.Lock()
+	status := c.versioning
+	c.m.Unlock()
+	return &s3.GetBucketVersioningOutput{Status: stringOrNil(status)}, nil
+}
+
+// GetBucketVersioningRequest implements the request variant of
+// GetBucketVersioning.
+func (c *Client) GetBucketVersioningRequest(input *s3.GetBucketVersioningInput) (req *request.Request, output *s3.GetBucketVersioningOutput) {
+	req, output = c.svc.GetBucketVersioningRequest(input)
+	rec := c.record("GetBucketVersioning", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("GetBucketVersioningRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.getBucketVersioning(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// GetBucketVersioningWithContext implements the corresponding s3iface.API
+// method.
+func (c *Client) GetBucketVersioningWithContext(ctx aws.Context, input *s3.GetBucketVersioningInput, opts ...request.Option) (*s3.GetBucketVersioningOutput, error) {
+	req, out := c.GetBucketVersioningRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
+
+// ListObjectVersions lists the versions and delete markers of the objects
+// whose keys have the requested prefix, in key order and, for each key,
+// newest first. All of them are returned in a single page; delimiters and
+// markers are not supported.
+func (c *Client) ListObjectVersions(input *s3.ListObjectVersionsInput) (output *s3.ListObjectVersionsOutput, err error) {
+	rec := c.record("ListObjectVersions", input)
+	defer rec.done(&output, &err)
+	return c.listObjectVersions(input)
+}
+
+// listObjectVersions implements ListObjectVersions and ListObjectVersionsRequest.
+func (c *Client) listObjectVersions(input *s3.ListObjectVersionsInput) (output *s3.ListObjectVersionsOutput, err error) {
+	if err := c.startRequest("ListObjectVersions", input); err != nil {
+		return nil, err
+	}
+	if err := c.checkBucket("ListObjectVersions", input.Bucket); err != nil {
+		return nil, err
+	}
+	if input.Delimiter != nil || input.KeyMarker != nil || input.VersionIdMarker != nil {
+		return nil, awserr.NewRequestFailure(awserr.New("NotImplemented",
+			"s3test: ListObjectVersions does not support delimiters or markers", nil), http.StatusNotImplemented, "")
+	}
+	prefix := aws.StringValue(input.Prefix)
+	c.m.Lock()
+	defer c.m.Unlock()
+	var keys []string
+	for key := range c.content {
+		if _, ok := c.versions[key]; !ok && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range c.versions {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	output = &s3.ListObjectVersionsOutput{
+		Name:        aws.String(c.bucket),
+		Prefix:      input.Prefix,
+		IsTruncated: aws.Bool(false),
+	}
+	for _, key := range keys {
+		versions := c.versions[key]
+		if f, ok := c.content[key]; ok {
+			versions = append(versions[:len(versions):len(versions)], objectVersion{FileContent: f})
+		}
+		for i := len(versions) - 1; i >= 0; i-- {
+			v := versions[i]
+			latest := i == len(versions)-1 && v.noncurrent.IsZero()
+			if v.deleteMarker {
+				output.DeleteMarkers = append(output.DeleteMarkers, &s3.DeleteMarkerEntry{
+					Key:          aws.String(key),
+					VersionId:    aws.String(versionID(v.VersionID)),
+					IsLatest:     aws.Bool(latest),
+					LastModified: aws.Time(v.LastModified),
+				})
+				continue
+			}
+			output.Versions = append(output.Versions, &s3.ObjectVersion{
+				Key:          aws.String(key),
+				VersionId:    aws.String(versionID(v.VersionID)),
+				IsLatest:     aws.Bool(latest),
+				LastModified: aws.Time(v.LastModified),
+				ETag:         aws.String(v.etag()),
+				Size:         aws.Int64(v.Content.Size()),
+				StorageClass: stringOrNil(v.StorageClass),
+			})
+		}
+	}
+	return output, nil
+}
+
+// ListObjectVersionsRequest implements the request variant of
+// ListObjectVersions.
+func (c *Client) ListObjectVersionsRequest(input *s3.ListObjectVersionsInput) (req *request.Request, output *s3.ListObjectVersionsOutput) {
+	req, output = c.svc.ListObjectVersionsRequest(input)
+	rec := c.record("ListObjectVersions", input)
+	req.Handlers.Complete.PushBack(func(r *request.Request) { rec.done(&output, &r.Error) })
+	if err := c.startRequest("ListObjectVersionsRequest", input); err != nil {
+		req.Error = err
+		return
+	}
+	out, err := c.listObjectVersions(input)
+	if err != nil {
+		req.Error = err
+	} else {
+		*output = *out
+	}
+	return
+}
+
+// ListObjectVersionsWithContext implements the corresponding s3iface.API
+// method.
+func (c *Client) ListObjectVersionsWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, opts ...request.Option) (*s3.ListObjectVersionsOutput, error) {
+	req, out := c.ListObjectVersionsRequest(input)
+	setFakeResponse(ctx, req, opts...)
+	return out, req.Send()
+}
@@ -0,0 +1,110 @@
+package s3test_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/grailbio/testutil/expect"
+	"github.com/grailbio/testutil/s3test"
+)
+
+func putVersioning(client *s3test.Client, status string) error {
+	_, err := client.PutBucketVersioningWithContext(ctx, &s3.PutBucketVersioningInput{
+		Bucket:                  aws.String(testBucket),
+		VersioningConfiguration: &s3.VersioningConfiguration{Status: aws.String(status)},
+	})
+	return err
+}
+
+// putVersion writes data to key and returns the ID of the new version.
+func putVersion(t *testing.T, client *s3test.Client, key, data string) string {
+	out, err := client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader([]byte(data)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aws.StringValue(out.VersionId)
+}
+
+// listVersions returns the versions of the bucket as "<key> <version ID>"
+// strings, followed by its delete markers as "<key> <version ID> marker".
+// The current versions are suffixed by " *".
+func listVersions(t *testing.T, client *s3test.Client) []string {
+	out, err := client.ListObjectVersionsWithContext(ctx, &s3.ListObjectVersionsInput{Bucket: aws.String(testBucket)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []string
+	latest := func(b *bool) string {
+		if aws.BoolValue(b) {
+			return " *"
+		}
+		return ""
+	}
+	for _, v := range out.Versions {
+		versions = append(versions, aws.StringValue(v.Key)+" "+aws.StringValue(v.VersionId)+latest(v.IsLatest))
+	}
+	for _, m := range out.DeleteMarkers {
+		versions = append(versions, aws.StringValue(m.Key)+" "+aws.StringValue(m.VersionId)+" marker"+latest(m.IsLatest))
+	}
+	return versions
+}
+
+func TestVersioning(t *testing.T) {
+	client := s3test.NewClient(t, testBucket)
+	out, err := client.GetBucketVersioning(&s3.GetBucketVersioningInput{Bucket: aws.String(testBucket)})
+	expect.NoError(t, err)
+	expect.Nil(t, out.Status)
+	expect.EQ(t, awsErrCode(putVersioning(client, "Disabled")), "MalformedXML")
+
+	expect.EQ(t, putVersion(t, client, "a", "null"), "")
+	expect.NoError(t, putVersioning(client, s3.BucketVersioningStatusEnabled))
+	out, err = client.GetBucketVersioningWithContext(ctx, &s3.GetBucketVersioningInput{Bucket: aws.String(testBucket)})
+	expect.NoError(t, err)
+	expect.EQ(t, aws.StringValue(out.Status), s3.BucketVersioningStatusEnabled)
+
+	v1 := putVersion(t, client, "a", "v1")
+	v2 := putVersion(t, client, "a", "v2")
+	expect.EQ(t, v1, "testversionid1")
+	expect.EQ(t, v2, "testversionid2")
+	head, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(testBucket), Key: aws.String("a")})
+	expect.NoError(t, err)
+	expect.EQ(t, aws.StringValue(head.VersionId), v2)
+
+	// Deleting the object adds a delete marker.
+	del, err := client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(testBucket), Key: aws.String("a")})
+	expect.NoError(t, err)
+	expect.True(t, aws.BoolValue(del.DeleteMarker))
+	marker := aws.StringValue(del.VersionId)
+	_, err = getString(t, client, "a")
+	expect.EQ(t, awsErrCode(err), "NoSuchKey")
+	expect.EQ(t, listVersions(t, client), []string{
+		"a " + v2, "a " + v1, "a null", "a " + marker + " marker *",
+	})
+
+	// Deleting the marker makes the previous version current again, and
+	// deleting a noncurrent version removes it.
+	del, err = client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(testBucket), Key: aws.String("a"), VersionId: aws.String(marker)})
+	expect.NoError(t, err)
+	expect.True(t, aws.BoolValue(del.DeleteMarker))
+	data, err := getString(t, client, "a")
+	expect.NoError(t, err)
+	expect.EQ(t, data, "v2")
+	_, err = client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(testBucket), Key: aws.String("a"), VersionId: aws.String(v1)})
+	expect.NoError(t, err)
+	expect.EQ(t, listVersions(t, client), []string{"a " + v2 + " *", "a null"})
+
+	// While versioning is suspended, writes replace the null version.
+	expect.NoError(t, putVersioning(client, s3.BucketVersioningStatusSuspended))
+	expect.EQ(t, putVersion(t, client, "a", "s1"), "")
+	expect.EQ(t, putVersion(t, client, "a", "s2"), "")
+	expect.EQ(t, listVersions(t, client), []string{"a null *", "a " + v2})
+	data, err = getString(t, client, "a")
+	expect.NoError(t, err)
+	expect.EQ(t, data, "s2")
+}
@@ -0,0 +1,258 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package testutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// SandboxDirs are the directories of a test's sandbox (see Sandbox), all
+// of which are within Root.
+type SandboxDirs struct {
+	Root string
+	// Home is $HOME.
+	Home string
+	// TmpDir is $TMPDIR, and so os.TempDir().
+	TmpDir string
+	// WorkDir is the working directory.
+	WorkDir string
+	// ConfigHome, CacheHome, DataHome, StateHome and RuntimeDir are
+	// $XDG_CONFIG_HOME, $XDG_CACHE_HOME, $XDG_DATA_HOME, $XDG_STATE_HOME
+	// and $XDG_RUNTIME_DIR.
+	ConfigHome, CacheHome, DataHome, StateHome, RuntimeDir string
+}
+
+// SandboxOption configures Sandbox.
+type SandboxOption func(*sandbox)
+
+// CheckWritesOutside makes Sandbox fail the test if, when it completes,
+// files have been created, modified or removed in the given directories,
+// outside the sandbox. If no directories are given, the working directory
+// in effect when Sandbox is called is checked, as are the entries (but not
+// the contents of subdirectories) of the original $HOME.
+func CheckWritesOutside(dirs ...string) SandboxOption {
+	return func(s *sandbox) {
+		s.checkWrites = true
+		s.checkDirs = append(s.checkDirs, dirs...)
+	}
+}
+
+type sandbox struct {
+	checkWrites bool
+	checkDirs   []string
+}
+
+// Sandbox gives the test a hermetic environment: it sets $HOME, $TMPDIR and
+// the XDG base directories to new, empty directories and changes the
+// working directory to another, all within a new temporary directory. When
+// the test completes, Sandbox restores the environment variables, all of
+// which it snapshots, and the working directory, and then removes the
+// sandbox unless the test failed (see NoCleanupOnError and
+// KeepTempOnFailureEnv).
+//
+// The environment and working directory are shared by the whole process,
+// so tests that use Sandbox must not run in parallel with other tests.
+func Sandbox(t testing.TB, opts ...SandboxOption) *SandboxDirs {
+	t.Helper()
+	tc, ok := t.(interface{ Cleanup(func()) })
+	if !ok {
+		t.Fatalf("testutil.Sandbox: %T does not implement Cleanup", t)
+	}
+	var s sandbox
+	for _, opt := range opts {
+		opt(&s)
+	}
+	_, file, line, _ := runtime.Caller(1)
+	fatalf := func(format string, args ...interface{}) {
+		t.Fatalf("%s:%d: Sandbox: %s", filepath.Base(file), line, fmt.Sprintf(format, args...))
+	}
+
+	env := os.Environ()
+	wd, err := os.Getwd()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	var snapshots []*dirSnapshot
+	if s.checkWrites {
+		if len(s.checkDirs) == 0 {
+			snapshots = append(snapshots, &dirSnapshot{dir: wd, recursive: true})
+			if home := os.Getenv("HOME"); home != "" {
+				snapshots = append(snapshots, &dirSnapshot{dir: home})
+			}
+		}
+		for _, dir := range s.checkDirs {
+			snapshots = append(snapshots, &dirSnapshot{dir: dir, recursive: true})
+		}
+	}
+
+	root, cleanup := TempDir(t, tempRoot(""), "sandbox-")
+	// Resolve symlinks (e.g., /tmp on macOS) so that WorkDir matches
+	// os.Getwd.
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	dirs := &SandboxDirs{
+		Root:       root,
+		Home:       filepath.Join(root, "home"),
+		TmpDir:     filepath.Join(root, "tmp"),
+		WorkDir:    filepath.Join(root, "work"),
+		ConfigHome: filepath.Join(root, "home", ".config"),
+		CacheHome:  filepath.Join(root, "home", ".cache"),
+		DataHome:   filepath.Join(root, "home", ".local", "share"),
+		StateHome:  filepath.Join(root, "home", ".local", "state"),
+		RuntimeDir: filepath.Join(root, "run"),
+	}
+	for _, snap := range snapshots {
+		snap.skip = root
+		if err := snap.take(); err != nil {
+			cleanup()
+			fatalf("%v", err)
+		}
+	}
+	for _, dir := range []string{dirs.Home, dirs.TmpDir, dirs.WorkDir, dirs.ConfigHome, dirs.CacheHome, dirs.DataHome, dirs.StateHome, dirs.RuntimeDir} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			cleanup()
+			fatalf("%v", err)
+		}
+	}
+
+	tc.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Errorf("Sandbox: restoring the working directory: %v", err)
+		}
+		restoreEnv(t, env)
+		for _, snap := range snapshots {
+			snap.check(t)
+		}
+		if !keepTempOnFailure() {
+			cleanup()
+			return
+		}
+		NoCleanupOnError(t, cleanup, "sandbox:", root)
+	})
+
+	for _, kv := range [][2]string{
+		{"HOME", dirs.Home},
+		{"TMPDIR", dirs.TmpDir},
+		{"XDG_CONFIG_HOME", dirs.ConfigHome},
+		{"XDG_CACHE_HOME", dirs.CacheHome},
+		{"XDG_DATA_HOME", dirs.DataHome},
+		{"XDG_STATE_HOME", dirs.StateHome},
+		{"XDG_RUNTIME_DIR", dirs.RuntimeDir},
+		{"PWD", dirs.WorkDir},
+	} {
+		if err := os.Setenv(kv[0], kv[1]); err != nil {
+			fatalf("%v", err)
+		}
+	}
+	if err := os.Chdir(dirs.WorkDir); err != nil {
+		fatalf("%v", err)
+	}
+	return dirs
+}
+
+// restoreEnv makes the environment env, as returned by os.Environ.
+func restoreEnv(t testing.TB, env []string) {
+	os.Clearenv()
+	for _, kv := range env {
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			// Skip entries such as Windows' "=C:=C:\".
+			continue
+		}
+		if err := os.Setenv(kv[:i], kv[i+1:]); err != nil {
+			t.Errorf("Sandbox: restoring $%s: %v", kv[:i], err)
+		}
+	}
+}
+
+// fileState is the state of a file recorded by a dirSnapshot.
+type fileState struct {
+	size    int64
+	mode    os.FileMode
+	modTime int64
+}
+
+// dirSnapshot records the state of the files in dir, and of those in its
+// subdirectories if recursive, other than skip.
+type dirSnapshot struct {
+	dir       string
+	recursive bool
+	skip      string
+	files     map[string]fileState
+}
+
+func (d *dirSnapshot) read() (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	err := filepath.Walk(d.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) || os.IsPermission(err) {
+				return nil
+			}
+			return err
+		}
+		if path == d.dir {
+			return nil
+		}
+		if path == d.skip && info.IsDir() {
+			return filepath.SkipDir
+		}
+		st := fileState{mode: info.Mode()}
+		if !info.IsDir() {
+			// A directory's size and modification time change with its
+			// entries, which are recorded themselves.
+			st.size, st.modTime = info.Size(), info.ModTime().UnixNano()
+		}
+		files[path] = st
+		if info.IsDir() && !d.recursive {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return files, err
+}
+
+func (d *dirSnapshot) take() error {
+	var err error
+	d.files, err = d.read()
+	return err
+}
+
+// check fails the test if the files differ from those of the snapshot.
+func (d *dirSnapshot) check(t testing.TB) {
+	t.Helper()
+	files, err := d.read()
+	if err != nil {
+		t.Errorf("Sandbox: checking %v: %v", d.dir, err)
+		return
+	}
+	var problems []string
+	for path, st := range files {
+		if old, ok := d.files[path]; !ok {
+			problems = append(problems, "created "+path)
+		} else if old != st {
+			problems = append(problems, "modified "+path)
+		}
+	}
+	for path := range d.files {
+		if _, ok := files[path]; !ok {
+			problems = append(problems, "removed "+path)
+		}
+	}
+	sort.Strings(problems)
+	for i, p := range problems {
+		if i == maxReportedProblems {
+			t.Errorf("Sandbox: ... and %d more writes outside the sandbox", len(problems)-i)
+			break
+		}
+		t.Errorf("Sandbox: test wrote outside the sandbox: %s", p)
+	}
+}
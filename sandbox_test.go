@@ -0,0 +1,109 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package testutil_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/testutil"
+)
+
+func TestSandbox(t *testing.T) {
+	env := os.Environ()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dirs *testutil.SandboxDirs
+	t.Run("sandboxed", func(t *testing.T) {
+		dirs = testutil.Sandbox(t)
+		for _, v := range []struct{ name, want string }{
+			{"HOME", dirs.Home},
+			{"TMPDIR", dirs.TmpDir},
+			{"XDG_CONFIG_HOME", dirs.ConfigHome},
+			{"XDG_CACHE_HOME", dirs.CacheHome},
+			{"XDG_DATA_HOME", dirs.DataHome},
+			{"XDG_STATE_HOME", dirs.StateHome},
+			{"XDG_RUNTIME_DIR", dirs.RuntimeDir},
+		} {
+			if got := os.Getenv(v.name); got != v.want {
+				t.Errorf("$%s = %v, want %v", v.name, got, v.want)
+			}
+			if !strings.HasPrefix(v.want, dirs.Root+"/") {
+				t.Errorf("$%s = %v is not in %v", v.name, v.want, dirs.Root)
+			}
+			if info, err := os.Stat(v.want); err != nil || !info.IsDir() {
+				t.Errorf("$%s = %v is not a directory: %v", v.name, v.want, err)
+			}
+		}
+		if got, want := os.TempDir(), dirs.TmpDir; got != want {
+			t.Errorf("os.TempDir() = %v, want %v", got, want)
+		}
+		if got, err := os.Getwd(); err != nil || got != dirs.WorkDir {
+			t.Errorf("os.Getwd() = %v, %v, want %v", got, err, dirs.WorkDir)
+		}
+		if err := ioutil.WriteFile("file", []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		os.Setenv("TESTUTIL_SANDBOX_TEST", "1") // nolint: errcheck
+		os.Unsetenv("PATH")                     // nolint: errcheck
+	})
+	if got := os.Environ(); strings.Join(got, "\n") != strings.Join(env, "\n") {
+		t.Errorf("got environment %v, want %v", got, env)
+	}
+	if got, err := os.Getwd(); err != nil || got != wd {
+		t.Errorf("os.Getwd() = %v, %v, want %v", got, err, wd)
+	}
+	if _, err := os.Stat(dirs.Root); !os.IsNotExist(err) {
+		t.Errorf("%v was not removed: %v", dirs.Root, err)
+	}
+}
+
+func TestSandboxCheckWritesOutside(t *testing.T) {
+	outside := testutil.NewTempDir(t, "", "outside-")
+	if err := ioutil.WriteFile(filepath.Join(outside, "modified"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(outside, "removed"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(outside, "unchanged"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tb := &cleanupTB{TB: t}
+	dirs := testutil.Sandbox(tb, testutil.CheckWritesOutside(outside))
+	defer os.RemoveAll(dirs.Root) // nolint: errcheck
+	if err := ioutil.WriteFile(filepath.Join(dirs.Home, "inside"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(outside, "created"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(outside, "modified"), []byte("ab"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(outside, "removed")); err != nil {
+		t.Fatal(err)
+	}
+	tb.runCleanups()
+
+	want := []string{
+		"Sandbox: test wrote outside the sandbox: created " + filepath.Join(outside, "created"),
+		"Sandbox: test wrote outside the sandbox: modified " + filepath.Join(outside, "modified"),
+		"Sandbox: test wrote outside the sandbox: removed " + filepath.Join(outside, "removed"),
+	}
+	if got := tb.errors; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got errors %q, want %q", got, want)
+	}
+	// The sandbox of a failed test is kept.
+	if _, err := os.Stat(dirs.Root); err != nil {
+		t.Errorf("sandbox of a failed test: %v", err)
+	}
+}
@@ -24,6 +24,7 @@ type Testing interface {
 // TempDir is like ioutil.TempDir but intended for use from within tests.
 // In particular, it will t.Fatal if it fails and returns a function that
 // can be defer'ed by the caller to remove the newly created directory.
+// NewTempDir arranges for the directory to be removed instead.
 func TempDir(t Testing, dir, prefix string) (name string, cleanup func()) {
 	d, err := ioutil.TempDir(dir, prefix)
 	if err != nil {
@@ -0,0 +1,106 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package testutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// KeepTempOnFailureEnv is the environment variable that controls whether
+// the directories and files created by NewTempDir and NewTempFile are kept
+// when the test that created them fails, so that they can be inspected.
+// They are kept unless it is set to a false value (see strconv.ParseBool),
+// e.g., "0", in which case they are always removed.
+const KeepTempOnFailureEnv = "TESTUTIL_KEEP_TEMP_ON_FAILURE"
+
+// tempRoot returns the directory in which to create temporary files when
+// the caller does not specify one: $TEST_TMPDIR under Bazel, which Bazel
+// cleans up, and the default directory for temporary files otherwise.
+func tempRoot(dir string) string {
+	if dir != "" {
+		return dir
+	}
+	return os.Getenv("TEST_TMPDIR")
+}
+
+// keepTempOnFailure reports whether temporary files are kept when a test
+// fails, according to KeepTempOnFailureEnv.
+func keepTempOnFailure() bool {
+	v, ok := os.LookupEnv(KeepTempOnFailureEnv)
+	if !ok || v == "" {
+		return true
+	}
+	keep, err := strconv.ParseBool(v)
+	return err != nil || keep
+}
+
+// removeOnCleanup arranges for path to be removed when t and its subtests
+// complete. Like NoCleanupOnError, it keeps path, and logs its name, if the
+// test failed (unless disabled by KeepTempOnFailureEnv).
+func removeOnCleanup(t testing.TB, path string) {
+	tc, ok := t.(interface{ Cleanup(func()) })
+	if !ok {
+		t.Logf("testutil: %v will not be removed: %T does not implement Cleanup", path, t)
+		return
+	}
+	tc.Cleanup(func() {
+		if t.Failed() && keepTempOnFailure() {
+			t.Logf("testutil: test failed, keeping %v", path)
+			return
+		}
+		if err := os.RemoveAll(path); err != nil {
+			t.Logf("testutil: RemoveAll %v: %v", path, err)
+		}
+	})
+}
+
+// NewTempDir is like TempDir, but it removes the directory when the test
+// completes, using t.Cleanup, unless the test failed. If dir is empty, the
+// directory is created in $TEST_TMPDIR when running under Bazel, and in
+// the default directory for temporary files otherwise.
+func NewTempDir(t testing.TB, dir, prefix string) string {
+	t.Helper()
+	d, err := ioutil.TempDir(tempRoot(dir), prefix)
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		t.Fatalf("%s:%d: NewTempDir(%v, %v): %v", filepath.Base(file), line, dir, prefix, err)
+	}
+	removeOnCleanup(t, d)
+	return d
+}
+
+// NewTempFile creates a temporary file holding contents, with permissions
+// mode, and returns its name. The file is named and placed as by
+// ioutil.TempFile(dir, pattern), except that an empty dir is interpreted
+// as for NewTempDir, and it is removed when the test completes unless the
+// test failed.
+func NewTempFile(t testing.TB, dir, pattern string, contents []byte, mode os.FileMode) string {
+	t.Helper()
+	_, file, line, _ := runtime.Caller(1)
+	fail := func(err error) {
+		t.Fatalf("%s:%d: NewTempFile(%v, %v): %v", filepath.Base(file), line, dir, pattern, err)
+	}
+	f, err := ioutil.TempFile(tempRoot(dir), pattern)
+	if err != nil {
+		fail(err)
+	}
+	removeOnCleanup(t, f.Name())
+	_, err = f.Write(contents)
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fail(err)
+	}
+	return f.Name()
+}
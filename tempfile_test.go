@@ -0,0 +1,130 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package testutil_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/testutil"
+)
+
+// cleanupTB records the functions registered with Cleanup, so that tests
+// can run them, and the messages logged and errors reported through it. It
+// has failed if the test says so or an error was reported.
+type cleanupTB struct {
+	testing.TB
+	failed   bool
+	cleanups []func()
+	logs     []string
+	errors   []string
+}
+
+func (c *cleanupTB) Cleanup(fn func()) { c.cleanups = append(c.cleanups, fn) }
+
+func (c *cleanupTB) Failed() bool { return c.failed || len(c.errors) > 0 }
+
+func (c *cleanupTB) Logf(format string, args ...interface{}) {
+	c.logs = append(c.logs, fmt.Sprintf(format, args...))
+}
+
+func (c *cleanupTB) Errorf(format string, args ...interface{}) {
+	c.errors = append(c.errors, fmt.Sprintf(format, args...))
+}
+
+// runCleanups runs the registered functions in the order testing does.
+func (c *cleanupTB) runCleanups() {
+	for i := len(c.cleanups) - 1; i >= 0; i-- {
+		c.cleanups[i]()
+	}
+}
+
+func exists(t *testing.T, path string) bool {
+	_, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return err == nil
+}
+
+func TestNewTempDir(t *testing.T) {
+	for _, test := range []struct {
+		failed bool
+		env    string
+		keep   bool
+	}{
+		{false, "", false},
+		{true, "", true},
+		{true, "1", true},
+		{true, "0", false},
+		{false, "1", false},
+	} {
+		if test.env == "" {
+			os.Unsetenv(testutil.KeepTempOnFailureEnv) // nolint: errcheck
+		} else {
+			os.Setenv(testutil.KeepTempOnFailureEnv, test.env) // nolint: errcheck
+		}
+		tb := &cleanupTB{TB: t, failed: test.failed}
+		dir := testutil.NewTempDir(tb, "", "newtempdir-")
+		if err := ioutil.WriteFile(dir+"/file", []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if !exists(t, dir) {
+			t.Fatalf("%v does not exist", dir)
+		}
+		tb.runCleanups()
+		if got, want := exists(t, dir), test.keep; got != want {
+			t.Errorf("%+v: %v exists: got %v, want %v", test, dir, got, want)
+		}
+		if test.keep {
+			if len(tb.logs) != 1 || !strings.Contains(tb.logs[0], dir) {
+				t.Errorf("%+v: got logs %q, want the path %v", test, tb.logs, dir)
+			}
+			os.RemoveAll(dir) // nolint: errcheck
+		}
+	}
+	os.Unsetenv(testutil.KeepTempOnFailureEnv) // nolint: errcheck
+
+	if tmpdir, ok := os.LookupEnv("TEST_TMPDIR"); ok {
+		defer os.Setenv("TEST_TMPDIR", tmpdir) // nolint: errcheck
+	} else {
+		defer os.Unsetenv("TEST_TMPDIR") // nolint: errcheck
+	}
+	root := testutil.NewTempDir(t, "", "root-")
+	os.Setenv("TEST_TMPDIR", root) // nolint: errcheck
+	if dir := testutil.NewTempDir(t, "", "bazel-"); !strings.HasPrefix(dir, root+"/bazel-") {
+		t.Errorf("got %v, want a directory in $TEST_TMPDIR %v", dir, root)
+	}
+}
+
+func TestNewTempFile(t *testing.T) {
+	dir := testutil.NewTempDir(t, "", "newtempfile-")
+	tb := &cleanupTB{TB: t}
+	name := testutil.NewTempFile(tb, dir, "file-*.txt", []byte("contents"), 0751)
+	if !strings.HasPrefix(name, dir+"/file-") || !strings.HasSuffix(name, ".txt") {
+		t.Errorf("got name %v, want %v/file-*.txt", name, dir)
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "contents"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := info.Mode().Perm(), os.FileMode(0751); got != want {
+		t.Errorf("got mode %v, want %v", got, want)
+	}
+	tb.runCleanups()
+	if exists(t, name) {
+		t.Errorf("%v was not removed", name)
+	}
+}
@@ -5,14 +5,12 @@
 package testutil
 
 import (
-	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"runtime"
 	"runtime/debug"
 	"strings"
@@ -86,6 +84,9 @@ func NoCleanupOnError(t testing.TB, cleanup func(), args ...interface{}) {
 //
 // relativePath will need to be prefixed with a Bazel workspace designation if
 // the paths go across workspaces.
+//
+// ResolvePath also supports Go modules and Bazel runfiles manifests, and
+// returns an error rather than panicking.
 func GetFilePath(relativePath string) string {
 	var workspace string
 	if strings.HasPrefix(relativePath, "@") {
@@ -120,7 +121,7 @@ func GetFilePath(relativePath string) string {
 // for writing scratch data. When running under Bazel, Bazel should clean
 // up the directory. However, when running under vanilla Go tooling, it will
 // not be cleaned up. Thus, it's probably best for a test to clean up
-// any test directories itself.
+// any test directories itself, or to use NewTempDir, which does.
 func GetTmpDir() string {
 	bazelPath, hasBazelPath := os.LookupEnv("TEST_TMPDIR")
 	if hasBazelPath {
@@ -129,13 +130,14 @@ func GetTmpDir() string {
 
 	tmpPath, err := ioutil.TempDir("/tmp", "go_test_")
 	if err != nil {
-		panic(err.Error)
+		panic(err)
 	}
 	return tmpPath
 }
 
 // GetTmpPath returns a random file inside of the appropriate scratch directory.
-// The path is neither created nor cleaned up -- clients are expected to use do both.
+// The path is neither created nor cleaned up -- clients are expected to do both,
+// or to use NewTempFile, which does.
 func GetTmpPath() string {
 	fileName := fmt.Sprintf("/tmp_file_%v", rand.Int())
 	return GetTmpDir() + fileName
@@ -189,59 +191,14 @@ func IsBazel() bool {
 // GoExecutable returns the Go executable for "path", or builds the executable
 // and returns its path. The latter happens when the caller is not running under
 // Bazel. "path" must start with "//go/src/grail.com/".  For example,
-// "//go/src/grail.com/cmd/bio-metrics/bio-metrics".
+// "//go/src/grail.com/cmd/bio-metrics/bio-metrics". See GoExecutableOpts for
+// other forms of path and for build options.
 func GoExecutable(t testing.TB, path string) string {
-	return GoExecutableEnv(t, path, nil)
+	return GoExecutableOpts(t, path)
 }
 
 // GoExecutableEnv is like GoExecutable but allows environment variables
 // to be specified.
 func GoExecutableEnv(t testing.TB, path string, env []string) string {
-	re := regexp.MustCompile("^(@[^@/]+)?//(.*/([^/]+))/([^/]+)$")
-	match := re.FindStringSubmatch(path)
-	// staticcheck doesn't realize that t.Fatalf stops execution.
-	if match == nil { //nolint:staticcheck
-		t.Fatalf("%v: path must be of format \"//path/package/binary\"",
-			path)
-	}
-	workspace, pkg, pkgName, binary := match[1], match[2], match[3], match[4] //nolint:staticcheck
-
-	if IsBazel() {
-		expandedPath := GetFilePath(path)
-		if _, err := os.Stat(expandedPath); err == nil {
-			return expandedPath
-		}
-		pattern := GetFilePath(fmt.Sprintf("%s//%s/*/%s", workspace, pkg, binary))
-		paths, err := filepath.Glob(pattern)
-		assert.NoError(t, err, "glob %v", pattern)
-		assert.EQ(t, len(paths), 1, "Pattern %s must match exactly one executable, but found %v", pattern, paths)
-		return paths[0]
-	}
-
-	if workspace != "" {
-		t.Fatalf("%v: workspace can not be set when not under bazel", path)
-	}
-	if pkgName != binary {
-		t.Fatalf("%v: package name and binary must match", path)
-	}
-	pkg = strings.TrimPrefix(pkg, "go/src/")
-	wd, err := os.Getwd()
-	if err != nil {
-		t.Fatalf("could not obtain current directory")
-	}
-	hashString := func(s string) string {
-		b := sha256.Sum256([]byte(s))
-		return fmt.Sprintf("%x", b[:16])
-	}
-	tempDir := filepath.Join(os.TempDir(), "go_build", hashString(wd+pkg))
-	os.MkdirAll(tempDir, 0700) // nolint: errcheck
-	xpath := filepath.Join(tempDir, filepath.Base(pkg))
-	cmd := exec.Command("go", "build", "-o", xpath, pkg)
-	if env != nil {
-		cmd.Env = env
-	}
-	if output, err := cmd.CombinedOutput(); err != nil {
-		t.Fatalf("go build %s: %v\n%s\n", pkg, err, string(output))
-	}
-	return xpath
+	return GoExecutableOpts(t, path, BuildEnv(env))
 }
@@ -0,0 +1,203 @@
+package testutil
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// Access is a ReadAt or WriteAt call recorded by a VerifyingContent.
+type Access struct {
+	// Seq is the position of the access among all the accesses, reads and
+	// writes, to the content.
+	Seq int
+	// Offset and Length give the range of bytes read or written.
+	Offset, Length int64
+}
+
+// End returns the offset of the end of the access.
+func (a Access) End() int64 { return a.Offset + a.Length }
+
+// AccessStats summarizes the accesses to a VerifyingContent.
+type AccessStats struct {
+	Reads, Writes           int
+	BytesRead, BytesWritten int64
+	// ReadAmplification is the number of bytes read divided by the size of
+	// the content; it is 1 if every byte was read once.
+	ReadAmplification float64
+	// OutOfOrderReads and OutOfOrderWrites count the accesses that do not
+	// start at or after the end of the previous access of the same kind.
+	OutOfOrderReads, OutOfOrderWrites int
+}
+
+// VerifyingContent wraps a ContentAt and records the range of every ReadAt
+// and WriteAt call, so that tests can check how code under test accesses
+// its data: for example, that a writer writes every byte exactly once
+// (CheckWritesTile), or that a reader does not read more than necessary
+// (Stats). VerifyingContent is safe for concurrent use if the wrapped
+// content is.
+type VerifyingContent struct {
+	t       testing.TB
+	content ContentAt
+
+	mu     sync.Mutex
+	seq    int
+	reads  []Access
+	writes []Access
+}
+
+// NewVerifyingContent returns a VerifyingContent that wraps content and
+// reports failures to t.
+func NewVerifyingContent(t testing.TB, content ContentAt) *VerifyingContent {
+	return &VerifyingContent{t: t, content: content}
+}
+
+func (v *VerifyingContent) record(accesses *[]Access, off int64, n int) {
+	if n <= 0 {
+		return
+	}
+	v.mu.Lock()
+	*accesses = append(*accesses, Access{Seq: v.seq, Offset: off, Length: int64(n)})
+	v.seq++
+	v.mu.Unlock()
+}
+
+// ReadAt implements io.ReaderAt.
+func (v *VerifyingContent) ReadAt(p []byte, off int64) (int, error) {
+	n, err := v.content.ReadAt(p, off)
+	v.record(&v.reads, off, n)
+	return n, err
+}
+
+// WriteAt implements io.WriterAt.
+func (v *VerifyingContent) WriteAt(p []byte, off int64) (int, error) {
+	n, err := v.content.WriteAt(p, off)
+	v.record(&v.writes, off, n)
+	return n, err
+}
+
+// Size implements ContentAt.
+func (v *VerifyingContent) Size() int64 { return v.content.Size() }
+
+// Checksum implements ContentAt.
+func (v *VerifyingContent) Checksum() string { return v.content.Checksum() }
+
+// Reads returns the reads recorded so far, in the order they completed.
+func (v *VerifyingContent) Reads() []Access {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return append([]Access(nil), v.reads...)
+}
+
+// Writes returns the writes recorded so far, in the order they completed.
+func (v *VerifyingContent) Writes() []Access {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return append([]Access(nil), v.writes...)
+}
+
+// Reset discards the recorded accesses.
+func (v *VerifyingContent) Reset() {
+	v.mu.Lock()
+	v.seq, v.reads, v.writes = 0, nil, nil
+	v.mu.Unlock()
+}
+
+// outOfOrder returns the number of accesses that do not start at or after
+// the end of the previous one.
+func outOfOrder(accesses []Access) int {
+	var n int
+	for i := 1; i < len(accesses); i++ {
+		if accesses[i].Offset < accesses[i-1].End() {
+			n++
+		}
+	}
+	return n
+}
+
+// Stats summarizes the accesses recorded so far.
+func (v *VerifyingContent) Stats() AccessStats {
+	reads, writes := v.Reads(), v.Writes()
+	s := AccessStats{
+		Reads:            len(reads),
+		Writes:           len(writes),
+		OutOfOrderReads:  outOfOrder(reads),
+		OutOfOrderWrites: outOfOrder(writes),
+	}
+	for _, r := range reads {
+		s.BytesRead += r.Length
+	}
+	for _, w := range writes {
+		s.BytesWritten += w.Length
+	}
+	if size := v.Size(); size > 0 {
+		s.ReadAmplification = float64(s.BytesRead) / float64(size)
+	}
+	return s
+}
+
+// maxReportedProblems limits the number of problems reported by the
+// Check methods.
+const maxReportedProblems = 10
+
+// CheckWritesTile fails the test unless the writes recorded so far cover
+// [0, Size()) exactly, with no gaps and no byte written more than once.
+func (v *VerifyingContent) CheckWritesTile() {
+	v.t.Helper()
+	writes := v.Writes()
+	sort.Slice(writes, func(i, j int) bool { return writes[i].Offset < writes[j].Offset })
+	var (
+		problems []string
+		next     int64
+	)
+	for _, w := range writes {
+		switch {
+		case w.Offset > next:
+			problems = append(problems, fmt.Sprintf("gap [%d, %d)", next, w.Offset))
+		case w.Offset < next:
+			problems = append(problems, fmt.Sprintf("overlap [%d, %d) (write #%d)", w.Offset, min(next, w.End()), w.Seq))
+		}
+		next = max(next, w.End())
+	}
+	if size := v.Size(); next < size {
+		problems = append(problems, fmt.Sprintf("gap [%d, %d)", next, size))
+	} else if next > size {
+		problems = append(problems, fmt.Sprintf("writes extend to %d, beyond size %d", next, size))
+	}
+	for i, p := range problems {
+		if i == maxReportedProblems {
+			v.t.Errorf("VerifyingContent: ... and %d more problems", len(problems)-i)
+			break
+		}
+		v.t.Errorf("VerifyingContent: writes do not tile the content: %s", p)
+	}
+}
+
+// CheckReadAmplification fails the test if more than maxAmplification
+// times the size of the content has been read.
+func (v *VerifyingContent) CheckReadAmplification(maxAmplification float64) {
+	v.t.Helper()
+	if s := v.Stats(); s.ReadAmplification > maxAmplification {
+		v.t.Errorf("VerifyingContent: read %d bytes of %d in %d reads: amplification %.2f > %.2f",
+			s.BytesRead, v.Size(), s.Reads, s.ReadAmplification, maxAmplification)
+	}
+}
+
+// CheckSequential fails the test if any read or write recorded so far did
+// not start at or after the end of the previous one of the same kind.
+func (v *VerifyingContent) CheckSequential() {
+	v.t.Helper()
+	for _, kind := range []struct {
+		name     string
+		accesses []Access
+	}{{"read", v.Reads()}, {"write", v.Writes()}} {
+		for i := 1; i < len(kind.accesses); i++ {
+			if prev, a := kind.accesses[i-1], kind.accesses[i]; a.Offset < prev.End() {
+				v.t.Errorf("VerifyingContent: out of order %s of [%d, %d) after [%d, %d)",
+					kind.name, a.Offset, a.End(), prev.Offset, prev.End())
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package testutil_test
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/grailbio/testutil"
+	"github.com/grailbio/testutil/s3test"
+)
+
+// errorsTB records the errors reported through it.
+type errorsTB struct {
+	testing.TB
+	errors []string
+}
+
+func (e *errorsTB) Helper() {}
+
+func (e *errorsTB) Errorf(format string, args ...interface{}) {
+	e.errors = append(e.errors, fmt.Sprintf(format, args...))
+}
+
+func TestVerifyingContentTile(t *testing.T) {
+	for _, test := range []struct {
+		writes [][2]int64
+		want   []string
+	}{
+		{[][2]int64{{5, 5}, {0, 5}}, nil},
+		{[][2]int64{{0, 4}, {6, 4}}, []string{"gap [4, 6)"}},
+		{[][2]int64{{0, 6}, {4, 6}}, []string{"overlap [4, 6)"}},
+		{[][2]int64{{0, 8}}, []string{"gap [8, 10)"}},
+	} {
+		tb := &errorsTB{TB: t}
+		v := testutil.NewVerifyingContent(tb, &testutil.SparseContent{SizeInBytes: 10})
+		for _, w := range test.writes {
+			if _, err := v.WriteAt(make([]byte, w[1]), w[0]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		v.CheckWritesTile()
+		if got, want := len(tb.errors), len(test.want); got != want {
+			t.Errorf("%v: got %v, want %v", test.writes, tb.errors, test.want)
+			continue
+		}
+		for i, err := range tb.errors {
+			if !strings.Contains(err, test.want[i]) {
+				t.Errorf("%v: got %q, want %q", test.writes, err, test.want[i])
+			}
+		}
+	}
+}
+
+func TestVerifyingContentStats(t *testing.T) {
+	tb := &errorsTB{TB: t}
+	v := testutil.NewVerifyingContent(tb, &testutil.OffsetContent{SizeInBytes: 100})
+	p := make([]byte, 40)
+	for _, off := range []int64{0, 40, 20, 80} {
+		if _, err := v.ReadAt(p, off); err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+	}
+	s := v.Stats()
+	if got, want := s, (testutil.AccessStats{Reads: 4, BytesRead: 140, ReadAmplification: 1.4, OutOfOrderReads: 1}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	v.CheckReadAmplification(1.5)
+	if len(tb.errors) != 0 {
+		t.Errorf("unexpected errors %v", tb.errors)
+	}
+	v.CheckReadAmplification(1)
+	v.CheckSequential()
+	if got, want := len(tb.errors), 2; got != want {
+		t.Errorf("got %v, want %d errors", tb.errors, want)
+	}
+
+	v.Reset()
+	if got := v.Stats(); got != (testutil.AccessStats{}) {
+		t.Errorf("got %+v after Reset", got)
+	}
+}
+
+// TestVerifyingContentS3 checks that downloads from s3test read each byte
+// of an object once, and that s3manager downloads tile their destination.
+func TestVerifyingContentS3(t *testing.T) {
+	const size = 3<<20 + 17
+	src := testutil.NewVerifyingContent(t, &testutil.RandomContent{Seed: 1, SizeInBytes: size})
+	client := s3test.NewClient(t, "bucket")
+	client.SetFileContentAt("key", src, "")
+	src.Reset() // SetFileContentAt reads the content to compute its checksum.
+
+	dst := testutil.NewVerifyingContent(t, &testutil.SparseContent{SizeInBytes: size})
+	downloader := s3manager.NewDownloaderWithClient(client, func(d *s3manager.Downloader) {
+		d.PartSize = 1 << 20
+		d.Concurrency = 3
+	})
+	if _, err := downloader.Download(dst, &s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")}); err != nil {
+		t.Fatal(err)
+	}
+	dst.CheckWritesTile()
+	src.CheckReadAmplification(1)
+
+	out, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.Reset()
+	if _, err := io.Copy(ioutil.Discard, out.Body); err != nil {
+		t.Fatal(err)
+	}
+	src.CheckSequential()
+}